@@ -1,94 +1,302 @@
 package degen
 
 import (
-	"fmt"
 	"github.com/faiface/generics/go/ast"
-	"github.com/faiface/generics/go/importer"
+	"github.com/faiface/generics/go/scanner"
 	"github.com/faiface/generics/go/token"
 	"github.com/faiface/generics/go/types"
 )
 
-func Degen(fset *token.FileSet, input *ast.File, debug bool) (output *ast.File, changed bool) {
-	typesCfg := &types.Config{
-		Importer: importer.Default(),
-	}
-	info := &types.Info{
-		Types:            make(map[ast.Expr]types.TypeAndValue),
-		Defs:             make(map[*ast.Ident]types.Object),
-		Uses:             make(map[*ast.Ident]types.Object),
-		GenericCalls:     make(map[*ast.CallExpr]*types.GenericCall),
-		GenericInstances: make(map[*ast.CallExpr]*types.GenericInstance),
-	}
-	_, err := typesCfg.Check("", fset, []*ast.File{input}, info)
-	if err != nil && debug {
-		fmt.Println(err)
+// Degen translates generic calls and instances in the files of a single package, keeping the
+// generic declarations. Each input file produces exactly one output file at the same index.
+// Instantiations are emitted once per package, into the output file that declares the generic
+// function or type, right after it. Generic functions and types imported from other packages
+// are instantiated in the file that uses them.
+//
+// The files are type-checked once. Generic calls and instances found in instantiated code are
+// translated using the type information of the generic code, and the declarations they need
+// are instantiated from a worklist, so the output contains no generic calls or instances.
+//
+// If opts.LineDirectives is set, instantiated code keeps the positions of the generic code it
+// was copied from. They are recorded in copies of the generic source files in the file set, so
+// that printing with printer.SourcePos points //line directives at the generic source.
+//
+// Chains of instantiations that keep growing type arguments, made by polymorphic recursion like
+// func F(x type T) { F([]T{x}) }, are reported as errors. So are chains longer than
+// opts.MaxDepth, unless it's zero or less.
+//
+// Instances are named according to opts.Mangling. Their names never clash with other
+// declarations of the package, nor with each other: a name that's already taken gets a number
+// appended.
+//
+// Generic functions and methods of generic types are translated according to opts.Mode.
+//
+// If the files don't type-check, or contain constructs that can't be translated, Degen returns
+// no output and a scanner.ErrorList of all the problems, sorted by position.
+func Degen(fset *token.FileSet, input []*ast.File, opts Options) (output []*ast.File, err error) {
+	if opts.Importer == nil {
+		opts.Importer = NewImporter(fset)
 	}
+	output, _, err = degen(fset, input, opts)
+	return output, err
+}
 
-	output = &ast.File{
-		Name:    input.Name,
-		Imports: input.Imports,
+// degen is Degen, also returning the instances in the order they were instantiated.
+func degen(fset *token.FileSet, input []*ast.File, opts Options) (output []*ast.File, instances []*instance, err error) {
+	imp := opts.Importer
+	pkg, info, err := check(fset, imp, input)
+	if err != nil {
+		return nil, nil, err
 	}
+	var errors scanner.ErrorList
+
+	local := newSource(pkg, input, info)
 
 	cfg := &config{
-		info:         info,
-		instantiated: make(map[string]bool),
-		input:        input,
-		output:       output,
+		fset:           fset,
+		lineDirectives: opts.LineDirectives,
+		maxDepth:       opts.MaxDepth,
+		shadows:        make(map[*token.File]*token.File),
+		info:           info,
+		pkg:            pkg,
+		src:            local,
+		sources:        map[*types.Package]*source{pkg: local},
+		namer:          newNamer(opts.Mangling),
+		mode:           opts.Mode,
+		shared:         make(map[*ast.FuncDecl]*shared),
+		shapeable:      make(map[*ast.FuncDecl]bool),
+		instantiated:   make(map[string]bool),
+		worklist:       new([]*instance),
+		instances:      &instances,
+		errors:         &errors,
+		outputOf:       make(map[ast.Node]*ast.File),
+		imports:        make(map[*ast.File]map[string]string),
+	}
+	for pkg, src := range imp.packages {
+		cfg.sources[pkg] = src
 	}
 
-	for _, decl := range input.Decls {
-		switch decl := decl.(type) {
-		case *ast.FuncDecl:
-			if decl.Recv.NumFields() == 0 {
-				cfg.instantiated[decl.Name.Name] = true
+	for _, file := range input {
+		out := &ast.File{
+			Doc:      file.Doc,
+			Package:  file.Package,
+			Name:     file.Name,
+			Imports:  file.Imports,
+			Comments: file.Comments,
+		}
+		output = append(output, out)
+		cfg.outputs = append(cfg.outputs, out)
+
+		cfg.imports[out] = make(map[string]string)
+		for _, spec := range file.Imports {
+			obj := info.Implicits[spec]
+			if spec.Name != nil {
+				obj = info.Defs[spec.Name]
 			}
-		case *ast.GenDecl:
-			for _, spec := range decl.Specs {
-				switch spec := spec.(type) {
-				case *ast.TypeSpec:
-					cfg.instantiated[spec.Name.Name] = true
-				}
+			if pkgName, ok := obj.(*types.PkgName); ok && pkgName.Name() != "_" {
+				cfg.imports[out][pkgName.Imported().Path()] = pkgName.Name()
 			}
 		}
-	}
 
-	for _, decl := range input.Decls {
-		switch decl := decl.(type) {
-		case *ast.FuncDecl:
-			if len(decl.TypeParams) > 0 {
-				output.Decls = append(output.Decls, decl)
-				continue
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				cfg.outputOf[decl] = out
+				if decl.Recv.NumFields() == 0 {
+					cfg.namer.taken[decl.Name.Name] = true
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						cfg.outputOf[spec] = out
+						cfg.namer.taken[spec.Name.Name] = true
+					}
+				}
 			}
-			changed = degenFuncDecl(cfg, decl) || changed
+		}
+	}
 
-		case *ast.GenDecl:
-			if decl.Tok != token.TYPE {
-				output.Decls = append(output.Decls, decl)
-				continue
-			}
+	for i, file := range input {
+		cfg.output = output[i]
 
-			for _, spec := range decl.Specs {
-				spec := spec.(*ast.TypeSpec)
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if len(decl.TypeParams) > 0 || len(decl.ConstParams) > 0 {
+					cfg.output.Decls = append(cfg.output.Decls, decl)
+					continue
+				}
+				cfg.catch(decl.Pos(), func() {
+					degenFuncDecl(cfg, decl)
+				})
 
-				if len(spec.Params) > 0 {
-					output.Decls = append(output.Decls, decl)
+			case *ast.GenDecl:
+				if decl.Tok == token.IMPORT {
+					cfg.output.Decls = append(cfg.output.Decls, decl)
 					continue
 				}
 
-				changed = degenTypeSpec(cfg, spec) || changed
+				cfg.catch(decl.Pos(), func() {
+					degenGenDecl(cfg, decl)
+				})
+
+			default:
+				cfg.output.Decls = append(cfg.output.Decls, decl)
 			}
+		}
+	}
+
+	if err := errors.Err(); err != nil {
+		// an error in generic code is reported for each of its instances
+		errors.RemoveMultiples()
+		return nil, nil, errors
+	}
+	for _, file := range output {
+		placeInstances(file, instances)
+	}
+	return output, instances, nil
+}
 
-		default:
-			output.Decls = append(output.Decls, decl)
+// placeInstances moves the declarations of instances in the file right after the generic
+// declarations they're instantiated from, if those are in the file too. The first of them takes
+// the position of the generic declaration, so that it's printed among the comments around it.
+func placeInstances(file *ast.File, instances []*instance) {
+	inFile := make(map[ast.Decl]bool)
+	generics := make(map[ast.Node]ast.Decl) // declarations holding the generic functions and types
+	for _, decl := range file.Decls {
+		inFile[decl] = true
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			generics[decl] = decl
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				generics[spec] = decl
+			}
 		}
 	}
 
-	return output, changed
+	following := make(map[ast.Decl][]ast.Decl)
+	moved := make(map[ast.Decl]bool)
+	for _, inst := range instances {
+		generic, ok := generics[inst.decl]
+		if !ok {
+			continue
+		}
+		for _, decl := range inst.decls {
+			// the declarations of an instance include those of the instances instantiated
+			// while it was, which come earlier in instances
+			if inFile[decl] && !moved[decl] {
+				following[generic] = append(following[generic], decl)
+				moved[decl] = true
+			}
+		}
+	}
+
+	var decls []ast.Decl
+	for _, decl := range file.Decls {
+		if moved[decl] {
+			continue
+		}
+		decls = append(decls, decl)
+		if len(following[decl]) == 0 {
+			continue
+		}
+		switch first := following[decl][0].(type) {
+		case *ast.FuncDecl:
+			first.Type.Func = decl.Pos()
+		case *ast.GenDecl:
+			first.TokPos = decl.Pos()
+		}
+		decls = append(decls, following[decl]...)
+	}
+	file.Decls = decls
+}
+
+// check type-checks the files of a single package. If they don't type-check, it returns a
+// scanner.ErrorList of all the problems, sorted by position.
+func check(fset *token.FileSet, imp *Importer, input []*ast.File) (*types.Package, *types.Info, error) {
+	var errors scanner.ErrorList
+	typesCfg := &types.Config{
+		Importer: imp,
+		Error: func(err error) {
+			if typeErr, ok := err.(types.Error); ok {
+				errors.Add(typeErr.Fset.Position(typeErr.Pos), typeErr.Msg)
+			} else {
+				errors.Add(token.Position{}, err.Error())
+			}
+		},
+	}
+	info := newInfo()
+	pkg, _ := typesCfg.Check("", fset, input, info)
+	if err := errors.Err(); err != nil {
+		errors.Sort()
+		return nil, nil, err
+	}
+	return pkg, info, nil
 }
 
 type config struct {
-	info         *types.Info
-	instantiated map[string]bool
-	input        *ast.File
-	output       *ast.File
+	fset           *token.FileSet
+	lineDirectives bool                        // whether instantiated code keeps its positions
+	maxDepth       int                         // maximum length of a chain of instances; 0 for no limit
+	shadows        map[*token.File]*token.File // copies of files holding the positions of instantiated code
+	info           *types.Info                 // type information of the syntax being translated
+	pkg            *types.Package              // package being translated
+	src            *source                     // package declaring the syntax being translated
+	sources        map[*types.Package]*source
+	namer          *namer                          // names of instances
+	mode           Mode                            // translation of generic functions
+	shared         map[*ast.FuncDecl]*shared       // shared implementations; nil for functions that can't be shared
+	shapeable      map[*ast.FuncDecl]bool          // whether instances of functions can share code with their shapes
+	replace        map[ast.Node]ast.Expr           // replacements of nodes of generic code, used by dictionaries
+	instantiated   map[string]bool                 // names of instances added to the worklist
+	worklist       *[]*instance                    // declarations waiting to be instantiated
+	instances      *[]*instance                    // instantiated declarations, in the order they were instantiated
+	inst           *instance                       // instance being instantiated; nil in non-generic code
+	errors         *scanner.ErrorList              // errors of all declarations
+	output         *ast.File                       // output file for the declarations being translated
+	outputs        []*ast.File                     // output files, in the order of the input files
+	outputOf       map[ast.Node]*ast.File          // output file of each local package-level declaration
+	imports        map[*ast.File]map[string]string // import names by package paths in each output file
+}
+
+// forDecl returns a configuration for instantiating the declaration decl from the package src.
+func (cfg *config) forDecl(src *source, decl ast.Node) *config {
+	declCfg := *cfg
+	declCfg.info = src.info
+	declCfg.src = src
+	declCfg.replace = nil
+	if output, ok := cfg.outputOf[decl]; ok {
+		declCfg.output = output
+	}
+	return &declCfg
+}
+
+// pos returns the position of instantiated code copied from generic code at pos. Instantiated
+// code has no positions, unless line directives are enabled. Then its positions are moved to a
+// copy of the generic source file, which maps to the same lines, but never gets interleaved with
+// the comments of the file it's written to.
+func (cfg *config) pos(pos token.Pos) token.Pos {
+	if !cfg.lineDirectives || !pos.IsValid() {
+		return token.NoPos
+	}
+
+	file := cfg.fset.File(pos)
+	shadow, ok := cfg.shadows[file]
+	if !ok {
+		shadow = cfg.fset.AddFile(file.Name(), -1, file.Size())
+		var lines []int
+		for offset := 0; offset < file.Size(); offset++ {
+			if file.PositionFor(file.Pos(offset), false).Column != 1 {
+				continue
+			}
+			lines = append(lines, offset)
+			adjusted := file.Position(file.Pos(offset))
+			shadow.AddLineInfo(offset, adjusted.Filename, adjusted.Line)
+		}
+		shadow.SetLines(lines)
+		cfg.shadows[file] = shadow
+	}
+	return shadow.Pos(file.Offset(pos))
 }
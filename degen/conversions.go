@@ -3,17 +3,27 @@ package degen
 import (
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
+	"unicode"
 	"github.com/faiface/generics/go/ast"
 	"github.com/faiface/generics/go/token"
 	"github.com/faiface/generics/go/types"
 )
 
-func tupleToFieldList(t *types.Tuple) *ast.FieldList {
+// tupleToFieldList converts the parameters or results of a function type. If variadic, the last
+// parameter is a slice converted to ...T.
+func tupleToFieldList(cfg *config, t *types.Tuple, variadic bool) *ast.FieldList {
 	var fields ast.FieldList
 	for i := 0; i < t.Len(); i++ {
 		v := t.At(i)
 		field := &ast.Field{
-			Type: typeToExpr(v.Type()),
+			Type: typeToExpr(cfg, v.Type()),
+		}
+		if variadic && i == t.Len()-1 {
+			field.Type = &ast.Ellipsis{
+				Elt: typeToExpr(cfg, v.Type().(*types.Slice).Elem()),
+			}
 		}
 		if v.Name() != "" {
 			field.Names = []*ast.Ident{{Name: v.Name()}}
@@ -23,12 +33,14 @@ func tupleToFieldList(t *types.Tuple) *ast.FieldList {
 	return &fields
 }
 
-func typeToExpr(t types.Type) ast.Expr {
+// typeToExpr converts a type to an expression denoting an identical type in the output file.
+// Tuples aren't types of expressions, parameters and results are converted by tupleToFieldList.
+func typeToExpr(cfg *config, t types.Type) ast.Expr {
 	switch t := t.(type) {
-	case nil:
-		return &ast.BadExpr{}
-
 	case *types.Basic:
+		if t.Kind() == types.UnsafePointer {
+			return selector(cfg, types.Unsafe, t.Name(), token.NoPos)
+		}
 		return &ast.Ident{
 			Name: t.Name(),
 		}
@@ -39,24 +51,33 @@ func typeToExpr(t types.Type) ast.Expr {
 				Kind:  token.INT,
 				Value: fmt.Sprint(t.Len()),
 			},
-			Elt: typeToExpr(t.Elem()),
+			Elt: typeToExpr(cfg, t.Elem()),
 		}
 
 	case *types.Slice:
 		return &ast.ArrayType{
-			Elt: typeToExpr(t.Elem()),
+			Elt: typeToExpr(cfg, t.Elem()),
 		}
 
 	case *types.Struct:
 		var fields ast.FieldList
 		for i := 0; i < t.NumFields(); i++ {
 			v := t.Field(i)
+			if foreign(cfg, v) && !v.Exported() {
+				cfg.errorf(v.Pos(), "cannot refer to field %s outside of package %s: it is not exported", v.Name(), v.Pkg().Path())
+			}
 			field := &ast.Field{
-				Type: typeToExpr(v.Type()),
+				Type: typeToExpr(cfg, v.Type()),
 			}
-			if v.Name() != "" {
+			if !v.Anonymous() {
 				field.Names = []*ast.Ident{{Name: v.Name()}}
 			}
+			if tag := t.Tag(i); tag != "" {
+				field.Tag = &ast.BasicLit{
+					Kind:  token.STRING,
+					Value: tagLit(tag),
+				}
+			}
 			fields.List = append(fields.List, field)
 		}
 		return &ast.StructType{
@@ -65,28 +86,33 @@ func typeToExpr(t types.Type) ast.Expr {
 
 	case *types.Pointer:
 		return &ast.StarExpr{
-			X: typeToExpr(t.Elem()),
+			X: typeToExpr(cfg, t.Elem()),
 		}
 
-	case *types.Tuple:
-		return &ast.BadExpr{}
-
 	case *types.Signature:
 		if len(t.TypeParams()) > 0 {
-			return &ast.BadExpr{}
+			panic(fmt.Sprintf("typeToExpr: generic signature %s", t))
 		}
 		return &ast.FuncType{
-			Params:  tupleToFieldList(t.Params()),
-			Results: tupleToFieldList(t.Results()),
+			Params:  tupleToFieldList(cfg, t.Params(), t.Variadic()),
+			Results: tupleToFieldList(cfg, t.Results(), false),
 		}
 
 	case *types.Interface:
 		var methods ast.FieldList
-		for i := 0; i < t.NumMethods(); i++ {
-			meth := t.Method(i)
+		for i := 0; i < t.NumEmbeddeds(); i++ {
+			methods.List = append(methods.List, &ast.Field{
+				Type: typeToExpr(cfg, t.Embedded(i)),
+			})
+		}
+		for i := 0; i < t.NumExplicitMethods(); i++ {
+			meth := t.ExplicitMethod(i)
+			if foreign(cfg, meth) && !meth.Exported() {
+				cfg.errorf(meth.Pos(), "cannot refer to method %s outside of package %s: it is not exported", meth.Name(), meth.Pkg().Path())
+			}
 			methods.List = append(methods.List, &ast.Field{
 				Names: []*ast.Ident{{Name: meth.Name()}},
-				Type:  typeToExpr(meth.Type()),
+				Type:  typeToExpr(cfg, meth.Type()),
 			})
 		}
 		return &ast.InterfaceType{
@@ -95,8 +121,8 @@ func typeToExpr(t types.Type) ast.Expr {
 
 	case *types.Map:
 		return &ast.MapType{
-			Key:   typeToExpr(t.Key()),
-			Value: typeToExpr(t.Elem()),
+			Key:   typeToExpr(cfg, t.Key()),
+			Value: typeToExpr(cfg, t.Elem()),
 		}
 
 	case *types.Chan:
@@ -105,53 +131,78 @@ func typeToExpr(t types.Type) ast.Expr {
 			types.SendOnly: ast.SEND,
 			types.RecvOnly: ast.RECV,
 		}
+		value := typeToExpr(cfg, t.Elem())
+		if elem, ok := t.Elem().(*types.Chan); ok && t.Dir() == types.SendRecv && elem.Dir() == types.RecvOnly {
+			// chan <-chan T would be chan<- chan T
+			value = &ast.ParenExpr{X: value}
+		}
 		return &ast.ChanType{
 			Dir:   dir[t.Dir()],
-			Value: typeToExpr(t.Elem()),
+			Value: value,
 		}
 
 	case *types.Named:
-		return &ast.Ident{
-			Name: t.Obj().Name(),
+		obj := t.Obj()
+		if !foreign(cfg, obj) {
+			return &ast.Ident{
+				Name: obj.Name(),
+			}
+		}
+		if !obj.Exported() {
+			return copyUnexported(cfg, obj, obj.Pos())
 		}
+		return selector(cfg, obj.Pkg(), obj.Name(), token.NoPos)
 
-	case *types.TypeParam:
-		return &ast.BadExpr{}
+	case *types.Instance:
+		return &ast.Ident{
+			Name: instInstance(cfg, t),
+		}
 
 	default:
-		return &ast.BadExpr{}
+		panic(fmt.Sprintf("typeToExpr: unexpected %T %s", t, t))
+	}
+}
+
+// tagLit returns a string literal of a struct tag, raw if possible, like `json:"x"`.
+func tagLit(tag string) string {
+	if strconv.CanBackquote(tag) {
+		return "`" + tag + "`"
 	}
+	return strconv.Quote(tag)
 }
 
-func writeType(w io.Writer, t types.Type) {
+func writeType(cfg *config, w io.Writer, t types.Type) {
 	switch t := t.(type) {
 	case nil:
 		fmt.Fprintf(w, "bad")
 
 	case *types.Basic:
+		if t.Kind() == types.UnsafePointer {
+			fmt.Fprintf(w, "unsafe_")
+		}
 		fmt.Fprintf(w, "%s", t.Name())
 
 	case *types.Array:
 		fmt.Fprintf(w, "array_%d_", t.Len())
-		writeType(w, t.Elem())
+		writeType(cfg, w, t.Elem())
 
 	case *types.Slice:
 		fmt.Fprintf(w, "slice_")
-		writeType(w, t.Elem())
+		writeType(cfg, w, t.Elem())
 
 	case *types.Struct:
 		fmt.Fprint(w, "struct_")
 		for i := 0; i < t.NumFields(); i++ {
 			field := t.Field(i)
 			fmt.Fprintf(w, "%s_", field.Name())
-			writeType(w, field.Type())
+			writeType(cfg, w, field.Type())
 			fmt.Fprintf(w, "_")
 		}
 		fmt.Fprintf(w, "end")
 
 	case *types.Pointer:
 		fmt.Fprintf(w, "ptr_")
-		writeType(w, t.Elem())
+		writeType(cfg, w, t.Elem())
 
 	case *types.Tuple:
 		fmt.Fprintf(w, "bad")
@@ -164,13 +215,13 @@ func writeType(w io.Writer, t types.Type) {
 		fmt.Fprint(w, "func_")
 		for i := 0; i < t.Params().Len(); i++ {
 			param := t.Params().At(i)
-			writeType(w, param.Type())
+			writeType(cfg, w, param.Type())
 			fmt.Fprintf(w, "_")
 		}
 		fmt.Fprint(w, "to_")
 		for i := 0; i < t.Results().Len(); i++ {
 			result := t.Results().At(i)
-			writeType(w, result.Type())
+			writeType(cfg, w, result.Type())
 			fmt.Fprintf(w, "_")
 		}
 		fmt.Fprintf(w, "end")
@@ -180,16 +231,16 @@ func writeType(w io.Writer, t types.Type) {
 		for i := 0; i < t.NumMethods(); i++ {
 			meth := t.Method(i)
 			fmt.Fprintf(w, "%s_", meth.Name())
-			writeType(w, meth.Type())
+			writeType(cfg, w, meth.Type())
 			fmt.Fprintf(w, "_")
 		}
 		fmt.Fprintf(w, "end")
 
 	case *types.Map:
 		fmt.Fprintf(w, "map_")
-		writeType(w, t.Key())
+		writeType(cfg, w, t.Key())
 		fmt.Fprintf(w, "_")
-		writeType(w, t.Elem())
+		writeType(cfg, w, t.Elem())
 
 	case *types.Chan:
 		dir := map[types.ChanDir]string{
@@ -198,11 +249,18 @@ func writeType(w io.Writer, t types.Type) {
 			types.RecvOnly: "recv",
 		}
 		fmt.Fprintf(w, "chan_%s_", dir[t.Dir()])
-		writeType(w, t.Elem())
+		writeType(cfg, w, t.Elem())
 
 	case *types.Named:
+		if foreign(cfg, t.Obj()) {
+			fmt.Fprintf(w, "%s_", mangledPath(t.Obj().Pkg().Path()))
+		}
 		fmt.Fprintf(w, "%s", t.Obj().Name())
 
+	case *types.Instance:
+		src, spec := instanceDecl(cfg, t)
+		fmt.Fprintf(w, "%s", instName(cfg.forDecl(src, spec), spec.Name, t.Mapping()))
+
 	case *types.TypeParam:
 		fmt.Fprintf(w, "bad")
 
@@ -210,3 +268,19 @@ func writeType(w io.Writer, t types.Type) {
 		fmt.Fprintf(w, "bad")
 	}
 }
+
+// foreign reports whether obj is declared in another package than the one being translated.
+func foreign(cfg *config, obj types.Object) bool {
+	return obj.Pkg() != nil && obj.Pkg().Path() != cfg.pkg.Path()
+}
+
+// mangledPath turns an import path into a part of an identifier, e.g. "golang.org/x/text"
+// into "golang_org_x_text".
+func mangledPath(path string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, path)
+}
@@ -0,0 +1,173 @@
+package degen
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/parser"
+	"github.com/faiface/generics/go/printer"
+	"github.com/faiface/generics/go/scanner"
+	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
+)
+
+const roundTripDecls = `package p
+
+import "unsafe"
+
+type Num int
+
+type Inner struct{ X int }
+
+type Reader interface{ Read([]byte) (int, error) }
+
+type Closer interface{ Close() error }
+
+var _ unsafe.Pointer
+`
+
+// TestTypeToExprRoundTrip converts random types to expressions, prints them, and checks that
+// the printed expressions denote identical types.
+func TestTypeToExprRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	var src strings.Builder
+	src.WriteString(roundTripDecls)
+	const n = 500
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&src, "var v%d %s\n", i, randomType(r, 3))
+	}
+
+	fset := token.NewFileSet()
+	pkg, info, files := checkRoundTrip(t, fset, src.String())
+
+	var errors scanner.ErrorList
+	out := new(ast.File)
+	cfg := &config{
+		fset:    fset,
+		info:    info,
+		pkg:     pkg,
+		src:     newSource(pkg, files, info),
+		errors:  &errors,
+		output:  out,
+		imports: map[*ast.File]map[string]string{out: make(map[string]string)},
+	}
+	var printed []string
+	for i := 0; i < n; i++ {
+		var b strings.Builder
+		typ := pkg.Scope().Lookup(fmt.Sprintf("v%d", i)).Type()
+		printer.Fprint(&b, fset, typeToExpr(cfg, typ))
+		printed = append(printed, b.String())
+		fmt.Fprintf(&src, "var w%d %s\n", i, b.String())
+	}
+
+	pkg, _, _ = checkRoundTrip(t, fset, src.String())
+	for i := 0; i < n; i++ {
+		orig := pkg.Scope().Lookup(fmt.Sprintf("v%d", i)).Type()
+		conv := pkg.Scope().Lookup(fmt.Sprintf("w%d", i)).Type()
+		if !types.Identical(orig, conv) {
+			t.Errorf("%s converted to %s", orig, printed[i])
+		}
+	}
+}
+
+func checkRoundTrip(t *testing.T, fset *token.FileSet, src string) (*types.Package, *types.Info, []*ast.File) {
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []*ast.File{file}
+	info := newInfo()
+	pkg, err := (&types.Config{Importer: unsafeImporter{}}).Check("p", fset, files, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg, info, files
+}
+
+// unsafeImporter imports only the unsafe package.
+type unsafeImporter struct{}
+
+func (unsafeImporter) Import(path string) (*types.Package, error) {
+	if path != "unsafe" {
+		return nil, fmt.Errorf("can't import %s", path)
+	}
+	return types.Unsafe, nil
+}
+
+// randomType returns the source of a random type, nested at most depth levels.
+func randomType(r *rand.Rand, depth int) string {
+	leaves := []string{"int", "string", "bool", "float64", "byte", "rune", "error", "Num", "Inner", "Reader", "unsafe.Pointer"}
+	if depth == 0 {
+		return leaves[r.Intn(len(leaves))]
+	}
+	elem := func() string { return randomType(r, depth-1) }
+
+	switch r.Intn(10) {
+	case 0:
+		return fmt.Sprintf("[%d]%s", r.Intn(4), elem())
+	case 1:
+		return "[]" + elem()
+	case 2:
+		return "*" + elem()
+	case 3:
+		keys := []string{"int", "string", "Num", "*Inner", "[2]int", "interface{}"}
+		return fmt.Sprintf("map[%s]%s", keys[r.Intn(len(keys))], elem())
+	case 4:
+		dirs := []string{"chan ", "chan<- ", "<-chan "}
+		return fmt.Sprintf("%s(%s)", dirs[r.Intn(len(dirs))], elem())
+	case 5:
+		return randomFunc(r, depth)
+	case 6:
+		var fields []string
+		for _, embedded := range []string{"Inner", "*Num", "Reader"} {
+			if r.Intn(4) == 0 {
+				fields = append(fields, embedded+randomTag(r))
+			}
+		}
+		for i := r.Intn(4); i > 0; i-- {
+			fields = append(fields, fmt.Sprintf("f%d %s%s", i, elem(), randomTag(r)))
+		}
+		return "struct{" + strings.Join(fields, "; ") + "}"
+	case 7:
+		var methods []string
+		for _, embedded := range []string{"Reader", "Closer", "error"} {
+			if r.Intn(3) == 0 {
+				methods = append(methods, embedded)
+			}
+		}
+		for i := r.Intn(3); i > 0; i-- {
+			methods = append(methods, fmt.Sprintf("M%d%s", i, strings.TrimPrefix(randomFunc(r, depth), "func")))
+		}
+		return "interface{" + strings.Join(methods, "; ") + "}"
+	default:
+		return elem()
+	}
+}
+
+func randomFunc(r *rand.Rand, depth int) string {
+	named := r.Intn(2) == 0
+	list := func(prefix string, n int, variadic bool) string {
+		var fields []string
+		for i := 0; i < n; i++ {
+			typ := randomType(r, depth-1)
+			if variadic && i == n-1 {
+				typ = "..." + typ
+			}
+			if named {
+				typ = fmt.Sprintf("%s%d %s", prefix, i, typ)
+			}
+			fields = append(fields, typ)
+		}
+		return "(" + strings.Join(fields, ", ") + ")"
+	}
+	return "func" + list("a", r.Intn(4), r.Intn(3) == 0) + list("r", r.Intn(3), false)
+}
+
+func randomTag(r *rand.Rand) string {
+	tags := []string{"", "", "`json:\"x\"`", "\"a`b\"", "`\\n`"}
+	return " " + tags[r.Intn(len(tags))]
+}
@@ -2,496 +2,589 @@ package degen
 
 import (
 	"github.com/faiface/generics/go/ast"
-	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
 )
 
-func degenTypeSpec(cfg *config, spec *ast.TypeSpec) bool {
-	if len(spec.Params) > 0 {
-		panic("cannot degenerate a generic type")
+// degenGenDecl degenerates a type, var, or const declaration at package level. Generic type
+// specs are kept as they are.
+func degenGenDecl(cfg *config, decl *ast.GenDecl) {
+	var degenSpecs []ast.Spec
+	for _, spec := range decl.Specs {
+		if spec, ok := spec.(*ast.TypeSpec); ok && len(spec.Params) > 0 {
+			degenSpecs = append(degenSpecs, spec)
+			continue
+		}
+		degenSpec := degenNode(cfg, spec)
+		degenSpecs = append(degenSpecs, degenSpec.(ast.Spec))
 	}
 
-	typ, changedTyp := degenNode(cfg, spec.Type)
-
 	cfg.output.Decls = append(cfg.output.Decls, &ast.GenDecl{
-		Tok: token.TYPE,
-		Specs: []ast.Spec{&ast.TypeSpec{
-			Name:   spec.Name,
-			Assign: spec.Assign,
-			Type:   typ.(ast.Expr),
-		}},
+		Doc:    decl.Doc,
+		TokPos: decl.TokPos,
+		Tok:    decl.Tok,
+		Lparen: decl.Lparen,
+		Specs:  degenSpecs,
+		Rparen: decl.Rparen,
 	})
-
-	return changedTyp
 }
 
-func degenFuncDecl(cfg *config, fdecl *ast.FuncDecl) bool {
-	if len(fdecl.TypeParams) > 0 {
+func degenFuncDecl(cfg *config, fdecl *ast.FuncDecl) {
+	if len(fdecl.TypeParams) > 0 || len(fdecl.ConstParams) > 0 {
 		panic("cannot degenerate a generic function")
 	}
 
-	recv, changedRecv := degenNode(cfg, fdecl.Recv)
-	typ, changedType := degenNode(cfg, fdecl.Type)
-	body, changedBody := degenNode(cfg, fdecl.Body)
+	recv := degenNode(cfg, fdecl.Recv)
+	typ := degenNode(cfg, fdecl.Type)
+	body := degenNode(cfg, fdecl.Body)
 
 	cfg.output.Decls = append(cfg.output.Decls, &ast.FuncDecl{
+		Doc:  fdecl.Doc,
 		Recv: recv.(*ast.FieldList),
 		Name: fdecl.Name,
 		Type: typ.(*ast.FuncType),
 		Body: body.(*ast.BlockStmt),
 	})
+}
 
-	return changedBody || changedRecv || changedType
+// genericDecl finds the declaration of the generic function or type referred to by expr, along
+// with the package that declares it.
+func genericDecl(cfg *config, expr ast.Expr) (*source, ast.Node) {
+	var ident *ast.Ident
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		ident = expr
+	case *ast.SelectorExpr:
+		ident = expr.Sel
+	case *ast.ParenExpr:
+		return genericDecl(cfg, expr.X)
+	}
+	obj := cfg.info.Uses[ident]
+	if obj == nil {
+		cfg.errorf(expr.Pos(), "cannot instantiate %s: generic functions and types must be referred to by name", types.ExprString(expr))
+	}
+	src := cfg.sources[obj.Pkg()]
+	if src == nil || src.decls[obj] == nil {
+		cfg.errorf(expr.Pos(), "cannot instantiate %s: source of package %s is not available", obj.Name(), obj.Pkg().Path())
+	}
+	return src, src.decls[obj]
 }
 
-func degenStmtList(cfg *config, stmts []ast.Stmt) ([]ast.Stmt, bool) {
+func degenStmtList(cfg *config, stmts []ast.Stmt) []ast.Stmt {
 	var degenStmts []ast.Stmt
-	changed := false
 	for _, stmt := range stmts {
-		degenStmt, didChange := degenNode(cfg, stmt)
+		degenStmt := degenNode(cfg, stmt)
 		degenStmts = append(degenStmts, degenStmt.(ast.Stmt))
-		changed = changed || didChange
 	}
-	return degenStmts, changed
+	return degenStmts
 }
 
-func degenExprList(cfg *config, exprs []ast.Expr) ([]ast.Expr, bool) {
+func degenExprList(cfg *config, exprs []ast.Expr) []ast.Expr {
 	var degenExprs []ast.Expr
-	changed := false
 	for _, expr := range exprs {
-		degenExpr, changedExpr := degenNode(cfg, expr)
+		degenExpr := degenNode(cfg, expr)
 		degenExprs = append(degenExprs, degenExpr.(ast.Expr))
-		changed = changed || changedExpr
 	}
-	return degenExprs, changed
+	return degenExprs
 }
 
-func degenNode(cfg *config, node ast.Node) (ast.Node, bool) {
+func degenNode(cfg *config, node ast.Node) ast.Node {
 	switch node := node.(type) {
 	default:
-		return node, false
+		return node
 	case
-		*ast.CommentGroup, *ast.BadExpr, *ast.Ident, *ast.BasicLit,
+		*ast.CommentGroup, *ast.BadExpr, *ast.BasicLit,
 		*ast.BadStmt, *ast.EmptyStmt,
 		*ast.BranchStmt, *ast.ImportSpec, *ast.BadDecl:
-		return node, false
+		return node
+
+	case *ast.Ident:
+		if name := embeddedName(cfg, nil, cfg.info.Uses[node]); name != "" {
+			return &ast.Ident{NamePos: node.NamePos, Name: name}
+		}
+		return node
 
 	case *ast.Field:
-		degenType, changedType := degenNode(cfg, node.Type)
+		degenType := degenNode(cfg, node.Type)
 		return &ast.Field{
-			Names: node.Names,
-			Type:  degenType.(ast.Expr),
-			Tag:   node.Tag,
-		}, changedType
+			Doc:     node.Doc,
+			Names:   node.Names,
+			Type:    degenType.(ast.Expr),
+			Tag:     node.Tag,
+			Comment: node.Comment,
+		}
 
 	case *ast.FieldList:
 		if node == nil {
-			return (*ast.FieldList)(nil), false
+			return (*ast.FieldList)(nil)
 		}
 		var degenList []*ast.Field
-		changed := false
 		for _, f := range node.List {
-			degenF, changedF := degenNode(cfg, f)
+			degenF := degenNode(cfg, f)
 			degenList = append(degenList, degenF.(*ast.Field))
-			changed = changed || changedF
 		}
 		return &ast.FieldList{
-			List: degenList,
-		}, changed
+			Opening: node.Opening,
+			List:    degenList,
+			Closing: node.Closing,
+		}
 
 	case *ast.SelectorExpr:
-		degenX, changedX := degenNode(cfg, node.X)
+		var (
+			degenX   = degenNode(cfg, node.X)
+			degenSel = degenNode(cfg, node.Sel)
+		)
 		return &ast.SelectorExpr{
 			X:   degenX.(ast.Expr),
-			Sel: node.Sel,
-		}, changedX
+			Sel: degenSel.(*ast.Ident),
+		}
 
 	case *ast.Ellipsis:
-		degenExpr, changedExpr := degenNode(cfg, node.Elt)
+		degenExpr := degenNode(cfg, node.Elt)
 		return &ast.Ellipsis{
-			Elt: degenExpr.(ast.Expr),
-		}, changedExpr
+			Ellipsis: node.Ellipsis,
+			Elt:      degenExpr.(ast.Expr),
+		}
 
 	case *ast.FuncLit:
 		var (
-			degenType, changedType = degenNode(cfg, node.Type)
-			degenBody, changedBody = degenNode(cfg, node.Body)
+			degenType = degenNode(cfg, node.Type)
+			degenBody = degenNode(cfg, node.Body)
 		)
 		return &ast.FuncLit{
 			Type: degenType.(*ast.FuncType),
 			Body: degenBody.(*ast.BlockStmt),
-		}, changedType || changedBody
+		}
 
 	case *ast.CompositeLit:
 		var (
-			degenType, changedType = degenNode(cfg, node.Type)
-			degenElts, changedElts = degenExprList(cfg, node.Elts)
+			degenType = degenNode(cfg, node.Type)
+			degenElts = degenExprList(cfg, node.Elts)
 		)
 		return &ast.CompositeLit{
-			Type: maybeNil(degenType),
-			Elts: degenElts,
-		}, changedType || changedElts
+			Type:   maybeNil(degenType),
+			Lbrace: node.Lbrace,
+			Elts:   degenElts,
+			Rbrace: node.Rbrace,
+		}
 
 	case *ast.ParenExpr:
-		degenX, changed := degenNode(cfg, node.X)
+		degenX := degenNode(cfg, node.X)
 		return &ast.ParenExpr{
-			X: degenX.(ast.Expr),
-		}, changed
+			Lparen: node.Lparen,
+			X:      degenX.(ast.Expr),
+			Rparen: node.Rparen,
+		}
 
 	case *ast.IndexExpr:
 		var (
-			degenX, changedX         = degenNode(cfg, node.X)
-			degenIndex, changedIndex = degenNode(cfg, node.Index)
+			degenX     = degenNode(cfg, node.X)
+			degenIndex = degenNode(cfg, node.Index)
 		)
 		return &ast.IndexExpr{
-			X:     degenX.(ast.Expr),
-			Index: degenIndex.(ast.Expr),
-		}, changedX || changedIndex
+			X:      degenX.(ast.Expr),
+			Lbrack: node.Lbrack,
+			Index:  degenIndex.(ast.Expr),
+			Rbrack: node.Rbrack,
+		}
 
 	case *ast.SliceExpr:
 		var (
-			degenX, changedX       = degenNode(cfg, node.X)
-			degenLow, changedLow   = degenNode(cfg, node.Low)
-			degenHigh, changedHigh = degenNode(cfg, node.High)
-			degenMax, changedMax   = degenNode(cfg, node.Max)
+			degenX    = degenNode(cfg, node.X)
+			degenLow  = degenNode(cfg, node.Low)
+			degenHigh = degenNode(cfg, node.High)
+			degenMax  = degenNode(cfg, node.Max)
 		)
 		return &ast.SliceExpr{
 			X:      degenX.(ast.Expr),
+			Lbrack: node.Lbrack,
 			Low:    maybeNil(degenLow),
 			High:   maybeNil(degenHigh),
 			Max:    maybeNil(degenMax),
 			Slice3: node.Slice3,
-		}, changedX || changedLow || changedHigh || changedMax
+			Rbrack: node.Rbrack,
+		}
 
 	case *ast.TypeAssertExpr:
 		var (
-			degenX, changedX       = degenNode(cfg, node.X)
-			degenType, changedType = degenNode(cfg, node.Type)
+			degenX    = degenNode(cfg, node.X)
+			degenType = degenNode(cfg, node.Type)
 		)
 		return &ast.TypeAssertExpr{
-			X:    degenX.(ast.Expr),
-			Type: degenType.(ast.Expr),
-		}, changedX || changedType
+			X:      degenX.(ast.Expr),
+			Lparen: node.Lparen,
+			Type:   degenType.(ast.Expr),
+			Rparen: node.Rparen,
+		}
 
 	case *ast.CallExpr:
 		var (
-			degenFun, changedFun   = degenNode(cfg, node.Fun)
-			degenArgs, changedArgs = degenExprList(cfg, node.Args)
+			degenFun  = degenNode(cfg, node.Fun)
+			degenArgs = degenExprList(cfg, node.Args)
 		)
 
 		genericInstance, isInstance := cfg.info.GenericInstances[node]
 		if isInstance {
-			typeSpec := degenFun.(*ast.Ident).Obj.Decl.(*ast.TypeSpec)
-			instName := instTypeSpec(cfg, genericInstance, typeSpec, node)
+			src, decl := genericDecl(cfg, degenFun.(ast.Expr))
+			typeSpec := decl.(*ast.TypeSpec)
+			instName := instTypeSpec(cfg.forDecl(src, typeSpec), genericInstance, typeSpec, cfg.info.TypeOf(node), node.Pos())
+			cfg.instantiatePending()
 			return &ast.Ident{
-				Name: instName,
-			}, true
+				NamePos: node.Pos(),
+				Name:    instName,
+			}
 		}
 
 		genericCall, isCall := cfg.info.GenericCalls[node]
 		if isCall {
-			funcDecl := degenFun.(*ast.Ident).Obj.Decl.(*ast.FuncDecl)
-			instName := instFuncDecl(cfg, genericCall, funcDecl)
+			src, decl := genericDecl(cfg, degenFun.(ast.Expr))
+			funcDecl := decl.(*ast.FuncDecl)
+			instName := instFuncDecl(cfg.forDecl(src, funcDecl), genericCall, funcDecl, node.Pos())
+			cfg.instantiatePending()
 			return &ast.CallExpr{
-				Fun:      &ast.Ident{Name: instName},
+				Fun:      &ast.Ident{NamePos: node.Fun.Pos(), Name: instName},
+				Lparen:   node.Lparen,
 				Args:     degenArgs[genericCall.NumUnnamed:],
 				Ellipsis: node.Ellipsis,
-			}, true
+				Rparen:   node.Rparen,
+			}
 		}
 
 		return &ast.CallExpr{
 			Fun:      degenFun.(ast.Expr),
+			Lparen:   node.Lparen,
 			Args:     degenArgs,
 			Ellipsis: node.Ellipsis,
-		}, changedFun || changedArgs
+			Rparen:   node.Rparen,
+		}
 
 	case *ast.StarExpr:
-		degenX, changedX := degenNode(cfg, node.X)
+		degenX := degenNode(cfg, node.X)
 		return &ast.StarExpr{
-			X: degenX.(ast.Expr),
-		}, changedX
+			Star: node.Star,
+			X:    degenX.(ast.Expr),
+		}
 
 	case *ast.UnaryExpr:
-		degenX, changedX := degenNode(cfg, node.X)
+		degenX := degenNode(cfg, node.X)
 		return &ast.UnaryExpr{
-			Op: node.Op,
-			X:  degenX.(ast.Expr),
-		}, changedX
+			OpPos: node.OpPos,
+			Op:    node.Op,
+			X:     degenX.(ast.Expr),
+		}
 
 	case *ast.BinaryExpr:
 		var (
-			degenX, changedX = degenNode(cfg, node.X)
-			degenY, changedY = degenNode(cfg, node.Y)
+			degenX = degenNode(cfg, node.X)
+			degenY = degenNode(cfg, node.Y)
 		)
 		return &ast.BinaryExpr{
-			X:  degenX.(ast.Expr),
-			Op: node.Op,
-			Y:  degenY.(ast.Expr),
-		}, changedX || changedY
+			X:     degenX.(ast.Expr),
+			OpPos: node.OpPos,
+			Op:    node.Op,
+			Y:     degenY.(ast.Expr),
+		}
 
 	case *ast.KeyValueExpr:
 		var (
-			degenKey, changedKey     = degenNode(cfg, node.Key)
-			degenValue, changedValue = degenNode(cfg, node.Value)
+			degenKey   = degenNode(cfg, node.Key)
+			degenValue = degenNode(cfg, node.Value)
 		)
 		return &ast.KeyValueExpr{
 			Key:   degenKey.(ast.Expr),
+			Colon: node.Colon,
 			Value: degenValue.(ast.Expr),
-		}, changedKey || changedValue
+		}
 
 	case *ast.ArrayType:
 		var (
-			degenLen, changedLen = degenNode(cfg, node.Len)
-			degenElt, changedElt = degenNode(cfg, node.Elt)
+			degenLen = degenNode(cfg, node.Len)
+			degenElt = degenNode(cfg, node.Elt)
 		)
 		return &ast.ArrayType{
-			Len: maybeNil(degenLen),
-			Elt: degenElt.(ast.Expr),
-		}, changedLen || changedElt
+			Lbrack: node.Lbrack,
+			Len:    maybeNil(degenLen),
+			Elt:    degenElt.(ast.Expr),
+		}
 
 	case *ast.StructType:
-		degenFields, changedFields := degenNode(cfg, node.Fields)
+		degenFields := degenNode(cfg, node.Fields)
 		return &ast.StructType{
+			Struct:     node.Struct,
 			Fields:     degenFields.(*ast.FieldList),
 			Incomplete: node.Incomplete,
-		}, changedFields
+		}
 
 	case *ast.FuncType:
 		var (
-			degenParams, changedParams   = degenNode(cfg, node.Params)
-			degenResults, changedResults = degenNode(cfg, node.Results)
+			degenParams  = degenNode(cfg, node.Params)
+			degenResults = degenNode(cfg, node.Results)
 		)
 		return &ast.FuncType{
+			Func:    node.Func,
 			Params:  degenParams.(*ast.FieldList),
 			Results: degenResults.(*ast.FieldList),
-		}, changedParams || changedResults
+		}
 
 	case *ast.InterfaceType:
-		degenMethods, changedMethods := degenNode(cfg, node.Methods)
+		degenMethods := degenNode(cfg, node.Methods)
 		return &ast.InterfaceType{
+			Interface:  node.Interface,
 			Methods:    degenMethods.(*ast.FieldList),
 			Incomplete: node.Incomplete,
-		}, changedMethods
+		}
 
 	case *ast.MapType:
 		var (
-			degenKey, changedKey     = degenNode(cfg, node.Key)
-			degenValue, changedValue = degenNode(cfg, node.Value)
+			degenKey   = degenNode(cfg, node.Key)
+			degenValue = degenNode(cfg, node.Value)
 		)
 		return &ast.MapType{
+			Map:   node.Map,
 			Key:   degenKey.(ast.Expr),
 			Value: degenValue.(ast.Expr),
-		}, changedKey || changedValue
+		}
 
 	case *ast.ChanType:
-		degenValue, changedValue := degenNode(cfg, node.Value)
+		degenValue := degenNode(cfg, node.Value)
 		return &ast.ChanType{
+			Begin: node.Begin,
+			Arrow: node.Arrow,
 			Dir:   node.Dir,
 			Value: degenValue.(ast.Expr),
-		}, changedValue
+		}
 
 	case *ast.TypeParam:
-		panic("unexpected type parameter")
+		cfg.errorf(node.Pos(), "type parameters are only allowed in signatures of package-level functions and methods")
+		return node
+
+	case *ast.ConstParam:
+		cfg.errorf(node.Pos(), "generic array lengths are only allowed in signatures of package-level functions")
+		return node
 
 	case *ast.DeclStmt:
-		degenDecl, changedDecl := degenNode(cfg, node.Decl)
+		degenDecl := degenNode(cfg, node.Decl)
 		return &ast.DeclStmt{
 			Decl: degenDecl.(ast.Decl),
-		}, changedDecl
+		}
 
 	case *ast.LabeledStmt:
-		degenStmt, changedStmt := degenNode(cfg, node.Stmt)
+		degenStmt := degenNode(cfg, node.Stmt)
 		return &ast.LabeledStmt{
 			Label: node.Label,
+			Colon: node.Colon,
 			Stmt:  degenStmt.(ast.Stmt),
-		}, changedStmt
+		}
 
 	case *ast.ExprStmt:
-		degenX, changedX := degenNode(cfg, node.X)
+		degenX := degenNode(cfg, node.X)
 		return &ast.ExprStmt{
 			X: degenX.(ast.Expr),
-		}, changedX
+		}
 
 	case *ast.SendStmt:
 		var (
-			degenChan, changedChan   = degenNode(cfg, node.Chan)
-			degenValue, changedValue = degenNode(cfg, node.Value)
+			degenChan  = degenNode(cfg, node.Chan)
+			degenValue = degenNode(cfg, node.Value)
 		)
 		return &ast.SendStmt{
 			Chan:  degenChan.(ast.Expr),
+			Arrow: node.Arrow,
 			Value: degenValue.(ast.Expr),
-		}, changedChan || changedValue
+		}
 
 	case *ast.IncDecStmt:
-		degenX, changedX := degenNode(cfg, node.X)
+		degenX := degenNode(cfg, node.X)
 		return &ast.IncDecStmt{
-			X:   degenX.(ast.Expr),
-			Tok: node.Tok,
-		}, changedX
+			X:      degenX.(ast.Expr),
+			TokPos: node.TokPos,
+			Tok:    node.Tok,
+		}
 
 	case *ast.AssignStmt:
 		var (
-			degenLhs, changedLhs = degenExprList(cfg, node.Lhs)
-			degenRhs, changedRhs = degenExprList(cfg, node.Rhs)
+			degenLhs = degenExprList(cfg, node.Lhs)
+			degenRhs = degenExprList(cfg, node.Rhs)
 		)
 		return &ast.AssignStmt{
-			Lhs: degenLhs,
-			Tok: node.Tok,
-			Rhs: degenRhs,
-		}, changedLhs || changedRhs
+			Lhs:    degenLhs,
+			TokPos: node.TokPos,
+			Tok:    node.Tok,
+			Rhs:    degenRhs,
+		}
 
 	case *ast.GoStmt:
-		degenCall, changedCall := degenNode(cfg, node.Call)
+		degenCall := degenNode(cfg, node.Call)
 		return &ast.GoStmt{
+			Go:   node.Go,
 			Call: degenCall.(*ast.CallExpr),
-		}, changedCall
+		}
 
 	case *ast.DeferStmt:
-		degenCall, changedCall := degenNode(cfg, node.Call)
+		degenCall := degenNode(cfg, node.Call)
 		return &ast.DeferStmt{
-			Call: degenCall.(*ast.CallExpr),
-		}, changedCall
+			Defer: node.Defer,
+			Call:  degenCall.(*ast.CallExpr),
+		}
 
 	case *ast.ReturnStmt:
-		degenResults, changedResults := degenExprList(cfg, node.Results)
+		degenResults := degenExprList(cfg, node.Results)
 		return &ast.ReturnStmt{
+			Return:  node.Return,
 			Results: degenResults,
-		}, changedResults
+		}
 
 	case *ast.BlockStmt:
-		degenList, changedList := degenStmtList(cfg, node.List)
+		degenList := degenStmtList(cfg, node.List)
 		return &ast.BlockStmt{
-			List: degenList,
-		}, changedList
+			Lbrace: node.Lbrace,
+			List:   degenList,
+			Rbrace: node.Rbrace,
+		}
 
 	case *ast.IfStmt:
 		var (
-			degenInit, changedInit = degenNode(cfg, node.Init)
-			degenCond, changedCond = degenNode(cfg, node.Cond)
-			degenBody, changedBody = degenNode(cfg, node.Body)
-			degenElse, changedElse = degenNode(cfg, node.Else)
+			degenInit = degenNode(cfg, node.Init)
+			degenCond = degenNode(cfg, node.Cond)
+			degenBody = degenNode(cfg, node.Body)
+			degenElse = degenNode(cfg, node.Else)
 		)
 		return &ast.IfStmt{
+			If:   node.If,
 			Init: maybeNilStmt(degenInit),
 			Cond: degenCond.(ast.Expr),
 			Body: degenBody.(*ast.BlockStmt),
 			Else: maybeNilStmt(degenElse),
-		}, changedInit || changedCond || changedBody || changedElse
+		}
 
 	case *ast.CaseClause:
 		var (
-			degenList, changedList = degenExprList(cfg, node.List)
-			degenBody, changedBody = degenStmtList(cfg, node.Body)
+			degenList = degenExprList(cfg, node.List)
+			degenBody = degenStmtList(cfg, node.Body)
 		)
 		return &ast.CaseClause{
-			List: degenList,
-			Body: degenBody,
-		}, changedList || changedBody
+			Case:  node.Case,
+			List:  degenList,
+			Colon: node.Colon,
+			Body:  degenBody,
+		}
 
 	case *ast.SwitchStmt:
 		var (
-			degenInit, changedInit = degenNode(cfg, node.Init)
-			degenTag, changedTag   = degenNode(cfg, node.Tag)
-			degenBody, changedBody = degenNode(cfg, node.Body)
+			degenInit = degenNode(cfg, node.Init)
+			degenTag  = degenNode(cfg, node.Tag)
+			degenBody = degenNode(cfg, node.Body)
 		)
 		return &ast.SwitchStmt{
-			Init: maybeNilStmt(degenInit),
-			Tag:  degenTag.(ast.Expr),
-			Body: degenBody.(*ast.BlockStmt),
-		}, changedInit || changedTag || changedBody
+			Switch: node.Switch,
+			Init:   maybeNilStmt(degenInit),
+			Tag:    degenTag.(ast.Expr),
+			Body:   degenBody.(*ast.BlockStmt),
+		}
 
 	case *ast.TypeSwitchStmt:
 		var (
-			degenInit, changedInit     = degenNode(cfg, node.Init)
-			degenAssign, changedAssign = degenNode(cfg, node.Assign)
-			degenBody, changedBody     = degenNode(cfg, node.Body)
+			degenInit   = degenNode(cfg, node.Init)
+			degenAssign = degenNode(cfg, node.Assign)
+			degenBody   = degenNode(cfg, node.Body)
 		)
 		return &ast.TypeSwitchStmt{
+			Switch: node.Switch,
 			Init:   maybeNilStmt(degenInit),
 			Assign: degenAssign.(ast.Stmt),
 			Body:   degenBody.(*ast.BlockStmt),
-		}, changedInit || changedAssign || changedBody
+		}
 
 	case *ast.CommClause:
 		var (
-			degenComm, changedComm = degenNode(cfg, node.Comm)
-			degenBody, changedBody = degenStmtList(cfg, node.Body)
+			degenComm = degenNode(cfg, node.Comm)
+			degenBody = degenStmtList(cfg, node.Body)
 		)
 		return &ast.CommClause{
-			Comm: degenComm.(ast.Stmt),
-			Body: degenBody,
-		}, changedComm || changedBody
+			Case:  node.Case,
+			Comm:  degenComm.(ast.Stmt),
+			Colon: node.Colon,
+			Body:  degenBody,
+		}
 
 	case *ast.SelectStmt:
-		degenBody, changedBody := degenNode(cfg, node.Body)
+		degenBody := degenNode(cfg, node.Body)
 		return &ast.SelectStmt{
-			Body: degenBody.(*ast.BlockStmt),
-		}, changedBody
+			Select: node.Select,
+			Body:   degenBody.(*ast.BlockStmt),
+		}
 
 	case *ast.ForStmt:
 		var (
-			degenInit, changedInit = degenNode(cfg, node.Init)
-			degenCond, changedCond = degenNode(cfg, node.Cond)
-			degenPost, changedPost = degenNode(cfg, node.Post)
-			degenBody, changedBody = degenNode(cfg, node.Body)
+			degenInit = degenNode(cfg, node.Init)
+			degenCond = degenNode(cfg, node.Cond)
+			degenPost = degenNode(cfg, node.Post)
+			degenBody = degenNode(cfg, node.Body)
 		)
 		return &ast.ForStmt{
+			For:  node.For,
 			Init: maybeNilStmt(degenInit),
 			Cond: maybeNil(degenCond),
 			Post: maybeNilStmt(degenPost),
 			Body: degenBody.(*ast.BlockStmt),
-		}, changedInit || changedCond || changedPost || changedBody
+		}
 
 	case *ast.RangeStmt:
 		var (
-			degenKey, changedKey     = degenNode(cfg, node.Key)
-			degenValue, changedValue = degenNode(cfg, node.Value)
-			degenX, changedX         = degenNode(cfg, node.X)
-			degenBody, changedBody   = degenNode(cfg, node.Body)
+			degenKey   = degenNode(cfg, node.Key)
+			degenValue = degenNode(cfg, node.Value)
+			degenX     = degenNode(cfg, node.X)
+			degenBody  = degenNode(cfg, node.Body)
 		)
 		return &ast.RangeStmt{
-			Key:   maybeNil(degenKey),
-			Value: maybeNil(degenValue),
-			Tok:   node.Tok,
-			X:     degenX.(ast.Expr),
-			Body:  degenBody.(*ast.BlockStmt),
-		}, changedKey || changedValue || changedX || changedBody
+			For:    node.For,
+			Key:    maybeNil(degenKey),
+			Value:  maybeNil(degenValue),
+			TokPos: node.TokPos,
+			Tok:    node.Tok,
+			X:      degenX.(ast.Expr),
+			Body:   degenBody.(*ast.BlockStmt),
+		}
 
 	case *ast.ValueSpec:
 		var (
-			degenType, changedType     = degenNode(cfg, node.Type)
-			degenValues, changedValues = degenExprList(cfg, node.Values)
+			degenType   = degenNode(cfg, node.Type)
+			degenValues = degenExprList(cfg, node.Values)
 		)
 		return &ast.ValueSpec{
-			Names:  node.Names,
-			Type:   maybeNil(degenType),
-			Values: degenValues,
-		}, changedType || changedValues
+			Doc:     node.Doc,
+			Names:   node.Names,
+			Type:    maybeNil(degenType),
+			Values:  degenValues,
+			Comment: node.Comment,
+		}
 
 	case *ast.TypeSpec:
 		if len(node.Params) != 0 {
-			panic("cannot degenerate a generic type")
+			cfg.errorf(node.Pos(), "generic types must be declared at package level")
 		}
-		degenType, changedType := degenNode(cfg, node.Type)
+		degenType := degenNode(cfg, node.Type)
 		return &ast.TypeSpec{
-			Name:   node.Name,
-			Assign: node.Assign,
-			Type:   degenType.(ast.Expr),
-		}, changedType
+			Doc:     node.Doc,
+			Name:    node.Name,
+			Assign:  node.Assign,
+			Type:    degenType.(ast.Expr),
+			Comment: node.Comment,
+		}
 
 	case *ast.GenDecl:
 		var degenSpecs []ast.Spec
-		changed := false
 		for _, spec := range node.Specs {
-			degenSpec, changedSpec := degenNode(cfg, spec)
+			degenSpec := degenNode(cfg, spec)
 			degenSpecs = append(degenSpecs, degenSpec.(ast.Spec))
-			changed = changed || changedSpec
 		}
 		return &ast.GenDecl{
+			Doc:    node.Doc,
+			TokPos: node.TokPos,
 			Tok:    node.Tok,
 			Lparen: node.Lparen,
 			Specs:  degenSpecs,
 			Rparen: node.Rparen,
-		}, changed
+		}
 
 	case *ast.FuncDecl:
 		panic("unexpected function declaration")
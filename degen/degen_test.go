@@ -0,0 +1,40 @@
+package degen_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/faiface/generics/degen"
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/parser"
+	"github.com/faiface/generics/go/token"
+)
+
+// BenchmarkExamples translates the generic source of each example, parsing included. Each
+// instance is instantiated and checked once, in memory, however deeply it's nested.
+func BenchmarkExamples(b *testing.B) {
+	dirs, err := filepath.Glob("../examples/*")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, dir := range dirs {
+		filename := filepath.Join(dir, filepath.Base(dir)+".go")
+
+		// the file set and the imported packages are shared by the iterations
+		fset := token.NewFileSet()
+		imp := degen.NewImporter(fset)
+
+		b.Run(filepath.Base(dir), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				file, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := degen.Translate(fset, []*ast.File{file}, degen.Options{Importer: imp}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,401 @@
+package degen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
+)
+
+// Mode is a scheme for translating generic functions.
+type Mode int
+
+const (
+	// Monomorphize copies the whole body of a generic function for each combination of type
+	// arguments it's used with.
+	Monomorphize Mode = iota
+
+	// Dictionary translates the body of a generic function once, into an implementation shared by
+	// all of its instances, which keeps values of types depending on the type parameters in
+	// interface{} variables. Each instance is a small function passing the shared implementation
+	// a dictionary, which does all the operations on such values for its type arguments. Generic
+	// types are still instantiated for each combination of type arguments, but their methods are
+	// shared too. Functions that can't be shared, like ones taking the address of a variable of a
+	// type depending on the type parameters, are monomorphized.
+	Dictionary
+
+	// Shape groups the instances of a generic function by the shapes of their type arguments,
+	// which have the same memory layout: all pointer types have the shape unsafe.Pointer, and
+	// named types have the shapes of their underlying types, like int64 for time.Duration. The
+	// function is monomorphized for the shapes only, and each instance is a small function
+	// converting its parameters to the shapes and the results back. Methods of generic types
+	// are shared the same way. Functions that convert values of types depending on the type
+	// parameters to interfaces are monomorphized, because the shapes would be visible.
+	Shape
+)
+
+// shared is the implementation of a generic function, or of a method of a generic type, shared by
+// all of its instances.
+type shared struct {
+	name     string                    // name of the shared function
+	dictType string                    // name of the interface of its dictionaries
+	params   map[*types.TypeParam]bool // type parameters of the generic function
+	ops      []*op                     // operations of the dictionaries, named op0, op1, ...
+}
+
+// op is an operation of a dictionary. The shared function passes it operands and gets results
+// back, as interface{} values if their types depend on the type parameters.
+type op struct {
+	params  []types.Type
+	results []types.Type
+
+	// body returns the statements of the operation in the dictionary of an instance. The operands
+	// are variables holding the parameters, asserted to their types in the instance.
+	body func(cfg *config, mapping map[*types.TypeParam]types.Type, operands []ast.Expr) []ast.Stmt
+}
+
+// dep reports whether t depends on the type parameters of the shared function.
+func (sh *shared) dep(t types.Type) bool {
+	return dependsOn(t, func(param *types.TypeParam) bool {
+		return sh.params[param]
+	})
+}
+
+// dependsOn reports whether t refers to any of the type parameters reported by param.
+func dependsOn(t types.Type, param func(*types.TypeParam) bool) bool {
+	switch t := t.(type) {
+	case *types.TypeParam:
+		return param(t)
+	case *types.Array:
+		return dependsOn(t.Elem(), param)
+	case *types.Slice:
+		return dependsOn(t.Elem(), param)
+	case *types.Pointer:
+		return dependsOn(t.Elem(), param)
+	case *types.Chan:
+		return dependsOn(t.Elem(), param)
+	case *types.Map:
+		return dependsOn(t.Key(), param) || dependsOn(t.Elem(), param)
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if dependsOn(t.Field(i).Type(), param) {
+				return true
+			}
+		}
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			if dependsOn(t.At(i).Type(), param) {
+				return true
+			}
+		}
+	case *types.Signature:
+		return dependsOn(t.Params(), param) || dependsOn(t.Results(), param)
+	case *types.Interface:
+		for i := 0; i < t.NumExplicitMethods(); i++ {
+			if dependsOn(t.ExplicitMethod(i).Type(), param) {
+				return true
+			}
+		}
+		for i := 0; i < t.NumEmbeddeds(); i++ {
+			if dependsOn(t.Embedded(i), param) {
+				return true
+			}
+		}
+	case *types.Instance:
+		for i := 0; i < t.NumArgs(); i++ {
+			if dependsOn(t.Arg(i), param) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sharedType returns the type of t in the shared function: interface{} if it depends on the type
+// parameters, t itself otherwise.
+func (sh *shared) sharedType(cfg *config, t types.Type) ast.Expr {
+	if sh.dep(t) {
+		return &ast.InterfaceType{Methods: &ast.FieldList{}}
+	}
+	return typeToExpr(cfg, t)
+}
+
+// opType returns the type of the method of an operation. Its parameters are named by names, or
+// left unnamed if names is nil.
+func (sh *shared) opType(cfg *config, o *op, names func(int) string) *ast.FuncType {
+	typ := &ast.FuncType{
+		Params:  &ast.FieldList{},
+		Results: &ast.FieldList{},
+	}
+	for i, t := range o.params {
+		field := &ast.Field{Type: sh.sharedType(cfg, t)}
+		if names != nil {
+			field.Names = []*ast.Ident{{Name: names(i)}}
+		}
+		typ.Params.List = append(typ.Params.List, field)
+	}
+	for _, t := range o.results {
+		typ.Results.List = append(typ.Results.List, &ast.Field{Type: sh.sharedType(cfg, t)})
+	}
+	return typ
+}
+
+// sharedDecl returns the shared implementation of a generic function, or of a method of a generic
+// type, emitting it along with the interface of its dictionaries the first time it's needed. It
+// returns nil if the function can't be shared. The type parameters of the function are the keys
+// of mapping.
+func sharedDecl(cfg *config, fdecl *ast.FuncDecl, mapping map[*types.TypeParam]types.Type) *shared {
+	if sh, ok := cfg.shared[fdecl]; ok {
+		return sh
+	}
+	cfg.shared[fdecl] = nil
+	if len(fdecl.ConstParams) > 0 {
+		return nil
+	}
+
+	sh := &shared{params: make(map[*types.TypeParam]bool)}
+	for param := range mapping {
+		sh.params[param] = true
+	}
+	decl, ok := shareFuncDecl(cfg, sh, fdecl)
+	if !ok {
+		return nil
+	}
+
+	var key, readable strings.Builder
+	fmt.Fprintf(&key, "%s.", cfg.src.pkg.Path())
+	if fdecl.Recv.NumFields() > 0 {
+		recv := recvNamed(cfg.info.Defs[fdecl.Name].Type().(*types.Signature).Recv().Type())
+		fmt.Fprintf(&key, "%s.", recv.Obj().Name())
+		writeDeclName(cfg, &readable, &ast.Ident{Name: recv.Obj().Name()})
+		fmt.Fprintf(&readable, "_%s", fdecl.Name.Name)
+	} else {
+		writeDeclName(cfg, &readable, fdecl.Name)
+	}
+	fmt.Fprintf(&key, "%s", fdecl.Name.Name)
+
+	sh.name = cfg.namer.unique("shared:"+key.String(), readable.String()+"_shared")
+	sh.dictType = cfg.namer.unique("dict:"+key.String(), readable.String()+"_dict")
+	decl.Name.Name = sh.name
+	decl.Type.Params.List[0].Type = &ast.Ident{Name: sh.dictType}
+
+	decl.Doc = copyDoc(cfg.src.docs[fdecl], fmt.Sprintf("// %s is shared by all instances of %s from %s", sh.name, fdecl.Name.Name, declLocation(cfg, fdecl)))
+
+	methods := &ast.FieldList{}
+	for i, o := range sh.ops {
+		methods.List = append(methods.List, &ast.Field{
+			Names: []*ast.Ident{{Name: fmt.Sprintf("op%d", i)}},
+			Type:  sh.opType(cfg, o, nil),
+		})
+	}
+	cfg.output.Decls = append(cfg.output.Decls, &ast.GenDecl{
+		Doc: &ast.CommentGroup{List: []*ast.Comment{{
+			Text: fmt.Sprintf("// %s does the operations of %s on values of types depending on its type parameters.", sh.dictType, sh.name),
+		}}},
+		Tok: token.TYPE,
+		Specs: []ast.Spec{&ast.TypeSpec{
+			Name: &ast.Ident{Name: sh.dictType},
+			Type: &ast.InterfaceType{Methods: methods},
+		}},
+	}, decl)
+
+	cfg.shared[fdecl] = sh
+	return sh
+}
+
+// recvNamed returns the generic type of a method receiver, like List in *List(T).
+func recvNamed(recv types.Type) *types.Named {
+	if ptr, ok := recv.(*types.Pointer); ok {
+		recv = ptr.Elem()
+	}
+	return recv.(*types.Instance).Named()
+}
+
+// emitSharedInstance emits an instance of a generic function, or of a method of a generic type,
+// which calls its shared implementation: a dictionary doing the operations for the type arguments
+// in mapping, and a function, or a method of recv, named name, which passes it to the shared
+// function along with its parameters.
+func emitSharedInstance(cfg *config, sh *shared, fdecl *ast.FuncDecl, mapping map[*types.TypeParam]types.Type, name string, recv ast.Expr) {
+	sig := cfg.info.Defs[fdecl.Name].Type().(*types.Signature)
+	instSig := types.MapType(mapping, sig).(*types.Signature)
+
+	key := name
+	if recv != nil {
+		if star, ok := recv.(*ast.StarExpr); ok {
+			key = star.X.(*ast.Ident).Name + "_" + name
+		} else {
+			key = recv.(*ast.Ident).Name + "_" + name
+		}
+	}
+	dictName := cfg.namer.unique("dict:"+cfg.src.pkg.Path()+"."+key, key+"_dict")
+
+	cfg.output.Decls = append(cfg.output.Decls, &ast.GenDecl{
+		Doc: &ast.CommentGroup{List: []*ast.Comment{{
+			Text: fmt.Sprintf("// %s does the operations of %s for %s.", dictName, sh.name, instArgs(cfg, mapping)),
+		}}},
+		Tok: token.TYPE,
+		Specs: []ast.Spec{&ast.TypeSpec{
+			Name: &ast.Ident{Name: dictName},
+			Type: &ast.StructType{Fields: &ast.FieldList{}},
+		}},
+	})
+
+	args, vars := localNames(cfg, "a"), localNames(cfg, "v")
+	for i, o := range sh.ops {
+		var (
+			body     []ast.Stmt
+			operands []ast.Expr
+		)
+		for j, t := range o.params {
+			if !sh.dep(t) {
+				operands = append(operands, &ast.Ident{Name: args(j)})
+				continue
+			}
+			body = append(body, assertTo(cfg, vars(j), &ast.Ident{Name: args(j)}, types.MapType(mapping, t)))
+			operands = append(operands, &ast.Ident{Name: vars(j)})
+		}
+		body = append(body, o.body(cfg, mapping, operands)...)
+
+		cfg.output.Decls = append(cfg.output.Decls, &ast.FuncDecl{
+			Recv: &ast.FieldList{List: []*ast.Field{{Type: &ast.Ident{Name: dictName}}}},
+			Name: &ast.Ident{Name: fmt.Sprintf("op%d", i)},
+			Type: sh.opType(cfg, o, args),
+			Body: &ast.BlockStmt{List: body},
+		})
+	}
+
+	// the instance passes the dictionary and its parameters to the shared function
+	params, results := localNames(cfg, "p"), localNames(cfg, "r")
+	call := &ast.CallExpr{
+		Fun:  &ast.Ident{Name: sh.name},
+		Args: []ast.Expr{&ast.CompositeLit{Type: &ast.Ident{Name: dictName}}},
+	}
+	var recvList *ast.FieldList
+	if recv != nil {
+		recvName := localName(cfg, "recv")
+		recvList = &ast.FieldList{List: []*ast.Field{{
+			Names: []*ast.Ident{{Name: recvName}},
+			Type:  recv,
+		}}}
+		call.Args = append(call.Args, &ast.Ident{Name: recvName})
+	}
+	paramList := &ast.FieldList{}
+	for i := 0; i < instSig.Params().Len(); i++ {
+		typ := typeToExpr(cfg, instSig.Params().At(i).Type())
+		if instSig.Variadic() && i == instSig.Params().Len()-1 {
+			typ = &ast.Ellipsis{Elt: typeToExpr(cfg, instSig.Params().At(i).Type().(*types.Slice).Elem())}
+			if !sh.dep(sig.Params().At(i).Type()) {
+				call.Ellipsis = fdecl.Type.Params.Closing
+			}
+		}
+		paramList.List = append(paramList.List, &ast.Field{
+			Names: []*ast.Ident{{Name: params(i)}},
+			Type:  typ,
+		})
+		call.Args = append(call.Args, &ast.Ident{Name: params(i)})
+	}
+	resultList := &ast.FieldList{}
+	for i := 0; i < instSig.Results().Len(); i++ {
+		resultList.List = append(resultList.List, &ast.Field{
+			Type: typeToExpr(cfg, instSig.Results().At(i).Type()),
+		})
+	}
+
+	var body []ast.Stmt
+	if instSig.Results().Len() == 0 {
+		body = []ast.Stmt{&ast.ExprStmt{X: call}}
+	} else {
+		assign := &ast.AssignStmt{Tok: token.DEFINE, Rhs: []ast.Expr{call}}
+		ret := &ast.ReturnStmt{}
+		body = append(body, assign)
+		for i := 0; i < instSig.Results().Len(); i++ {
+			assign.Lhs = append(assign.Lhs, &ast.Ident{Name: results(i)})
+			if !sh.dep(sig.Results().At(i).Type()) {
+				ret.Results = append(ret.Results, &ast.Ident{Name: results(i)})
+				continue
+			}
+			body = append(body, assertTo(cfg, vars(i), &ast.Ident{Name: results(i)}, instSig.Results().At(i).Type()))
+			ret.Results = append(ret.Results, &ast.Ident{Name: vars(i)})
+		}
+		body = append(body, ret)
+	}
+
+	cfg.output.Decls = append(cfg.output.Decls, &ast.FuncDecl{
+		Doc:  instDoc(cfg, fdecl, mapping),
+		Recv: recvList,
+		Name: &ast.Ident{Name: name},
+		Type: &ast.FuncType{Params: paramList, Results: resultList},
+		Body: &ast.BlockStmt{List: body},
+	})
+}
+
+// assertTo declares the variable v holding x, an interface{} value, asserted to t. Values of
+// interface types are asserted with v, _ := x.(t), because x may be nil.
+func assertTo(cfg *config, v string, x ast.Expr, t types.Type) ast.Stmt {
+	assign := &ast.AssignStmt{
+		Lhs: []ast.Expr{&ast.Ident{Name: v}},
+		Tok: token.DEFINE,
+		Rhs: []ast.Expr{&ast.TypeAssertExpr{X: x, Type: typeToExpr(cfg, t)}},
+	}
+	if _, ok := t.Underlying().(*types.Interface); ok {
+		assign.Lhs = append(assign.Lhs, &ast.Ident{Name: "_"})
+	}
+	return assign
+}
+
+// localNames returns a function naming local variables of generated code, like a0, a1, ...,
+// so that they don't shadow any package-level declaration or import of the output file.
+func localNames(cfg *config, base string) func(int) string {
+	shadows := func(name string) bool {
+		digits := strings.TrimPrefix(name, base)
+		if len(digits) == len(name) || digits == "" {
+			return false
+		}
+		for _, r := range digits {
+			if r < '0' || r > '9' {
+				return false
+			}
+		}
+		return true
+	}
+	for clash := true; clash; {
+		clash = false
+		for _, name := range append(cfg.pkg.Scope().Names(), importNames(cfg)...) {
+			if shadows(name) {
+				base += "_"
+				clash = true
+				break
+			}
+		}
+	}
+	return func(i int) string {
+		return base + strconv.Itoa(i)
+	}
+}
+
+// localName returns name, or name followed by underscores, so that it doesn't shadow any
+// package-level declaration or import of the output file.
+func localName(cfg *config, name string) string {
+	for clash := true; clash; {
+		clash = false
+		for _, other := range append(cfg.pkg.Scope().Names(), importNames(cfg)...) {
+			if other == name {
+				name += "_"
+				clash = true
+				break
+			}
+		}
+	}
+	return name
+}
+
+func importNames(cfg *config) []string {
+	var names []string
+	for _, name := range cfg.imports[cfg.output] {
+		names = append(names, name)
+	}
+	return names
+}
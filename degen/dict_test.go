@@ -0,0 +1,127 @@
+package degen_test
+
+import (
+	"testing"
+
+	"github.com/faiface/generics/degen"
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/types"
+)
+
+const dictSrc = `package main
+
+type Pair(type K eq, type V) struct {
+	Key   K
+	Value V
+}
+
+func Index(xs []type T eq, x T) int {
+	for i := range xs {
+		if xs[i] == x {
+			return i
+		}
+	}
+	return -1
+}
+
+func Lookup(ps []Pair(type K eq, type V), k K) (V, bool) {
+	for _, p := range ps {
+		if p.Key == k {
+			return p.Value, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+func main() {
+	println(Index([]int{1, 2}, 2), Index([]string{"a"}, "b"))
+	v, ok := Lookup([]Pair(string, int){{"a", 1}}, "a")
+	println(v, ok)
+}
+`
+
+// TestDictionaryLayout checks that each generic function is translated to one shared function
+// taking a dictionary, whose interface lists its operations, and that each instance passes a
+// dictionary doing all of them for its type arguments.
+func TestDictionaryLayout(t *testing.T) {
+	_, _, file, info := translateChecked(t, "dict", dictSrc, degen.Dictionary)
+	funcs := funcDecls(file)
+
+	dicts := map[string][]string{
+		"Index":  {"Index_int", "Index_string"},
+		"Lookup": {"Lookup_string_int"},
+	}
+	for generic, instances := range dicts {
+		shared := funcs[generic+"_shared"]
+		if shared == nil {
+			t.Errorf("no shared function %s_shared", generic)
+			continue
+		}
+		dict := shared.Type.Params.List[0]
+		if len(dict.Names) != 1 || dict.Names[0].Name != "dict" || types.ExprString(dict.Type) != generic+"_dict" {
+			t.Errorf("first parameter of %s_shared is %s, want dict %s_dict", generic, types.ExprString(dict.Type), generic)
+			continue
+		}
+		iface := info.TypeOf(dict.Type).Underlying().(*types.Interface)
+		if iface.NumMethods() == 0 {
+			t.Errorf("%s_dict has no operations", generic)
+		}
+
+		for _, inst := range instances {
+			fdecl := funcs[inst]
+			if fdecl == nil {
+				t.Errorf("no instance %s", inst)
+				continue
+			}
+			obj := info.Defs[fdecl.Name]
+			dictType := obj.Pkg().Scope().Lookup(inst + "_dict")
+			if dictType == nil {
+				t.Errorf("no dictionary %s_dict", inst)
+				continue
+			}
+			if methods := types.NewMethodSet(dictType.Type()); methods.Len() != iface.NumMethods() || !types.Implements(dictType.Type(), iface) {
+				t.Errorf("%s_dict has %d methods, want the %d operations of %s_dict", inst, methods.Len(), iface.NumMethods(), generic)
+			}
+
+			// the instance calls the shared function with its dictionary
+			call := onlyCall(fdecl.Body, generic+"_shared")
+			if call == nil {
+				t.Errorf("%s doesn't call %s_shared exactly once", inst, generic)
+				continue
+			}
+			if lit, ok := call.Args[0].(*ast.CompositeLit); !ok || types.ExprString(lit.Type) != inst+"_dict" {
+				t.Errorf("%s passes %s to %s_shared, want %s_dict{}", inst, types.ExprString(call.Args[0]), generic, inst)
+			}
+		}
+	}
+}
+
+// funcDecls returns the functions of a file by their names, methods left out.
+func funcDecls(file *ast.File) map[string]*ast.FuncDecl {
+	funcs := make(map[string]*ast.FuncDecl)
+	for _, decl := range file.Decls {
+		if fdecl, ok := decl.(*ast.FuncDecl); ok && fdecl.Recv == nil {
+			funcs[fdecl.Name.Name] = fdecl
+		}
+	}
+	return funcs
+}
+
+// onlyCall returns the call of the named function in node, or nil if it's called other than
+// exactly once.
+func onlyCall(node ast.Node, name string) *ast.CallExpr {
+	var calls []*ast.CallExpr
+	ast.Inspect(node, func(node ast.Node) bool {
+		if call, ok := node.(*ast.CallExpr); ok {
+			if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == name {
+				calls = append(calls, call)
+			}
+		}
+		return true
+	})
+	if len(calls) != 1 {
+		return nil
+	}
+	return calls[0]
+}
@@ -0,0 +1,91 @@
+package degen
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
+)
+
+// bailout aborts the translation of a declaration after an error has been recorded.
+type bailout struct{}
+
+// errorf records an error at pos and aborts the translation of the current declaration.
+func (cfg *config) errorf(pos token.Pos, format string, args ...interface{}) {
+	cfg.errors.Add(cfg.fset.Position(pos), fmt.Sprintf(format, args...))
+	panic(bailout{})
+}
+
+// catch runs translate, which translates the declaration at pos. An error aborting it is
+// already recorded, other panics are recorded as internal errors, so that the translation
+// continues with the next declaration.
+func (cfg *config) catch(pos token.Pos, translate func()) {
+	defer func() {
+		switch r := recover().(type) {
+		case nil, bailout:
+		default:
+			cfg.errors.Add(cfg.fset.Position(pos), fmt.Sprintf("internal error: %v", r))
+		}
+	}()
+	translate()
+}
+
+// instantiationError records an error about the chain of instances leading to inst, which is
+// either endless, or too long. The chain is shown with the positions of its instantiations.
+func instantiationError(inst *instance, reason string) {
+	var chain []*instance
+	for anc := inst; anc != nil; anc = anc.parent {
+		chain = append([]*instance{anc}, chain...)
+	}
+
+	var decls []string
+	for _, anc := range chain {
+		decls = append(decls, describe(anc))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s ...", reason, strings.Join(decls, " -> "))
+	for _, anc := range chain {
+		if anc.pos.IsValid() {
+			fmt.Fprintf(&b, "\n\t%s: %s", inst.cfg.fset.Position(anc.pos), describe(anc))
+		}
+	}
+	inst.cfg.errorf(inst.pos, "%s", b.String())
+}
+
+// describe returns the generic declaration of an instance along with its type arguments, like
+// F([]int).
+func describe(inst *instance) string {
+	var name string
+	switch decl := inst.decl.(type) {
+	case *ast.FuncDecl:
+		name = decl.Name.Name
+	case *ast.TypeSpec:
+		name = decl.Name.Name
+	}
+	if inst.cfg.src.pkg != inst.cfg.pkg {
+		name = inst.cfg.src.pkg.Name() + "." + name
+	}
+
+	var typeParams []*types.TypeParam
+	for param := range inst.mapping {
+		typeParams = append(typeParams, param)
+	}
+	sort.Slice(typeParams, func(i, j int) bool {
+		return paramLess(typeParams[i], typeParams[j])
+	})
+
+	var args []string
+	for _, param := range typeParams {
+		arg := types.TypeString(inst.mapping[param], types.RelativeTo(inst.cfg.pkg))
+		if param.Length() != nil {
+			arg = strconv.FormatInt(inst.mapping[param].(*types.Array).Len(), 10)
+		}
+		args = append(args, arg)
+	}
+	return name + "(" + strings.Join(args, ", ") + ")"
+}
@@ -0,0 +1,264 @@
+package degen
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/build"
+	"github.com/faiface/generics/go/parser"
+	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
+)
+
+// source is a type-checked package along with its syntax.
+type source struct {
+	pkg   *types.Package
+	files []*ast.File
+	info  *types.Info
+	decls map[types.Object]ast.Node      // package-level functions and type specs by their objects
+	docs  map[ast.Node]*ast.CommentGroup // doc comments of package-level functions and type specs
+}
+
+func newInfo() *types.Info {
+	return &types.Info{
+		Types:            make(map[ast.Expr]types.TypeAndValue),
+		Defs:             make(map[*ast.Ident]types.Object),
+		Uses:             make(map[*ast.Ident]types.Object),
+		Implicits:        make(map[ast.Node]types.Object),
+		Selections:       make(map[*ast.SelectorExpr]*types.Selection),
+		GenericCalls:     make(map[*ast.CallExpr]*types.GenericCall),
+		GenericInstances: make(map[*ast.CallExpr]*types.GenericInstance),
+	}
+}
+
+func newSource(pkg *types.Package, files []*ast.File, info *types.Info) *source {
+	src := &source{
+		pkg:   pkg,
+		files: files,
+		info:  info,
+		decls: make(map[types.Object]ast.Node),
+		docs:  make(map[ast.Node]*ast.CommentGroup),
+	}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv.NumFields() == 0 {
+					src.decls[info.Defs[decl.Name]] = decl
+				}
+				src.docs[decl] = decl.Doc
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						src.decls[info.Defs[spec.Name]] = spec
+						src.docs[spec] = spec.Doc
+						if !decl.Lparen.IsValid() {
+							src.docs[spec] = decl.Doc
+						}
+					}
+				}
+			}
+		}
+	}
+	return src
+}
+
+// ParsePackage parses all non-test .go files in the directory. The files must all belong to
+// the same package and are returned sorted by their file names.
+func ParsePackage(fset *token.FileSet, dir string) ([]*ast.File, error) {
+	pkgs, err := parser.ParseDir(
+		fset,
+		dir,
+		func(info os.FileInfo) bool {
+			if strings.HasSuffix(info.Name(), "_test.go") {
+				return false
+			}
+			match, err := build.Default.MatchFile(dir, info.Name())
+			return match || err != nil
+		},
+		parser.ParseComments|parser.DeclarationErrors,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		var names []string
+		for name := range pkgs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("%s: expected exactly one package, found %d %v", dir, len(pkgs), names)
+	}
+
+	var files []*ast.File
+	for _, pkg := range pkgs {
+		var filenames []string
+		for filename := range pkg.Files {
+			filenames = append(filenames, filename)
+		}
+		sort.Strings(filenames)
+		for _, filename := range filenames {
+			files = append(files, pkg.Files[filename])
+		}
+	}
+	return files, nil
+}
+
+// Importer imports packages for type-checking. All packages are type-checked from source, so
+// no export data is needed. Packages outside of GOROOT are kept along with their syntax, so that
+// the generic functions and types they declare can be instantiated in the importing package.
+type Importer struct {
+	fset     *token.FileSet
+	fallback types.Importer     // importer of standard library packages
+	sources  map[string]*source // packages type-checked from source by their directories
+	packages map[*types.Package]*source
+}
+
+// NewImporter returns a new Importer which records positions of the imported source files in
+// the file set. Standard library packages are type-checked from GOROOT by the go/types package of
+// the toolchain this program is built with, because they use Go's own type parameters, which the
+// fork doesn't parse. Their generic declarations are left out.
+func NewImporter(fset *token.FileSet) *Importer {
+	return newImporter(fset, newToolchainImporter("source"))
+}
+
+// NewGCImporter returns a new Importer like NewImporter, except that standard library packages
+// are imported from the export data of the gc compiler, which the go command builds if needed.
+func NewGCImporter(fset *token.FileSet) *Importer {
+	return newImporter(fset, newToolchainImporter("gc"))
+}
+
+func newImporter(fset *token.FileSet, fallback types.Importer) *Importer {
+	return &Importer{
+		fset:     fset,
+		fallback: fallback,
+		sources:  make(map[string]*source),
+		packages: make(map[*types.Package]*source),
+	}
+}
+
+// importing is a sentinel taking the place in Importer.sources for a package that is in the
+// process of being imported.
+var importing source
+
+// Import is a shortcut for ImportFrom(path, ".", 0).
+func (imp *Importer) Import(path string) (*types.Package, error) {
+	return imp.ImportFrom(path, ".", 0)
+}
+
+// ImportFrom imports the package with the given import path resolved from the directory srcDir.
+func (imp *Importer) ImportFrom(path, srcDir string, mode types.ImportMode) (*types.Package, error) {
+	dir, ok := sourceDir(path, srcDir)
+	if !ok {
+		if from, ok := imp.fallback.(types.ImporterFrom); ok {
+			return from.ImportFrom(path, srcDir, mode)
+		}
+		return imp.fallback.Import(path)
+	}
+
+	if src := imp.sources[dir]; src != nil {
+		if src == &importing {
+			return nil, fmt.Errorf("import cycle through package %q", path)
+		}
+		return src.pkg, nil
+	}
+
+	imp.sources[dir] = &importing
+	defer func() {
+		if imp.sources[dir] == &importing {
+			delete(imp.sources, dir)
+		}
+	}()
+
+	files, err := ParsePackage(imp.fset, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	typesCfg := &types.Config{
+		Importer: imp,
+	}
+	info := newInfo()
+	pkg, err := typesCfg.Check(path, imp.fset, files, info)
+	if err != nil {
+		return nil, fmt.Errorf("type-checking package %q failed (%v)", path, err)
+	}
+
+	src := newSource(pkg, files, info)
+	imp.sources[dir] = src
+	imp.packages[pkg] = src
+	return pkg, nil
+}
+
+// sourceDir resolves the directory of a package that should be imported from source.
+func sourceDir(path, srcDir string) (dir string, ok bool) {
+	if srcDir, err := filepath.Abs(srcDir); err == nil {
+		if build.IsLocalImport(path) {
+			return filepath.Join(srcDir, path), true
+		}
+		if root, modPath, ok := findModule(srcDir); ok {
+			if path == modPath {
+				return root, true
+			}
+			if strings.HasPrefix(path, modPath+"/") {
+				return filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(path, modPath+"/"))), true
+			}
+		}
+	}
+	bp, err := build.Default.Import(path, srcDir, build.FindOnly)
+	if err == nil && bp.Goroot {
+		return "", false
+	}
+	if dir, ok := moduleDir(path, srcDir); ok {
+		return dir, true
+	}
+	if err != nil {
+		return "", false
+	}
+	return bp.Dir, true
+}
+
+// moduleDir resolves the directory of a package from a dependency of the module containing
+// srcDir. That takes the go command, because the module cache is laid out by module versions.
+func moduleDir(path, srcDir string) (dir string, ok bool) {
+	if _, _, ok := findModule(srcDir); !ok {
+		return "", false
+	}
+	cmd := exec.Command("go", "list", "-find", "-f", "{{.Dir}}", "--", path)
+	cmd.Dir = srcDir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", false
+	}
+	dir = strings.TrimSpace(string(out))
+	return dir, dir != ""
+}
+
+// findModule finds the root directory and the path of the module containing dir.
+func findModule(dir string) (root, modPath string, ok bool) {
+	for {
+		if f, err := os.Open(filepath.Join(dir, "go.mod")); err == nil {
+			defer f.Close()
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				fields := strings.Fields(scanner.Text())
+				if len(fields) == 2 && fields[0] == "module" {
+					return dir, strings.Trim(fields[1], `"`), true
+				}
+			}
+			return "", "", false
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", false
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,101 @@
+package degen_test
+
+import (
+	gobuild "go/build"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/faiface/generics/degen"
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/parser"
+	"github.com/faiface/generics/go/printer"
+	"github.com/faiface/generics/go/token"
+)
+
+const importSrc = `package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+func Map(xs []type T, f func(T) type U) []U {
+	var ys []U
+	for _, x := range xs {
+		ys = append(ys, f(x))
+	}
+	return ys
+}
+
+func main() {
+	words := Map([]int{3, 1, 2}, func(n int) string { return strings.Repeat("x", n) })
+	sort.Strings(words)
+	fmt.Fprintln(os.Stdout, words, len(words))
+}
+`
+
+// TestImportStandardLibrary translates a program importing the standard library of the
+// toolchain with both importers.
+func TestImportStandardLibrary(t *testing.T) {
+	importers := map[string]func(*token.FileSet) *degen.Importer{
+		"source": degen.NewImporter,
+		"gc":     degen.NewGCImporter,
+	}
+	for name, newImporter := range importers {
+		t.Run(name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "main.go", importSrc, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := degen.Translate(fset, []*ast.File{file}, degen.Options{Importer: newImporter(fset)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var printed strings.Builder
+			printer.Fprint(&printed, fset, result.Files[0])
+			for _, want := range []string{`"fmt"`, "func Map_int_string(xs []int, f func(int) string) []string", "fmt.Fprintln(os.Stdout, words, len(words))"} {
+				if !strings.Contains(printed.String(), want) {
+					t.Errorf("translated file doesn't contain %q:\n%s", want, printed.String())
+				}
+			}
+		})
+	}
+}
+
+// TestParsePackageReleaseTags checks that ParsePackage selects files by the release tags of the
+// toolchain.
+func TestParsePackageReleaseTags(t *testing.T) {
+	tags := gobuild.Default.ReleaseTags
+	latest := tags[len(tags)-1]
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"new.go": "//go:build " + latest + "\n\npackage main\n\nfunc version() string { return \"new\" }\n",
+		"old.go": "//go:build !" + latest + "\n\npackage main\n\nfunc version() string { return \"old\" }\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fset := token.NewFileSet()
+	parsed, err := degen.ParsePackage(fset, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 1 || filepath.Base(fset.Position(parsed[0].Pos()).Filename) != "new.go" {
+		var names []string
+		for _, file := range parsed {
+			names = append(names, fset.Position(file.Pos()).Filename)
+		}
+		t.Errorf("parsed %v, want only new.go tagged %s", names, latest)
+	}
+}
@@ -2,7 +2,11 @@ package degen
 
 import (
 	"fmt"
+	"io"
+	"path"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/faiface/generics/go/ast"
@@ -10,118 +14,327 @@ import (
 	"github.com/faiface/generics/go/types"
 )
 
-func instTypeSpec(cfg *config, genInst *types.GenericInstance, spec *ast.TypeSpec, expr ast.Expr) string {
-	var b strings.Builder
-	fmt.Fprintf(&b, "%s", spec.Name)
+// instance is a generic declaration waiting in the worklist to be instantiated.
+type instance struct {
+	cfg        *config  // configuration for the package and the output file of the declaration
+	decl       ast.Node // generic *ast.FuncDecl or *ast.TypeSpec
+	name       string   // name of the instantiated declaration
+	mapping    map[*types.TypeParam]types.Type
+	numUnnamed int        // number of unnamed type parameters of a function
+	typ        types.Type // instantiated type of a type spec
 
-	var typeParams []*types.TypeParam
-	for param := range genInst.Mapping {
-		typeParams = append(typeParams, param)
+	parent *instance // instance whose code needs this one; nil if needed by non-generic code
+	pos    token.Pos // position of the generic call or instance needing this one
+	depth  int       // length of the chain of instances leading to this one, itself included
+
+	decls []ast.Decl // declarations emitted for the instance, methods of a type included
+}
+
+// enqueue adds a new instance to the worklist. It fails if the instance is part of a chain that
+// never ends, or if the chain exceeds the maximum depth.
+func (cfg *config) enqueue(inst *instance, pos token.Pos) {
+	instCfg := *cfg
+	instCfg.inst = inst
+	instCfg.replace = nil
+	inst.cfg = &instCfg
+
+	inst.parent, inst.pos, inst.depth = cfg.inst, pos, 1
+	if cfg.inst != nil {
+		inst.depth = cfg.inst.depth + 1
+	}
+	if growing(inst) {
+		instantiationError(inst, "endless instantiation, type arguments keep growing")
+	}
+	if cfg.maxDepth > 0 && inst.depth > cfg.maxDepth {
+		instantiationError(inst, fmt.Sprintf("instantiation deeper than %d", cfg.maxDepth))
 	}
 
-	sort.Slice(typeParams, func(i, j int) bool {
-		return typeParams[i].Name() < typeParams[j].Name()
-	})
+	*cfg.worklist = append(*cfg.worklist, inst)
+}
 
-	for _, param := range typeParams {
-		fmt.Fprintf(&b, "_")
-		writeType(&b, genInst.Mapping[param])
+// growing reports whether inst comes after two instances of the same declaration along its
+// chain, each with type arguments growing from the previous ones, like F(int) -> F([]int) ->
+// F([][]int), or F(int, string) -> F(string, []int) -> F([]int, []string) when the arguments
+// trade places. The code leading from one to the next keeps growing them, so the chain never
+// ends. All instances of the declaration along the chain are compared, not just the nearest
+// ones, because other calls may come between those that grow the arguments.
+func growing(inst *instance) bool {
+	var same []*instance
+	for anc := inst.parent; anc != nil; anc = anc.parent {
+		if anc.decl == inst.decl {
+			same = append(same, anc)
+		}
 	}
+	for i, near := range same {
+		if !grows(near.mapping, inst.mapping) {
+			continue
+		}
+		for _, far := range same[i+1:] {
+			if grows(far.mapping, near.mapping) {
+				return true
+			}
+		}
+	}
+	return false
+}
 
-	name := b.String()
+// grows reports whether each type argument in to is either identical to one of the type
+// arguments in from, or contains one of them, and the type arguments in to are larger in total.
+func grows(from, to map[*types.TypeParam]types.Type) bool {
+	fromSize, toSize := 0, 0
+	for _, typ := range from {
+		fromSize += typeSize(typ)
+	}
+	for _, typ := range to {
+		derived := false
+		for _, arg := range from {
+			if types.Identical(arg, typ) || containsType(typ, arg) {
+				derived = true
+				break
+			}
+		}
+		if !derived {
+			return false
+		}
+		toSize += typeSize(typ)
+	}
+	return toSize > fromSize
+}
+
+// typeSize returns the number of types making up typ, like 3 for map[string]int.
+func typeSize(typ types.Type) int {
+	size := 1
+	switch typ := typ.(type) {
+	case *types.Array:
+		size += typeSize(typ.Elem())
+	case *types.Slice:
+		size += typeSize(typ.Elem())
+	case *types.Pointer:
+		size += typeSize(typ.Elem())
+	case *types.Map:
+		size += typeSize(typ.Key()) + typeSize(typ.Elem())
+	case *types.Chan:
+		size += typeSize(typ.Elem())
+	case *types.Struct:
+		for i := 0; i < typ.NumFields(); i++ {
+			size += typeSize(typ.Field(i).Type())
+		}
+	case *types.Tuple:
+		for i := 0; i < typ.Len(); i++ {
+			size += typeSize(typ.At(i).Type())
+		}
+	case *types.Signature:
+		size += typeSize(typ.Params()) + typeSize(typ.Results())
+	case *types.Instance:
+		for i := 0; i < typ.NumArgs(); i++ {
+			size += typeSize(typ.Arg(i))
+		}
+	}
+	return size
+}
+
+// containsType reports whether sub is a proper part of typ, like int in map[string][]int.
+func containsType(typ, sub types.Type) bool {
+	var parts []types.Type
+	switch typ := typ.(type) {
+	case *types.Array:
+		parts = append(parts, typ.Elem())
+	case *types.Slice:
+		parts = append(parts, typ.Elem())
+	case *types.Pointer:
+		parts = append(parts, typ.Elem())
+	case *types.Map:
+		parts = append(parts, typ.Key(), typ.Elem())
+	case *types.Chan:
+		parts = append(parts, typ.Elem())
+	case *types.Struct:
+		for i := 0; i < typ.NumFields(); i++ {
+			parts = append(parts, typ.Field(i).Type())
+		}
+	case *types.Tuple:
+		for i := 0; i < typ.Len(); i++ {
+			parts = append(parts, typ.At(i).Type())
+		}
+	case *types.Signature:
+		parts = append(parts, typ.Params(), typ.Results())
+	case *types.Instance:
+		for i := 0; i < typ.NumArgs(); i++ {
+			parts = append(parts, typ.Arg(i))
+		}
+	}
+	for _, part := range parts {
+		if types.Identical(part, sub) || containsType(part, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// instantiatePending instantiates the declarations in the worklist, until it's empty.
+// Instantiating a declaration may add further declarations to the worklist.
+func (cfg *config) instantiatePending() {
+	for len(*cfg.worklist) > 0 {
+		inst := (*cfg.worklist)[0]
+		*cfg.worklist = (*cfg.worklist)[1:]
+
+		// methods of a type may be emitted into other files than the type
+		emitted := make([]int, len(cfg.outputs))
+		for i, file := range cfg.outputs {
+			emitted[i] = len(file.Decls)
+		}
+
+		inst.cfg.catch(inst.decl.Pos(), func() {
+			switch decl := inst.decl.(type) {
+			case *ast.TypeSpec:
+				emitTypeSpec(inst, decl)
+			case *ast.FuncDecl:
+				emitFuncDecl(inst, decl)
+			}
+		})
+
+		for i, file := range cfg.outputs {
+			inst.decls = append(inst.decls, file.Decls[emitted[i]:]...)
+		}
+		*cfg.instances = append(*cfg.instances, inst)
+	}
+}
+
+// instTypeSpec returns the name of the generic type spec instantiated with genInst, adding it
+// to the worklist if it's not instantiated yet. The instance is needed at pos.
+func instTypeSpec(cfg *config, genInst *types.GenericInstance, spec *ast.TypeSpec, typ types.Type, pos token.Pos) string {
+	name := instName(cfg, spec.Name, genInst.Mapping)
 
 	if cfg.instantiated[name] {
 		return name
 	}
 	cfg.instantiated[name] = true
 
+	cfg.enqueue(&instance{
+		decl:    spec,
+		name:    name,
+		mapping: genInst.Mapping,
+		typ:     typ,
+	}, pos)
+	return name
+}
+
+func emitTypeSpec(inst *instance, spec *ast.TypeSpec) {
+	cfg, name := inst.cfg, inst.name
+
 	result := &ast.TypeSpec{
 		Name:   &ast.Ident{Name: name},
 		Assign: spec.Assign,
-		Type:   instNode(cfg, genInst.Mapping, spec.Type).(ast.Expr),
+		Type:   instNode(cfg, inst.mapping, spec.Type).(ast.Expr),
 	}
 
 	cfg.output.Decls = append(cfg.output.Decls, &ast.GenDecl{
-		Tok:   token.TYPE,
-		Specs: []ast.Spec{result},
+		Doc:    instDoc(cfg, spec, inst.mapping),
+		TokPos: cfg.pos(spec.Pos()),
+		Tok:    token.TYPE,
+		Specs:  []ast.Spec{result},
 	})
 
 	// instantiate fitting associated methods
-	for _, decl := range cfg.input.Decls {
-		switch decl := decl.(type) {
-		case *ast.FuncDecl:
-			if len(decl.TypeParams) == 0 {
-				continue
-			}
-			if decl.Recv.NumFields() == 0 {
-				continue
+	for _, file := range cfg.src.files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv.NumFields() == 0 {
+					continue
+				}
+
+				obj := cfg.info.ObjectOf(decl.Name)
+				if len(inst.mapping) == 0 {
+					// a copy of an unexported type of another package takes all its methods
+					recv := obj.Type().(*types.Signature).Recv().Type()
+					if ptr, ok := recv.(*types.Pointer); ok {
+						recv = ptr.Elem()
+					}
+					if recv == inst.typ {
+						instMethodDecl(cfg, nil, name, decl)
+					}
+					continue
+				}
+				if len(decl.TypeParams) == 0 {
+					continue
+				}
+
+				method, index, _, mapping := types.LookupFieldOrMethod(inst.typ, true, obj.Pkg(), obj.Name())
+				if mapping == nil || method.Pos() != obj.Pos() || len(index) > 1 {
+					// doesn't fit, or a method of another type, like Push of Stack(int)
+					// found as the interface method of Pusher(int), or promoted from an
+					// embedded instance
+					continue
+				}
+
+				instMethodDecl(cfg, mapping, name, decl)
 			}
-
-			_, _, _, mapping := types.LookupFieldOrMethod(
-				cfg.info.TypeOf(expr),
-				true,
-				cfg.info.ObjectOf(decl.Name).Pkg(),
-				decl.Name.Name,
-			)
-			if mapping == nil {
-				continue
-			}
-
-			instMethodDecl(cfg, mapping, name, decl)
 		}
 	}
-
-	return name
 }
 
-func instFuncDecl(cfg *config, genCall *types.GenericCall, fdecl *ast.FuncDecl) string {
+// instFuncDecl returns the name of the generic function instantiated with genCall, adding it
+// to the worklist if it's not instantiated yet. The call is at pos.
+func instFuncDecl(cfg *config, genCall *types.GenericCall, fdecl *ast.FuncDecl, pos token.Pos) string {
 	name := fdecl.Name.Name
 
 	if fdecl.Recv.NumFields() == 0 {
-		var b strings.Builder
-		fmt.Fprintf(&b, "%s", fdecl.Name.Name)
+		name = instName(cfg, fdecl.Name, genCall.Mapping)
 
-		var typeParams []*types.TypeParam
-		for param := range genCall.Mapping {
-			typeParams = append(typeParams, param)
+		if cfg.instantiated[name] {
+			return name
 		}
+		cfg.instantiated[name] = true
+	}
 
-		sort.Slice(typeParams, func(i, j int) bool {
-			return typeParams[i].Name() < typeParams[j].Name()
-		})
-
-		for _, param := range typeParams {
-			fmt.Fprintf(&b, "_")
-			writeType(&b, genCall.Mapping[param])
-		}
+	cfg.enqueue(&instance{
+		decl:       fdecl,
+		name:       name,
+		mapping:    genCall.Mapping,
+		numUnnamed: genCall.NumUnnamed,
+	}, pos)
+	return name
+}
 
-		name = b.String()
+func emitFuncDecl(inst *instance, fdecl *ast.FuncDecl) {
+	cfg, name, mapping := inst.cfg, inst.name, inst.mapping
 
-		if cfg.instantiated[name] {
-			return name
+	if cfg.mode == Dictionary && fdecl.Recv.NumFields() == 0 && len(mapping) > 0 {
+		if sh := sharedDecl(cfg, fdecl, mapping); sh != nil {
+			emitSharedInstance(cfg, sh, fdecl, mapping, name, nil)
+			return
+		}
+	}
+	if cfg.mode == Shape && fdecl.Recv.NumFields() == 0 {
+		if shape, ok := shapeMapping(cfg, fdecl, mapping); ok {
+			emitShapeInstance(cfg, fdecl, mapping, shape, inst.numUnnamed, name, nil)
+			return
 		}
-		cfg.instantiated[name] = true
 	}
 
 	cfg.output.Decls = append(cfg.output.Decls, &ast.FuncDecl{
-		Recv: instNode(cfg, genCall.Mapping, fdecl.Recv).(*ast.FieldList),
-		Name: &ast.Ident{Name: name},
+		Doc:  instDoc(cfg, fdecl, mapping),
+		Recv: instNode(cfg, mapping, fdecl.Recv).(*ast.FieldList),
+		Name: &ast.Ident{NamePos: cfg.pos(fdecl.Name.NamePos), Name: name},
 		Type: &ast.FuncType{
+			Func: cfg.pos(fdecl.Type.Func),
 			Params: &ast.FieldList{
+				Opening: cfg.pos(fdecl.Type.Params.Opening),
 				List: instFieldList(
-					cfg, genCall.Mapping,
-					fdecl.Type.Params.List[genCall.NumUnnamed:],
+					cfg, mapping,
+					fdecl.Type.Params.List[inst.numUnnamed:],
 				),
+				Closing: cfg.pos(fdecl.Type.Params.Closing),
 			},
-			Results: instNode(cfg, genCall.Mapping, fdecl.Type.Results).(*ast.FieldList),
+			Results: instNode(cfg, mapping, fdecl.Type.Results).(*ast.FieldList),
 		},
-		Body: instNode(cfg, genCall.Mapping, fdecl.Body).(*ast.BlockStmt),
+		Body: instNode(cfg, mapping, fdecl.Body).(*ast.BlockStmt),
 	})
-
-	return name
 }
 
 func instMethodDecl(cfg *config, mapping map[*types.TypeParam]types.Type, recvName string, fdecl *ast.FuncDecl) {
+	cfg = cfg.forDecl(cfg.src, fdecl)
+
 	var recv ast.Expr = &ast.Ident{
 		Name: recvName,
 	}
@@ -131,26 +344,443 @@ func instMethodDecl(cfg *config, mapping map[*types.TypeParam]types.Type, recvNa
 		}
 	}
 
+	if cfg.mode == Dictionary && len(mapping) > 0 {
+		if sh := sharedDecl(cfg, fdecl, mapping); sh != nil {
+			emitSharedInstance(cfg, sh, fdecl, mapping, fdecl.Name.Name, recv)
+			return
+		}
+	}
+	if cfg.mode == Shape {
+		if shape, ok := shapeMapping(cfg, fdecl, mapping); ok {
+			emitShapeInstance(cfg, fdecl, mapping, shape, 0, fdecl.Name.Name, recv)
+			return
+		}
+	}
+
 	cfg.output.Decls = append(cfg.output.Decls, &ast.FuncDecl{
-		Recv: &ast.FieldList{List: []*ast.Field{
-			&ast.Field{
-				Names: fdecl.Recv.List[0].Names,
-				Type:  recv,
+		Doc: instDoc(cfg, fdecl, mapping),
+		Recv: &ast.FieldList{
+			Opening: cfg.pos(fdecl.Recv.Opening),
+			List: []*ast.Field{
+				&ast.Field{
+					Names: instIdents(cfg, fdecl.Recv.List[0].Names),
+					Type:  recv,
+				},
 			},
-		}},
-		Name: fdecl.Name,
+			Closing: cfg.pos(fdecl.Recv.Closing),
+		},
+		Name: instIdent(cfg, fdecl.Name),
 		Type: instNode(cfg, mapping, fdecl.Type).(*ast.FuncType),
 		Body: instNode(cfg, mapping, fdecl.Body).(*ast.BlockStmt),
 	})
 }
 
+// instInstance instantiates the generic type of an instance used as a type, e.g. List(int) in
+// []List(int), and returns the name of the instantiated type.
+func instInstance(cfg *config, inst *types.Instance) string {
+	src, spec := instanceDecl(cfg, inst)
+	genInst := &types.GenericInstance{Mapping: inst.Mapping()}
+	return instTypeSpec(cfg.forDecl(src, spec), genInst, spec, inst, token.NoPos)
+}
+
+// embeddedName returns the name of a field embedding an instance of a generic type, which is
+// named after the instantiated type in the output, like List_int for *List(T) with T=int. It
+// returns "" if obj isn't such a field.
+func embeddedName(cfg *config, mapping map[*types.TypeParam]types.Type, obj types.Object) string {
+	field, ok := obj.(*types.Var)
+	if !ok || !field.Anonymous() {
+		return ""
+	}
+	typ := types.MapType(mapping, field.Type())
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+	inst, ok := typ.(*types.Instance)
+	if !ok {
+		return ""
+	}
+	return instInstance(cfg, inst)
+}
+
+// instanceDecl finds the declaration of the generic type of an instance, along with the
+// package that declares it.
+func instanceDecl(cfg *config, inst *types.Instance) (*source, *ast.TypeSpec) {
+	obj := inst.Named().Obj()
+	src := cfg.sources[obj.Pkg()]
+	if src == nil || src.decls[obj] == nil {
+		cfg.errorf(token.NoPos, "cannot instantiate %s: source of package %s is not available", obj.Name(), obj.Pkg().Path())
+	}
+	return src, src.decls[obj].(*ast.TypeSpec)
+}
+
+// instName returns the name of a generic declaration instantiated with mapping.
+func instName(cfg *config, name *ast.Ident, mapping map[*types.TypeParam]types.Type) string {
+	var decl strings.Builder
+	writeDeclName(cfg, &decl, name)
+
+	var typeParams []*types.TypeParam
+	for param := range mapping {
+		typeParams = append(typeParams, param)
+	}
+
+	sort.Slice(typeParams, func(i, j int) bool {
+		return paramLess(typeParams[i], typeParams[j])
+	})
+
+	var (
+		readable strings.Builder
+		args     []types.Type
+	)
+	readable.WriteString(decl.String())
+	for _, param := range typeParams {
+		fmt.Fprintf(&readable, "_")
+		writeParam(cfg, &readable, param, mapping[param])
+		args = append(args, mapping[param])
+	}
+
+	key := instKey(cfg, name.Name, typeParams, args)
+	return cfg.namer.name(key, readable.String(), decl.String())
+}
+
+// composeMapping returns the mapping of a generic call or instance inside of generic code
+// instantiated with outer, so that it refers to the concrete types of the instantiation.
+func composeMapping(outer, inner map[*types.TypeParam]types.Type) map[*types.TypeParam]types.Type {
+	composed := make(map[*types.TypeParam]types.Type)
+	for param, typ := range inner {
+		composed[param] = types.MapType(outer, typ)
+	}
+	return composed
+}
+
+// callMapping returns the mapping of a generic call, binding all type parameters of the
+// function. The checker leaves a type parameter unbound if the argument has exactly the type of
+// the parameter, like l.Rest in a recursive call Map(l.Rest, f), so it's bound to itself.
+func callMapping(src *source, fdecl *ast.FuncDecl, genCall *types.GenericCall) map[*types.TypeParam]types.Type {
+	mapping := make(map[*types.TypeParam]types.Type)
+	for _, param := range src.info.Defs[fdecl.Name].Type().(*types.Signature).TypeParams() {
+		mapping[param] = param
+	}
+	for param, typ := range genCall.Mapping {
+		mapping[param] = typ
+	}
+	return mapping
+}
+
+// paramLess orders generic parameters in instance names: array lengths come first, then type
+// parameters, each sorted by name.
+func paramLess(a, b *types.TypeParam) bool {
+	if (a.Length() != nil) != (b.Length() != nil) {
+		return a.Length() != nil
+	}
+	return a.Name() < b.Name()
+}
+
+// writeParam writes the replacement of a generic type parameter or array length into an
+// instance name. Array lengths are written as numbers.
+func writeParam(cfg *config, w io.Writer, param *types.TypeParam, replacement types.Type) {
+	if param.Length() != nil {
+		fmt.Fprintf(w, "%d", replacement.(*types.Array).Len())
+		return
+	}
+	writeType(cfg, w, replacement)
+}
+
+// lengthLit returns the literal replacing a variable holding a generic array length, or nil if
+// obj is not such a variable.
+func lengthLit(mapping map[*types.TypeParam]types.Type, obj types.Object) ast.Expr {
+	if obj == nil {
+		return nil
+	}
+	for param, replacement := range mapping {
+		if param.Length() == obj {
+			return &ast.BasicLit{
+				Kind:  token.INT,
+				Value: strconv.FormatInt(replacement.(*types.Array).Len(), 10),
+			}
+		}
+	}
+	return nil
+}
+
+// instDoc returns the doc comment of an instantiated declaration: the doc comment of the
+// generic declaration, followed by a line telling what it was instantiated with and where from.
+func instDoc(cfg *config, decl ast.Node, mapping map[*types.TypeParam]types.Type) *ast.CommentGroup {
+	var name string
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		name = decl.Name.Name
+	case *ast.TypeSpec:
+		name = decl.Name.Name
+	}
+
+	text := fmt.Sprintf("// %s instantiated with %s from %s", name, instArgs(cfg, mapping), declLocation(cfg, decl))
+	if len(mapping) == 0 {
+		text = fmt.Sprintf("// %s copied from %s", name, declLocation(cfg, decl))
+	}
+	return copyDoc(cfg.src.docs[decl], text)
+}
+
+// copyDoc returns a copy of the doc comment of a generic declaration, with the line appended
+// to its text. Directives, like //go:noinline, stay at the end, after the line.
+func copyDoc(doc *ast.CommentGroup, line string) *ast.CommentGroup {
+	var text, directives []*ast.Comment
+	if doc != nil {
+		for _, comment := range doc.List {
+			if isDirective(comment.Text) {
+				directives = append(directives, &ast.Comment{Text: comment.Text})
+			} else {
+				text = append(text, &ast.Comment{Text: comment.Text})
+			}
+		}
+	}
+	for len(text) > 0 && text[len(text)-1].Text == "//" {
+		text = text[:len(text)-1]
+	}
+
+	copied := &ast.CommentGroup{List: text}
+	if len(text) > 0 {
+		copied.List = append(copied.List, &ast.Comment{Text: "//"})
+	}
+	copied.List = append(copied.List, &ast.Comment{Text: line})
+	if len(directives) > 0 {
+		copied.List = append(copied.List, &ast.Comment{Text: "//"})
+		copied.List = append(copied.List, directives...)
+	}
+	return copied
+}
+
+// isDirective reports whether a comment is a directive, like //go:noinline, //line or
+// //export, rather than text.
+func isDirective(text string) bool {
+	for _, prefix := range []string{"//line ", "//extern ", "//export "} {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	colon := strings.Index(text, ":")
+	if !strings.HasPrefix(text, "//") || colon <= 2 || colon+1 == len(text) {
+		return false
+	}
+	for _, r := range text[2:colon] + text[colon+1:colon+2] {
+		if !('a' <= r && r <= 'z' || '0' <= r && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// instArgs describes the arguments of an instance, like T=int, U=string.
+func instArgs(cfg *config, mapping map[*types.TypeParam]types.Type) string {
+	var typeParams []*types.TypeParam
+	for param := range mapping {
+		typeParams = append(typeParams, param)
+	}
+	sort.Slice(typeParams, func(i, j int) bool {
+		return paramLess(typeParams[i], typeParams[j])
+	})
+
+	var args []string
+	for _, param := range typeParams {
+		arg := types.TypeString(mapping[param], types.RelativeTo(cfg.pkg))
+		if param.Length() != nil {
+			arg = strconv.FormatInt(mapping[param].(*types.Array).Len(), 10)
+		}
+		args = append(args, param.Name()+"="+arg)
+	}
+	return strings.Join(args, ", ")
+}
+
+// declLocation returns the file and line of a generic declaration, like list.go:12. Files of
+// other packages are prefixed with the import path.
+func declLocation(cfg *config, decl ast.Node) string {
+	pos := cfg.fset.Position(decl.Pos())
+	file := filepath.Base(pos.Filename)
+	if cfg.src.pkg != cfg.pkg {
+		file = path.Join(cfg.src.pkg.Path(), file)
+	}
+	return fmt.Sprintf("%s:%d", file, pos.Line)
+}
+
+// writeDeclName writes the name of an instantiated declaration before its type arguments.
+// Declarations from other packages are prefixed with the package name, so that they don't
+// collide with local declarations of the same name.
+func writeDeclName(cfg *config, w io.Writer, name *ast.Ident) {
+	if cfg.src.pkg != cfg.pkg {
+		fmt.Fprintf(w, "%s_", cfg.src.pkg.Name())
+	}
+	fmt.Fprintf(w, "%s", name.Name)
+}
+
+// qualify returns an expression referring to a package-level object or an imported package
+// from the output file, or nil if the identifier can be used as is.
+func qualify(cfg *config, ident *ast.Ident) ast.Expr {
+	switch obj := cfg.info.Uses[ident].(type) {
+	case nil:
+		return nil
+
+	case *types.PkgName:
+		return &ast.Ident{
+			NamePos: cfg.pos(ident.NamePos),
+			Name:    importName(cfg, obj.Imported()),
+		}
+
+	default:
+		if obj.Pkg() == nil || obj.Pkg() == cfg.pkg || obj.Parent() != obj.Pkg().Scope() {
+			return nil
+		}
+		if !obj.Exported() {
+			return copyUnexported(cfg, obj, ident.Pos())
+		}
+		return selector(cfg, obj.Pkg(), obj.Name(), cfg.pos(ident.NamePos))
+	}
+}
+
+// selector returns an expression referring to the exported name of another package from the
+// output file, which is just the name if the file imports the package with a dot.
+func selector(cfg *config, pkg *types.Package, name string, pos token.Pos) ast.Expr {
+	pkgName := importName(cfg, pkg)
+	if pkgName == "." {
+		return &ast.Ident{NamePos: pos, Name: name}
+	}
+	return &ast.SelectorExpr{
+		X:   &ast.Ident{NamePos: pos, Name: pkgName},
+		Sel: &ast.Ident{NamePos: pos, Name: name},
+	}
+}
+
+// copyUnexported returns an expression referring to the unexported package-level object obj of
+// another package, which generic code of that package refers to at pos. Functions and types are
+// copied into the translated package once, under names prefixed with the package name, like
+// collections_capacity, and types take their methods along. Constants are replaced by their
+// values. Variables can't be copied, because the copies wouldn't share their state.
+func copyUnexported(cfg *config, obj types.Object, pos token.Pos) ast.Expr {
+	switch obj := obj.(type) {
+	case *types.Const:
+		return constExpr(cfg, nil, obj.Type(), constLit(obj.Val()))
+	case *types.Var:
+		cfg.errorf(pos, "cannot instantiate outside of package %s: %s is an unexported variable", obj.Pkg().Path(), obj.Name())
+	}
+
+	var (
+		src  = cfg.sources[obj.Pkg()]
+		decl ast.Node
+		name *ast.Ident
+	)
+	if src != nil {
+		decl = src.decls[obj]
+	}
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		if len(decl.TypeParams) == 0 && len(decl.ConstParams) == 0 {
+			name = decl.Name
+		}
+	case *ast.TypeSpec:
+		if len(decl.Params) == 0 {
+			name = decl.Name
+		}
+	}
+	if name == nil {
+		cfg.errorf(pos, "cannot instantiate outside of package %s: %s is not exported", obj.Pkg().Path(), obj.Name())
+	}
+
+	declCfg := cfg.forDecl(src, decl)
+	copyName := instName(declCfg, name, nil)
+	if !cfg.instantiated[copyName] {
+		cfg.instantiated[copyName] = true
+		declCfg.enqueue(&instance{
+			decl: decl,
+			name: copyName,
+			typ:  obj.Type(),
+		}, pos)
+	}
+	return &ast.Ident{
+		NamePos: cfg.pos(pos),
+		Name:    copyName,
+	}
+}
+
+// importName returns the name of the package in the output file, importing it if necessary.
+func importName(cfg *config, pkg *types.Package) string {
+	names := cfg.imports[cfg.output]
+	if name, ok := names[pkg.Path()]; ok {
+		return name
+	}
+
+	taken := func(name string) bool {
+		for _, other := range names {
+			if other == name {
+				return true
+			}
+		}
+		return cfg.pkg.Scope().Lookup(name) != nil
+	}
+	name := pkg.Name()
+	for i := 2; taken(name); i++ {
+		name = fmt.Sprintf("%s%d", pkg.Name(), i)
+	}
+	names[pkg.Path()] = name
+
+	spec := &ast.ImportSpec{
+		Path: &ast.BasicLit{
+			Kind:  token.STRING,
+			Value: strconv.Quote(pkg.Path()),
+		},
+	}
+	if name != pkg.Name() {
+		spec.Name = &ast.Ident{Name: name}
+	}
+	addImport(cfg.output, spec)
+
+	return name
+}
+
+// addImport adds an import spec to the first import declaration of a file, among the specs
+// sorted by their paths, or to a new declaration before all others if the file has none.
+func addImport(file *ast.File, spec *ast.ImportSpec) {
+	for _, decl := range file.Decls {
+		decl, ok := decl.(*ast.GenDecl)
+		if !ok || decl.Tok != token.IMPORT {
+			continue
+		}
+		i := 0
+		for i < len(decl.Specs) && decl.Specs[i].(*ast.ImportSpec).Path.Value < spec.Path.Value {
+			i++
+		}
+		decl.Specs = append(decl.Specs[:i], append([]ast.Spec{spec}, decl.Specs[i:]...)...)
+		return
+	}
+	file.Decls = append([]ast.Decl{&ast.GenDecl{
+		Tok:   token.IMPORT,
+		Specs: []ast.Spec{spec},
+	}}, file.Decls...)
+}
+
+// instIdent copies an identifier of generic code.
+func instIdent(cfg *config, ident *ast.Ident) *ast.Ident {
+	if ident == nil {
+		return nil
+	}
+	return &ast.Ident{
+		NamePos: cfg.pos(ident.NamePos),
+		Name:    ident.Name,
+	}
+}
+
+func instIdents(cfg *config, idents []*ast.Ident) []*ast.Ident {
+	var instIdents []*ast.Ident
+	for _, ident := range idents {
+		instIdents = append(instIdents, instIdent(cfg, ident))
+	}
+	return instIdents
+}
+
 func instFieldList(cfg *config, mapping map[*types.TypeParam]types.Type, list []*ast.Field) []*ast.Field {
 	var instList []*ast.Field
 	for _, field := range list {
 		instList = append(instList, &ast.Field{
-			Names: field.Names,
+			Names: instIdents(cfg, field.Names),
 			Type:  instNode(cfg, mapping, field.Type).(ast.Expr),
-			Tag:   field.Tag,
+			Tag:   instNode(cfg, mapping, field.Tag).(*ast.BasicLit),
 		})
 	}
 	return instList
@@ -187,20 +817,47 @@ func maybeNilStmt(node ast.Node) ast.Stmt {
 }
 
 func instNode(cfg *config, mapping map[*types.TypeParam]types.Type, node ast.Node) ast.Node {
+	if replacement, ok := cfg.replace[node]; ok {
+		return replacement
+	}
+
 	switch node := node.(type) {
 	default:
 		return node
 
 	case
-		*ast.Comment, *ast.CommentGroup, *ast.BadExpr, *ast.BasicLit,
-		*ast.BadStmt, *ast.EmptyStmt, *ast.BranchStmt, *ast.ImportSpec, *ast.BadDecl:
+		*ast.Comment, *ast.CommentGroup, *ast.BadExpr,
+		*ast.BadStmt, *ast.ImportSpec, *ast.BadDecl:
 		return node
 
+	case *ast.BasicLit:
+		if node == nil {
+			return (*ast.BasicLit)(nil)
+		}
+		return &ast.BasicLit{
+			ValuePos: cfg.pos(node.ValuePos),
+			Kind:     node.Kind,
+			Value:    node.Value,
+		}
+
+	case *ast.EmptyStmt:
+		return &ast.EmptyStmt{
+			Semicolon: cfg.pos(node.Semicolon),
+			Implicit:  node.Implicit,
+		}
+
+	case *ast.BranchStmt:
+		return &ast.BranchStmt{
+			TokPos: cfg.pos(node.TokPos),
+			Tok:    node.Tok,
+			Label:  instIdent(cfg, node.Label),
+		}
+
 	case *ast.Field:
 		return &ast.Field{
-			Names: node.Names,
+			Names: instIdents(cfg, node.Names),
 			Type:  instNode(cfg, mapping, node.Type).(ast.Expr),
-			Tag:   node.Tag,
+			Tag:   instNode(cfg, mapping, node.Tag).(*ast.BasicLit),
 		}
 
 	case *ast.FieldList:
@@ -208,36 +865,52 @@ func instNode(cfg *config, mapping map[*types.TypeParam]types.Type, node ast.Nod
 			return (*ast.FieldList)(nil)
 		}
 		return &ast.FieldList{
-			List: instFieldList(cfg, mapping, node.List),
+			Opening: cfg.pos(node.Opening),
+			List:    instFieldList(cfg, mapping, node.List),
+			Closing: cfg.pos(node.Closing),
 		}
 
 	case *ast.Ident:
+		if name := embeddedName(cfg, mapping, cfg.info.Uses[node]); name != "" {
+			return &ast.Ident{NamePos: cfg.pos(node.NamePos), Name: name}
+		}
+		if qualified := qualify(cfg, node); qualified != nil {
+			return qualified
+		}
+		if length := lengthLit(mapping, cfg.info.Uses[node]); length != nil {
+			return length
+		}
 		typ, ok := cfg.info.Types[node]
 		if !ok {
-			return node
+			return instIdent(cfg, node)
 		}
 		if !typ.IsType() {
-			return node
+			return instIdent(cfg, node)
 		}
 		typeParam, ok := typ.Type.(*types.TypeParam)
 		if !ok {
-			return node
+			return instIdent(cfg, node)
 		}
 		replacement, ok := mapping[typeParam]
 		if !ok {
-			panic("no replacement for a generic type")
+			cfg.errorf(node.Pos(), "no type argument for %s", typeParam.Name())
 		}
-		return typeToExpr(replacement)
+		return typeToExpr(cfg, replacement)
 
 	case *ast.SelectorExpr:
+		sel := instIdent(cfg, node.Sel)
+		if name := embeddedName(cfg, mapping, cfg.info.Uses[node.Sel]); name != "" {
+			sel.Name = name
+		}
 		return &ast.SelectorExpr{
 			X:   instNode(cfg, mapping, node.X).(ast.Expr),
-			Sel: node.Sel,
+			Sel: sel,
 		}
 
 	case *ast.Ellipsis:
 		return &ast.Ellipsis{
-			Elt: instNode(cfg, mapping, node.Elt).(ast.Expr),
+			Ellipsis: cfg.pos(node.Ellipsis),
+			Elt:      instNode(cfg, mapping, node.Elt).(ast.Expr),
 		}
 
 	case *ast.FuncLit:
@@ -248,109 +921,184 @@ func instNode(cfg *config, mapping map[*types.TypeParam]types.Type, node ast.Nod
 
 	case *ast.CompositeLit:
 		return &ast.CompositeLit{
-			Type: instNode(cfg, mapping, node.Type).(ast.Expr),
-			Elts: instExprList(cfg, mapping, node.Elts),
+			Type:   instNode(cfg, mapping, node.Type).(ast.Expr),
+			Lbrace: cfg.pos(node.Lbrace),
+			Elts:   instExprList(cfg, mapping, node.Elts),
+			Rbrace: cfg.pos(node.Rbrace),
 		}
 
 	case *ast.ParenExpr:
 		return &ast.ParenExpr{
-			X: instNode(cfg, mapping, node.X).(ast.Expr),
+			Lparen: cfg.pos(node.Lparen),
+			X:      instNode(cfg, mapping, node.X).(ast.Expr),
+			Rparen: cfg.pos(node.Rparen),
 		}
 
 	case *ast.IndexExpr:
 		return &ast.IndexExpr{
-			X:     instNode(cfg, mapping, node.X).(ast.Expr),
-			Index: instNode(cfg, mapping, node.Index).(ast.Expr),
+			X:      instNode(cfg, mapping, node.X).(ast.Expr),
+			Lbrack: cfg.pos(node.Lbrack),
+			Index:  instNode(cfg, mapping, node.Index).(ast.Expr),
+			Rbrack: cfg.pos(node.Rbrack),
 		}
 
 	case *ast.SliceExpr:
 		return &ast.SliceExpr{
 			X:      instNode(cfg, mapping, node.X).(ast.Expr),
+			Lbrack: cfg.pos(node.Lbrack),
 			Low:    maybeNil(instNode(cfg, mapping, node.Low)),
 			High:   maybeNil(instNode(cfg, mapping, node.High)),
 			Max:    maybeNil(instNode(cfg, mapping, node.Max)),
 			Slice3: node.Slice3,
+			Rbrack: cfg.pos(node.Rbrack),
 		}
 
 	case *ast.TypeAssertExpr:
 		return &ast.TypeAssertExpr{
-			X:    instNode(cfg, mapping, node.X).(ast.Expr),
-			Type: instNode(cfg, mapping, node.Type).(ast.Expr),
+			X:      instNode(cfg, mapping, node.X).(ast.Expr),
+			Lparen: cfg.pos(node.Lparen),
+			Type:   instNode(cfg, mapping, node.Type).(ast.Expr),
+			Rparen: cfg.pos(node.Rparen),
 		}
 
 	case *ast.CallExpr:
+		if genInst, ok := cfg.info.GenericInstances[node]; ok {
+			src, decl := genericDecl(cfg, node.Fun)
+			spec := decl.(*ast.TypeSpec)
+			genInst = &types.GenericInstance{
+				Mapping: composeMapping(mapping, genInst.Mapping),
+			}
+			typ := types.MapType(mapping, cfg.info.TypeOf(node))
+			return &ast.Ident{
+				NamePos: cfg.pos(node.Pos()),
+				Name:    instTypeSpec(cfg.forDecl(src, spec), genInst, spec, typ, node.Pos()),
+			}
+		}
+
+		if genCall, ok := cfg.info.GenericCalls[node]; ok {
+			src, decl := genericDecl(cfg, node.Fun)
+			funcDecl := decl.(*ast.FuncDecl)
+			genCall = &types.GenericCall{
+				NumUnnamed: genCall.NumUnnamed,
+				Mapping:    composeMapping(mapping, callMapping(src, funcDecl, genCall)),
+			}
+			return &ast.CallExpr{
+				Fun: &ast.Ident{
+					NamePos: cfg.pos(node.Fun.Pos()),
+					Name:    instFuncDecl(cfg.forDecl(src, funcDecl), genCall, funcDecl, node.Pos()),
+				},
+				Lparen:   cfg.pos(node.Lparen),
+				Args:     instExprList(cfg, mapping, node.Args[genCall.NumUnnamed:]),
+				Ellipsis: node.Ellipsis,
+				Rparen:   cfg.pos(node.Rparen),
+			}
+		}
+
+		if tv := cfg.info.Types[node.Fun]; tv.IsType() && len(node.Args) == 1 && cfg.inst != nil {
+			// conversions of values of types depending on type parameters are checked for each
+			// instance, because a num type parameter may be a complex type, which doesn't
+			// convert to real ones
+			arg := cfg.info.Types[node.Args[0]]
+			from, to := types.MapType(mapping, arg.Type), types.MapType(mapping, tv.Type)
+			if arg.Value == nil && (dependsOnAny(arg.Type) || dependsOnAny(tv.Type)) && !types.ConvertibleTo(from, to) {
+				cfg.errorf(node.Pos(), "cannot convert %s to %s in %s, instantiated at %s",
+					from, to, describe(cfg.inst), cfg.fset.Position(cfg.inst.pos))
+			}
+		}
+
 		return &ast.CallExpr{
 			Fun:      instNode(cfg, mapping, node.Fun).(ast.Expr),
+			Lparen:   cfg.pos(node.Lparen),
 			Args:     instExprList(cfg, mapping, node.Args),
 			Ellipsis: node.Ellipsis,
+			Rparen:   cfg.pos(node.Rparen),
 		}
 
 	case *ast.StarExpr:
 		return &ast.StarExpr{
-			X: instNode(cfg, mapping, node.X).(ast.Expr),
+			Star: cfg.pos(node.Star),
+			X:    instNode(cfg, mapping, node.X).(ast.Expr),
 		}
 
 	case *ast.UnaryExpr:
 		return &ast.UnaryExpr{
-			Op: node.Op,
-			X:  instNode(cfg, mapping, node.X).(ast.Expr),
+			OpPos: cfg.pos(node.OpPos),
+			Op:    node.Op,
+			X:     instNode(cfg, mapping, node.X).(ast.Expr),
 		}
 
 	case *ast.BinaryExpr:
 		return &ast.BinaryExpr{
-			X:  instNode(cfg, mapping, node.X).(ast.Expr),
-			Op: node.Op,
-			Y:  instNode(cfg, mapping, node.Y).(ast.Expr),
+			X:     instNode(cfg, mapping, node.X).(ast.Expr),
+			OpPos: cfg.pos(node.OpPos),
+			Op:    node.Op,
+			Y:     instNode(cfg, mapping, node.Y).(ast.Expr),
 		}
 
 	case *ast.KeyValueExpr:
 		return &ast.KeyValueExpr{
 			Key:   instNode(cfg, mapping, node.Key).(ast.Expr),
+			Colon: cfg.pos(node.Colon),
 			Value: instNode(cfg, mapping, node.Value).(ast.Expr),
 		}
 
 	case *ast.ArrayType:
 		return &ast.ArrayType{
-			Len: maybeNil(instNode(cfg, mapping, node.Len)),
-			Elt: instNode(cfg, mapping, node.Elt).(ast.Expr),
+			Lbrack: cfg.pos(node.Lbrack),
+			Len:    maybeNil(instNode(cfg, mapping, node.Len)),
+			Elt:    instNode(cfg, mapping, node.Elt).(ast.Expr),
 		}
 
 	case *ast.StructType:
 		return &ast.StructType{
+			Struct:     cfg.pos(node.Struct),
 			Fields:     instNode(cfg, mapping, node.Fields).(*ast.FieldList),
 			Incomplete: node.Incomplete,
 		}
 
 	case *ast.FuncType:
 		return &ast.FuncType{
+			Func:    cfg.pos(node.Func),
 			Params:  instNode(cfg, mapping, node.Params).(*ast.FieldList),
 			Results: instNode(cfg, mapping, node.Results).(*ast.FieldList),
 		}
 
 	case *ast.InterfaceType:
 		return &ast.InterfaceType{
+			Interface:  cfg.pos(node.Interface),
 			Methods:    instNode(cfg, mapping, node.Methods).(*ast.FieldList),
 			Incomplete: node.Incomplete,
 		}
 
 	case *ast.MapType:
 		return &ast.MapType{
+			Map:   cfg.pos(node.Map),
 			Key:   instNode(cfg, mapping, node.Key).(ast.Expr),
 			Value: instNode(cfg, mapping, node.Value).(ast.Expr),
 		}
 
 	case *ast.ChanType:
 		return &ast.ChanType{
+			Begin: cfg.pos(node.Begin),
+			Arrow: cfg.pos(node.Arrow),
 			Dir:   node.Dir,
 			Value: instNode(cfg, mapping, node.Value).(ast.Expr),
 		}
 
 	case *ast.TypeParam:
-		replacement, ok := mapping[cfg.info.TypeOf(node).(*types.TypeParam)]
+		typeParam := cfg.info.TypeOf(node).(*types.TypeParam)
+		replacement, ok := mapping[typeParam]
 		if !ok {
-			panic("no replacement for a generic type")
+			cfg.errorf(node.Pos(), "no type argument for %s", typeParam.Name())
 		}
-		return typeToExpr(replacement)
+		return typeToExpr(cfg, replacement)
+
+	case *ast.ConstParam:
+		length := lengthLit(mapping, cfg.info.Defs[node.Name])
+		if length == nil {
+			cfg.errorf(node.Pos(), "no array length for %s", node.Name.Name)
+		}
+		return length
 
 	case *ast.DeclStmt:
 		return &ast.DeclStmt{
@@ -359,7 +1107,8 @@ func instNode(cfg *config, mapping map[*types.TypeParam]types.Type, node ast.Nod
 
 	case *ast.LabeledStmt:
 		return &ast.LabeledStmt{
-			Label: node.Label,
+			Label: instIdent(cfg, node.Label),
+			Colon: cfg.pos(node.Colon),
 			Stmt:  instNode(cfg, mapping, node.Stmt).(ast.Stmt),
 		}
 
@@ -371,44 +1120,53 @@ func instNode(cfg *config, mapping map[*types.TypeParam]types.Type, node ast.Nod
 	case *ast.SendStmt:
 		return &ast.SendStmt{
 			Chan:  instNode(cfg, mapping, node.Chan).(ast.Expr),
+			Arrow: cfg.pos(node.Arrow),
 			Value: instNode(cfg, mapping, node.Value).(ast.Expr),
 		}
 
 	case *ast.IncDecStmt:
 		return &ast.IncDecStmt{
-			X:   instNode(cfg, mapping, node.X).(ast.Expr),
-			Tok: node.Tok,
+			X:      instNode(cfg, mapping, node.X).(ast.Expr),
+			TokPos: cfg.pos(node.TokPos),
+			Tok:    node.Tok,
 		}
 
 	case *ast.AssignStmt:
 		return &ast.AssignStmt{
-			Lhs: instExprList(cfg, mapping, node.Lhs),
-			Tok: node.Tok,
-			Rhs: instExprList(cfg, mapping, node.Rhs),
+			Lhs:    instExprList(cfg, mapping, node.Lhs),
+			TokPos: cfg.pos(node.TokPos),
+			Tok:    node.Tok,
+			Rhs:    instExprList(cfg, mapping, node.Rhs),
 		}
 
 	case *ast.GoStmt:
 		return &ast.GoStmt{
+			Go:   cfg.pos(node.Go),
 			Call: instNode(cfg, mapping, node.Call).(*ast.CallExpr),
 		}
 
 	case *ast.DeferStmt:
 		return &ast.DeferStmt{
-			Call: instNode(cfg, mapping, node.Call).(*ast.CallExpr),
+			Defer: cfg.pos(node.Defer),
+			Call:  instNode(cfg, mapping, node.Call).(*ast.CallExpr),
 		}
 
 	case *ast.ReturnStmt:
 		return &ast.ReturnStmt{
+			Return:  cfg.pos(node.Return),
 			Results: instExprList(cfg, mapping, node.Results),
 		}
 
 	case *ast.BlockStmt:
 		return &ast.BlockStmt{
-			List: instStmtList(cfg, mapping, node.List),
+			Lbrace: cfg.pos(node.Lbrace),
+			List:   instStmtList(cfg, mapping, node.List),
+			Rbrace: cfg.pos(node.Rbrace),
 		}
 
 	case *ast.IfStmt:
 		return &ast.IfStmt{
+			If:   cfg.pos(node.If),
 			Init: maybeNilStmt(instNode(cfg, mapping, node.Init)),
 			Cond: instNode(cfg, mapping, node.Cond).(ast.Expr),
 			Body: instNode(cfg, mapping, node.Body).(*ast.BlockStmt),
@@ -417,19 +1175,23 @@ func instNode(cfg *config, mapping map[*types.TypeParam]types.Type, node ast.Nod
 
 	case *ast.CaseClause:
 		return &ast.CaseClause{
-			List: instExprList(cfg, mapping, node.List),
-			Body: instStmtList(cfg, mapping, node.Body),
+			Case:  cfg.pos(node.Case),
+			List:  instExprList(cfg, mapping, node.List),
+			Colon: cfg.pos(node.Colon),
+			Body:  instStmtList(cfg, mapping, node.Body),
 		}
 
 	case *ast.SwitchStmt:
 		return &ast.SwitchStmt{
-			Init: maybeNilStmt(instNode(cfg, mapping, node.Init)),
-			Tag:  instNode(cfg, mapping, node.Tag).(ast.Expr),
-			Body: instNode(cfg, mapping, node.Body).(*ast.BlockStmt),
+			Switch: cfg.pos(node.Switch),
+			Init:   maybeNilStmt(instNode(cfg, mapping, node.Init)),
+			Tag:    instNode(cfg, mapping, node.Tag).(ast.Expr),
+			Body:   instNode(cfg, mapping, node.Body).(*ast.BlockStmt),
 		}
 
 	case *ast.TypeSwitchStmt:
 		return &ast.TypeSwitchStmt{
+			Switch: cfg.pos(node.Switch),
 			Init:   maybeNilStmt(instNode(cfg, mapping, node.Init)),
 			Assign: instNode(cfg, mapping, node.Assign).(ast.Stmt),
 			Body:   instNode(cfg, mapping, node.Body).(*ast.BlockStmt),
@@ -437,17 +1199,21 @@ func instNode(cfg *config, mapping map[*types.TypeParam]types.Type, node ast.Nod
 
 	case *ast.CommClause:
 		return &ast.CommClause{
-			Comm: instNode(cfg, mapping, node.Comm).(ast.Stmt),
-			Body: instStmtList(cfg, mapping, node.Body),
+			Case:  cfg.pos(node.Case),
+			Comm:  instNode(cfg, mapping, node.Comm).(ast.Stmt),
+			Colon: cfg.pos(node.Colon),
+			Body:  instStmtList(cfg, mapping, node.Body),
 		}
 
 	case *ast.SelectStmt:
 		return &ast.SelectStmt{
-			Body: instNode(cfg, mapping, node.Body).(*ast.BlockStmt),
+			Select: cfg.pos(node.Select),
+			Body:   instNode(cfg, mapping, node.Body).(*ast.BlockStmt),
 		}
 
 	case *ast.ForStmt:
 		return &ast.ForStmt{
+			For:  cfg.pos(node.For),
 			Init: maybeNilStmt(instNode(cfg, mapping, node.Init)),
 			Cond: maybeNil(instNode(cfg, mapping, node.Cond)),
 			Post: maybeNilStmt(instNode(cfg, mapping, node.Post)),
@@ -456,23 +1222,25 @@ func instNode(cfg *config, mapping map[*types.TypeParam]types.Type, node ast.Nod
 
 	case *ast.RangeStmt:
 		return &ast.RangeStmt{
-			Key:   maybeNil(instNode(cfg, mapping, node.Key)),
-			Value: maybeNil(instNode(cfg, mapping, node.Value)),
-			Tok:   node.Tok,
-			X:     instNode(cfg, mapping, node.X).(ast.Expr),
-			Body:  instNode(cfg, mapping, node.Body).(*ast.BlockStmt),
+			For:    cfg.pos(node.For),
+			Key:    maybeNil(instNode(cfg, mapping, node.Key)),
+			Value:  maybeNil(instNode(cfg, mapping, node.Value)),
+			TokPos: cfg.pos(node.TokPos),
+			Tok:    node.Tok,
+			X:      instNode(cfg, mapping, node.X).(ast.Expr),
+			Body:   instNode(cfg, mapping, node.Body).(*ast.BlockStmt),
 		}
 
 	case *ast.ValueSpec:
 		return &ast.ValueSpec{
-			Names:  node.Names,
+			Names:  instIdents(cfg, node.Names),
 			Type:   maybeNil(instNode(cfg, mapping, node.Type)),
 			Values: instExprList(cfg, mapping, node.Values),
 		}
 
 	case *ast.TypeSpec:
 		return &ast.TypeSpec{
-			Name: node.Name,
+			Name: instIdent(cfg, node.Name),
 			Type: instNode(cfg, mapping, node.Type).(ast.Expr),
 		}
 
@@ -482,10 +1250,11 @@ func instNode(cfg *config, mapping map[*types.TypeParam]types.Type, node ast.Nod
 			instSpecs = append(instSpecs, instNode(cfg, mapping, spec).(ast.Spec))
 		}
 		return &ast.GenDecl{
+			TokPos: cfg.pos(node.TokPos),
 			Tok:    node.Tok,
-			Lparen: node.Lparen,
+			Lparen: cfg.pos(node.Lparen),
 			Specs:  instSpecs,
-			Rparen: node.Rparen,
+			Rparen: cfg.pos(node.Rparen),
 		}
 
 	case *ast.FuncDecl:
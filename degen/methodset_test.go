@@ -0,0 +1,97 @@
+package degen_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/faiface/generics/degen"
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/parser"
+	"github.com/faiface/generics/go/printer"
+	"github.com/faiface/generics/go/token"
+)
+
+const methodSetSrc = `package main
+
+type Stringer interface {
+	String() string
+}
+
+type Pusher(type T) interface {
+	Push(x T)
+}
+
+type Stack(type T) struct {
+	items []T
+}
+
+func (s *Stack(type T)) Push(x T) { s.items = append(s.items, x) }
+
+func (s *Stack(type T)) String() string { return "stack" }
+
+var _ Stringer = &Stack(int){}
+
+func main() {
+	var p Pusher(int) = &Stack(int){}
+	p.Push(1)
+}
+`
+
+// TestTranslateMethodSet translates instances of generic types that implement interfaces through
+// their methods.
+func TestTranslateMethodSet(t *testing.T) {
+	testTranslate(t, []translateCase{
+		{
+			name:      "stack",
+			src:       methodSetSrc,
+			instances: []string{"Stack_int", "Pusher_int"},
+			want:      []string{"var _ Stringer = &Stack_int{}", "var p Pusher_int = &Stack_int{}", "*Stack_int) Push("},
+		},
+	})
+}
+
+const embeddedSrc = `package main
+
+type List(type T) struct {
+	Value T
+	Next  *List(T)
+}
+
+func (l *List(type T)) Prepend(x T) *List(T) { return &List(T){Value: x, Next: l} }
+
+type Stack(type T) struct {
+	*List(T)
+}
+
+func (s *Stack(type T)) Push(x T) { s.List = s.Prepend(x) }
+
+func main() {
+	s := &Stack(int){List: nil}
+	s.Push(1)
+	println(s.Value, s.List.Value)
+}
+`
+
+// TestTranslateEmbedded checks the names of fields embedding instances of generic types in the
+// translated code, and that methods promoted from them aren't instantiated again.
+func TestTranslateEmbedded(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "stack.go", embeddedSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := degen.Translate(fset, []*ast.File{file}, degen.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var printed strings.Builder
+	printer.Fprint(&printed, fset, result.Files[0])
+	for _, want := range []string{"\t*List_int\n", "s.List_int = s.Prepend(x)", "Stack_int{List_int: nil}", "s.List_int.Value"} {
+		if !strings.Contains(printed.String(), want) {
+			t.Errorf("translated file doesn't contain %q:\n%s", want, printed.String())
+		}
+	}
+	if strings.Contains(printed.String(), "func (l *Stack_int) Prepend") {
+		t.Errorf("promoted method is instantiated for Stack_int:\n%s", printed.String())
+	}
+}
@@ -0,0 +1,517 @@
+package degen
+
+import (
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/scanner"
+	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
+)
+
+// Migrate rewrites the files of a single package from the syntax of this proposal to the type
+// parameters of Go 1.18. Each input file, along with its source, produces the migrated source at
+// the same index. Everything but the generic syntax is kept as it is, comments included, and the
+// result is formatted.
+//
+// Type parameters are declared in brackets after the name of a function or a type, like
+// func Map[T, U any](a []T, f func(T) U) []U, ordered by their first occurrence, except that
+// unnamed ones, like T in Read(type T), come first. Restrictions become constraints: eq becomes
+// comparable, ord becomes cmp.Ordered, num becomes Number, an interface of all numeric types
+// declared in the first file, and integer becomes Integer, declared likewise. An interface
+// restriction becomes the constraint, or is embedded in it along with the constraints of the
+// other restrictions, like interface{ comparable; Lener }. Methods of generic types refer to the
+// type parameters of their receivers without constraints. Instances, like List(int), become
+// List[int], and generic calls with unnamed type parameters, like Read(string), pass them
+// explicitly, like Read[string]().
+//
+// Go converts a value of a type parameter only if it can convert values of all types of the
+// constraint, and it doesn't convert between real and complex numbers. So a num type parameter
+// whose values are converted from or to real numeric types, like float64(x), becomes
+// OrderedNumber instead, which leaves out complex numbers like the ord num restriction.
+//
+// Go has no generic array lengths, nor methods with type parameters of their own, nor
+// conversions of num values from or to complex types. If the files use them, or don't
+// type-check, Migrate returns no output and a scanner.ErrorList of all the problems, sorted by
+// position.
+func Migrate(fset *token.FileSet, imp *Importer, input []*ast.File, sources [][]byte) (output [][]byte, err error) {
+	pkg, info, err := check(fset, imp, input)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &migration{
+		fset:        fset,
+		info:        info,
+		pkg:         pkg,
+		errors:      new(scanner.ErrorList),
+		constraints: make(map[ast.Restriction]string),
+		recvParams:  make(map[*types.TypeParam]*types.TypeParam),
+		real:        make(map[*types.TypeParam]bool),
+	}
+	for _, file := range input {
+		m.findRecvParams(file)
+	}
+	for _, file := range input {
+		m.findConversions(file)
+	}
+	var files []*migratedFile
+	for i, file := range input {
+		files = append(files, m.migrateFile(file, sources[i]))
+	}
+	if err := m.errors.Err(); err != nil {
+		m.errors.Sort()
+		return nil, m.errors
+	}
+
+	// the constraints of the num and integer restrictions are declared once per package
+	var decls strings.Builder
+	for _, restriction := range []ast.Restriction{ast.RestrictionNum, ast.RestrictionNum | ast.RestrictionOrd, ast.RestrictionNum | ast.RestrictionInteger} {
+		if name, ok := m.constraints[restriction|ast.RestrictionEq]; ok {
+			fmt.Fprintf(&decls, "\n%s", numConstraint(name, restriction))
+		}
+	}
+	if len(files) > 0 {
+		files[0].edits = append(files[0].edits, edit{len(files[0].src), len(files[0].src), decls.String()})
+	}
+
+	for _, file := range files {
+		migrated, err := format.Source(file.apply())
+		if err != nil {
+			return nil, fmt.Errorf("%s: internal error: migrated source doesn't parse: %v", file.name, err)
+		}
+		output = append(output, migrated)
+	}
+	return output, nil
+}
+
+// migration is the state of migrating a package.
+type migration struct {
+	fset        *token.FileSet
+	info        *types.Info
+	pkg         *types.Package
+	errors      *scanner.ErrorList
+	constraints map[ast.Restriction]string // names of declared constraints by the restrictions they stand for
+
+	recvParams map[*types.TypeParam]*types.TypeParam // type parameters of generic types by those of method receivers
+	real       map[*types.TypeParam]bool             // num type parameters converted from or to real numeric types
+}
+
+// migratedFile is a source file along with the edits migrating it.
+type migratedFile struct {
+	name  string
+	file  *token.File
+	src   []byte
+	edits []edit
+	cmp   bool // whether the file needs to import cmp
+}
+
+// edit replaces the bytes from start to end of a source file with text.
+type edit struct {
+	start, end int
+	text       string
+}
+
+func (m *migration) errorf(pos token.Pos, format string, args ...interface{}) {
+	m.errors.Add(m.fset.Position(pos), fmt.Sprintf(format, args...))
+}
+
+func (m *migration) migrateFile(file *ast.File, src []byte) *migratedFile {
+	f := &migratedFile{
+		name: m.fset.Position(file.Package).Filename,
+		file: m.fset.File(file.Package),
+		src:  src,
+	}
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FuncDecl:
+			if len(node.TypeParams) > 0 || len(node.ConstParams) > 0 {
+				m.migrateFuncDecl(f, node)
+			}
+		case *ast.TypeSpec:
+			if len(node.Params) > 0 {
+				f.replace(node.Lparen, node.Rparen+1, m.typeParamList(f, node.Params))
+			}
+		case *ast.CallExpr:
+			m.migrateCall(f, node)
+		case *ast.TypeParam:
+			return false // interface restrictions are migrated along with their constraints
+		}
+		return true
+	})
+
+	if f.cmp {
+		m.importCmp(f, file)
+	}
+	return f
+}
+
+// migrateFuncDecl declares the type parameters of a generic function in brackets after its name.
+// Type parameters of methods belong to their receivers.
+func (m *migration) migrateFuncDecl(f *migratedFile, fdecl *ast.FuncDecl) {
+	for _, param := range fdecl.ConstParams {
+		m.errorf(param.Pos(), "cannot migrate generic array length %s: Go has no generic array lengths", param.Name.Name)
+	}
+
+	if fdecl.Recv.NumFields() > 0 {
+		for _, param := range fdecl.TypeParams {
+			if param.Pos() < fdecl.Recv.Pos() || fdecl.Recv.End() <= param.Pos() {
+				m.errorf(param.Pos(), "cannot migrate type parameter %s of method %s: Go methods can't have type parameters of their own", param.Name.Name, fdecl.Name.Name)
+				continue
+			}
+			f.replace(param.Pos(), f.restrictionEnd(param), param.Name.Name)
+		}
+		return
+	}
+
+	// unnamed type parameters are removed from the parameters, and come first in the brackets
+	var params []*ast.TypeParam
+	unnamed := make(map[*ast.TypeParam]bool)
+	fields := fdecl.Type.Params.List
+	for i, field := range fields {
+		param, ok := field.Type.(*ast.TypeParam)
+		if !ok || len(field.Names) > 0 {
+			continue
+		}
+		params = append(params, param)
+		unnamed[param] = true
+		end := f.restrictionEnd(param)
+		if i+1 < len(fields) {
+			end = fields[i+1].Pos()
+		}
+		f.replace(field.Pos(), end, "")
+	}
+
+	named := append([]*ast.TypeParam(nil), fdecl.TypeParams...)
+	sort.Slice(named, func(i, j int) bool {
+		return named[i].Pos() < named[j].Pos()
+	})
+	for _, param := range named {
+		if unnamed[param] {
+			continue
+		}
+		params = append(params, param)
+		f.replace(param.Pos(), f.restrictionEnd(param), param.Name.Name)
+	}
+
+	f.replace(fdecl.Name.End(), fdecl.Name.End(), m.typeParamList(f, params))
+}
+
+// typeParamList returns the brackets declaring type parameters along with their constraints,
+// like [K comparable, V any]. Consecutive ones with the same constraint share it.
+func (m *migration) typeParamList(f *migratedFile, params []*ast.TypeParam) string {
+	var constraints []string
+	for _, param := range params {
+		constraints = append(constraints, m.paramConstraint(f, param))
+	}
+
+	var list strings.Builder
+	list.WriteString("[")
+	for i, param := range params {
+		if i > 0 {
+			list.WriteString(", ")
+		}
+		list.WriteString(param.Name.Name)
+		if i+1 == len(params) || constraints[i+1] != constraints[i] {
+			fmt.Fprintf(&list, " %s", constraints[i])
+		}
+	}
+	list.WriteString("]")
+	return list.String()
+}
+
+// paramConstraint returns the constraint of a type parameter, standing for its restrictions.
+func (m *migration) paramConstraint(f *migratedFile, param *ast.TypeParam) string {
+	restriction := param.Restriction
+	if typeName, ok := m.info.Defs[param.Name].(*types.TypeName); ok && m.real[typeName.Type().(*types.TypeParam)] {
+		restriction |= ast.RestrictionOrd
+	}
+	constraint := m.constraint(f, restriction)
+	if param.Interface == nil {
+		return constraint
+	}
+	iface := m.migrateExpr(f, param.Interface)
+	if constraint == "any" {
+		return iface
+	}
+	return fmt.Sprintf("interface{ %s; %s }", constraint, iface)
+}
+
+// migrateExpr returns the migrated source of an expression, which is moved elsewhere.
+func (m *migration) migrateExpr(f *migratedFile, e ast.Expr) string {
+	expr := &migratedFile{name: f.name, file: f.file, src: f.src}
+	expr.edits = append(expr.edits, edit{0, f.file.Offset(e.Pos()), ""})
+	ast.Inspect(e, func(node ast.Node) bool {
+		if call, ok := node.(*ast.CallExpr); ok {
+			m.migrateCall(expr, call)
+		}
+		return true
+	})
+	expr.edits = append(expr.edits, edit{f.file.Offset(e.End()), len(f.src), ""})
+	return string(expr.apply())
+}
+
+// constraint returns the constraint standing for a restriction.
+func (m *migration) constraint(f *migratedFile, restriction ast.Restriction) string {
+	switch {
+	case restriction == 0:
+		return "any"
+	case restriction&ast.RestrictionNum != 0:
+		if restriction&ast.RestrictionInteger != 0 {
+			restriction &^= ast.RestrictionOrd // integers are ordered anyway
+		}
+		if name, ok := m.constraints[restriction]; ok {
+			return name
+		}
+		name := "Number"
+		if restriction&ast.RestrictionInteger != 0 {
+			name = "Integer"
+		} else if restriction&ast.RestrictionOrd != 0 {
+			name = "OrderedNumber"
+		}
+		taken := func(name string) bool {
+			for _, other := range m.constraints {
+				if other == name {
+					return true
+				}
+			}
+			return m.pkg.Scope().Lookup(name) != nil
+		}
+		base := name
+		for i := 2; taken(name); i++ {
+			name = fmt.Sprintf("%s%d", base, i)
+		}
+		m.constraints[restriction] = name
+		return name
+	case restriction&ast.RestrictionOrd != 0:
+		f.cmp = true
+		return "cmp.Ordered"
+	}
+	return "comparable"
+}
+
+// numConstraint returns the declaration of the constraint of the num restriction, of the num and
+// ord restrictions together, which leave out complex numbers, or of the integer restriction.
+func numConstraint(name string, restriction ast.Restriction) string {
+	var b strings.Builder
+	switch {
+	case restriction&ast.RestrictionInteger != 0:
+		fmt.Fprintf(&b, "// %s is satisfied by all integer types, like the integer restriction.\n", name)
+	case restriction&ast.RestrictionOrd != 0:
+		fmt.Fprintf(&b, "// %s is satisfied by all numeric types but complex ones, like the ord num restriction.\n", name)
+	default:
+		fmt.Fprintf(&b, "// %s is satisfied by all numeric types, like the num restriction.\n", name)
+	}
+	fmt.Fprintf(&b, "type %s interface {\n", name)
+	b.WriteString("\t~int | ~int8 | ~int16 | ~int32 | ~int64 |\n")
+	switch {
+	case restriction&ast.RestrictionInteger != 0:
+		b.WriteString("\t\t~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr\n")
+	case restriction&ast.RestrictionOrd != 0:
+		b.WriteString("\t\t~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |\n")
+		b.WriteString("\t\t~float32 | ~float64\n")
+	default:
+		b.WriteString("\t\t~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |\n")
+		b.WriteString("\t\t~float32 | ~float64 |\n")
+		b.WriteString("\t\t~complex64 | ~complex128\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// findRecvParams maps the type parameters of the receivers of methods to those of their generic
+// types, like T in func (l *List(type T)) Len() int to T in type List(type T).
+func (m *migration) findRecvParams(file *ast.File) {
+	for _, decl := range file.Decls {
+		fdecl, ok := decl.(*ast.FuncDecl)
+		if !ok || fdecl.Recv.NumFields() == 0 {
+			continue
+		}
+		recv := unparen(fdecl.Recv.List[0].Type)
+		if star, ok := recv.(*ast.StarExpr); ok {
+			recv = unparen(star.X)
+		}
+		call, ok := recv.(*ast.CallExpr)
+		if !ok {
+			continue
+		}
+		ident, ok := unparen(call.Fun).(*ast.Ident)
+		if !ok {
+			continue
+		}
+		typeName, ok := m.info.Uses[ident].(*types.TypeName)
+		if !ok {
+			continue
+		}
+		named := typeName.Type().(*types.Named)
+		for i, arg := range call.Args {
+			param, ok := arg.(*ast.TypeParam)
+			if !ok || i >= named.NumParams() {
+				continue
+			}
+			if obj, ok := m.info.Defs[param.Name].(*types.TypeName); ok {
+				m.recvParams[obj.Type().(*types.TypeParam)] = named.Param(i)
+			}
+		}
+	}
+}
+
+// findConversions finds the num type parameters whose values are converted from or to real
+// numeric types, and reports conversions from or to complex types, which Go can't do for all
+// numeric types.
+func (m *migration) findConversions(file *ast.File) {
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 || !m.info.Types[call.Fun].IsType() {
+			return true
+		}
+		if m.info.Types[call.Args[0]].Value != nil {
+			return true // constants fit any numeric type, like T(0)
+		}
+		from, to := m.info.TypeOf(call.Args[0]), m.info.TypeOf(call)
+		if types.Identical(from, to) {
+			return true
+		}
+		for _, conv := range [][2]types.Type{{from, to}, {to, from}} {
+			param, other := m.numParam(conv[0]), conv[1]
+			if param == nil {
+				continue
+			}
+			if m.numParam(other) != nil {
+				m.real[param] = true
+				continue
+			}
+			basic, ok := other.Underlying().(*types.Basic)
+			if !ok || basic.Info()&types.IsNumeric == 0 || basic.Info()&types.IsUntyped != 0 {
+				continue
+			}
+			if basic.Info()&types.IsComplex != 0 {
+				m.errorf(call.Pos(), "cannot migrate conversion %s: Go can't convert between real and complex numbers, and %s may be either", types.ExprString(call), param.Name())
+				continue
+			}
+			m.real[param] = true
+		}
+		return true
+	})
+}
+
+// numParam returns the type parameter declaring the restrictions of typ, if typ is a type
+// parameter restricted to numbers.
+func (m *migration) numParam(typ types.Type) *types.TypeParam {
+	param, ok := typ.(*types.TypeParam)
+	if !ok || param.Restriction()&types.RestrictionNum == 0 {
+		return nil
+	}
+	if declared, ok := m.recvParams[param]; ok {
+		return declared
+	}
+	return param
+}
+
+// migrateCall puts the type arguments of instances, and the unnamed type arguments of generic
+// calls, in brackets.
+func (m *migration) migrateCall(f *migratedFile, call *ast.CallExpr) {
+	if m.isInstance(call) {
+		f.replace(call.Lparen, call.Lparen+1, "[")
+		f.replace(call.Rparen, call.Rparen+1, "]")
+		return
+	}
+
+	genCall, ok := m.info.GenericCalls[call]
+	if !ok || genCall.NumUnnamed == 0 {
+		return
+	}
+	next := call.Rparen
+	if genCall.NumUnnamed < len(call.Args) {
+		next = call.Args[genCall.NumUnnamed].Pos()
+	}
+	f.replace(call.Lparen, call.Lparen+1, "[")
+	f.replace(call.Args[genCall.NumUnnamed-1].End(), next, "](")
+}
+
+// isInstance reports whether a call is an instance of a generic type, like List(int).
+func (m *migration) isInstance(call *ast.CallExpr) bool {
+	var ident *ast.Ident
+	switch fun := unparen(call.Fun).(type) {
+	case *ast.Ident:
+		ident = fun
+	case *ast.SelectorExpr:
+		ident = fun.Sel
+	}
+	typeName, ok := m.info.Uses[ident].(*types.TypeName)
+	if !ok {
+		return false
+	}
+	named, ok := typeName.Type().(*types.Named)
+	return ok && named.NumParams() > 0
+}
+
+// importCmp adds the cmp package to the imports of a file.
+func (m *migration) importCmp(f *migratedFile, file *ast.File) {
+	for _, spec := range file.Imports {
+		if spec.Path.Value == `"cmp"` && spec.Name == nil {
+			return
+		}
+	}
+	for _, decl := range file.Decls {
+		decl, ok := decl.(*ast.GenDecl)
+		if !ok || decl.Tok != token.IMPORT {
+			continue
+		}
+		if decl.Lparen.IsValid() {
+			f.replace(decl.Lparen+1, decl.Lparen+1, "\n\t\"cmp\"")
+			return
+		}
+		spec := decl.Specs[0]
+		f.replace(spec.Pos(), spec.Pos(), "(\n\t\"cmp\"\n\t")
+		f.replace(spec.End(), spec.End(), "\n)")
+		return
+	}
+	f.replace(file.Name.End(), file.Name.End(), "\n\nimport \"cmp\"")
+}
+
+// replace replaces the source from start to end with text.
+func (f *migratedFile) replace(start, end token.Pos, text string) {
+	f.edits = append(f.edits, edit{f.file.Offset(start), f.file.Offset(end), text})
+}
+
+// restrictionEnd returns the position after the restrictions of a type parameter, like after
+// ord in type T ord, or after Lener in type T eq Lener.
+func (f *migratedFile) restrictionEnd(param *ast.TypeParam) token.Pos {
+	end := f.file.Offset(param.End())
+	for offset := end; ; {
+		for offset < len(f.src) && (f.src[offset] == ' ' || f.src[offset] == '\t') {
+			offset++
+		}
+		word := offset
+		for offset < len(f.src) && 'a' <= f.src[offset] && f.src[offset] <= 'z' {
+			offset++
+		}
+		switch string(f.src[word:offset]) {
+		case "eq", "ord", "num", "integer":
+			end = offset
+			continue
+		}
+		return f.file.Pos(end)
+	}
+}
+
+// apply returns the source with all edits applied. Edits don't overlap, and ones at the same
+// position are applied in the order they were made.
+func (f *migratedFile) apply() []byte {
+	sort.SliceStable(f.edits, func(i, j int) bool {
+		return f.edits[i].start < f.edits[j].start
+	})
+	var out []byte
+	offset := 0
+	for _, e := range f.edits {
+		out = append(out, f.src[offset:e.start]...)
+		out = append(out, e.text...)
+		offset = e.end
+	}
+	return append(out, f.src[offset:]...)
+}
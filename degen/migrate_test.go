@@ -0,0 +1,99 @@
+package degen_test
+
+import (
+	"bytes"
+	"flag"
+	goast "go/ast"
+	goimporter "go/importer"
+	goparser "go/parser"
+	gotoken "go/token"
+	gotypes "go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/faiface/generics/degen"
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/parser"
+	"github.com/faiface/generics/go/token"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the migrate tests")
+
+// TestMigrate migrates each source in testdata/migrate and compares the output with the golden
+// file next to it. The output must type-check with the go/types package of the toolchain, which
+// knows Go's own type parameters.
+func TestMigrate(t *testing.T) {
+	filenames, err := filepath.Glob(filepath.Join("testdata", "migrate", "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range filenames {
+		t.Run(strings.TrimSuffix(filepath.Base(filename), ".go"), func(t *testing.T) {
+			src, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := degen.Migrate(fset, degen.NewImporter(fset), []*ast.File{file}, [][]byte{src})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := strings.TrimSuffix(filename, ".go") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, output[0], 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(output[0], want) {
+				t.Errorf("got:\n%s\nwant:\n%s", output[0], want)
+			}
+
+			gofset := gotoken.NewFileSet()
+			gofile, err := goparser.ParseFile(gofset, filename, output[0], 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conf := gotypes.Config{Importer: goimporter.ForCompiler(gofset, "source", nil)}
+			if _, err := conf.Check("main", gofset, []*goast.File{gofile}, nil); err != nil {
+				t.Errorf("migrated source doesn't type-check: %v", err)
+			}
+		})
+	}
+}
+
+// TestMigrateErrors checks that code Go has no equivalent for is reported.
+func TestMigrateErrors(t *testing.T) {
+	tests := map[string]string{
+		"length":  "func First(a [const n]int) int { return a[0] }\n\nfunc main() { First([2]int{}) }\n",
+		"complex": "func C(x type T num) complex128 { return complex128(x) }\n\nfunc main() { C(1i) }\n",
+	}
+	wants := map[string]string{
+		"length":  "cannot migrate generic array length n",
+		"complex": "cannot migrate conversion complex128(x)",
+	}
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			src := "package main\n\n" + src
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, name+".go", src, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := degen.Migrate(fset, degen.NewImporter(fset), []*ast.File{file}, [][]byte{[]byte(src)})
+			if output != nil || err == nil || !strings.Contains(err.Error(), wants[name]) {
+				t.Errorf("got error %v, want one containing %q", err, wants[name])
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package degen
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/faiface/generics/go/types"
+)
+
+// Mangling is a scheme for naming instantiated declarations.
+type Mangling int
+
+const (
+	// Readable names spell out the type arguments, like Map_int_string or Sum_slice_float64.
+	Readable Mangling = iota
+
+	// Hashed names end with a hash of the type arguments, like Map_3f2a9c1e, which keeps names of
+	// instances with large type arguments short.
+	Hashed
+)
+
+// namer gives each instance a name that's unique in the package, and the same name each time it's
+// asked about the same instance.
+type namer struct {
+	mangling Mangling
+	taken    map[string]bool   // names declared by the package, or given to instances
+	names    map[string]string // names of instances by their keys
+}
+
+func newNamer(mangling Mangling) *namer {
+	return &namer{
+		mangling: mangling,
+		taken:    make(map[string]bool),
+		names:    make(map[string]string),
+	}
+}
+
+// name returns the name of the instance identified by key. The first time, it's readable, or
+// hashed, depending on the mangling, and numbered if it clashes with a name that's already taken,
+// like Reverse_int_2 when the package declares its own Reverse_int.
+func (n *namer) name(key, readable, decl string) string {
+	if name, ok := n.names[key]; ok {
+		return name
+	}
+
+	base := readable
+	if n.mangling == Hashed {
+		sum := sha256.Sum256([]byte(key))
+		base = fmt.Sprintf("%s_%x", decl, sum[:4])
+	}
+	return n.unique(key, base)
+}
+
+// unique returns the name of the declaration identified by key, which is base the first time,
+// numbered if base is already taken. It's used for declarations named after other ones, like
+// dictionaries, which need no mangling of their own.
+func (n *namer) unique(key, base string) string {
+	if name, ok := n.names[key]; ok {
+		return name
+	}
+
+	name := base
+	for i := 2; n.taken[name]; i++ {
+		name = base + "_" + strconv.Itoa(i)
+	}
+
+	n.taken[name] = true
+	n.names[key] = name
+	return name
+}
+
+// instKey identifies a generic declaration instantiated with the type arguments, which are sorted
+// by their parameters. Types are spelled out with full import paths, so different types never share
+// a key, even if their readable names are the same.
+func instKey(cfg *config, decl string, params []*types.TypeParam, args []types.Type) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s.%s(", cfg.src.pkg.Path(), decl)
+	for i, param := range params {
+		if i > 0 {
+			fmt.Fprintf(&b, "; ")
+		}
+		if param.Length() != nil {
+			fmt.Fprintf(&b, "%d", args[i].(*types.Array).Len())
+			continue
+		}
+		fmt.Fprintf(&b, "%s", types.TypeString(args[i], func(pkg *types.Package) string {
+			return strconv.Quote(pkg.Path())
+		}))
+	}
+	fmt.Fprintf(&b, ")")
+	return b.String()
+}
@@ -0,0 +1,449 @@
+package degen
+
+import (
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
+)
+
+// shapeOf returns the shape of a type argument: a type of the same memory layout, which supports
+// the same operations inside of generic code. All pointers have the shape unsafe.Pointer, named
+// types have the shapes of their underlying types, and slices, arrays, maps, and channels are made
+// of shapes. Structs, interfaces, functions, and instances of generic types are their own shapes.
+func shapeOf(t types.Type) types.Type {
+	switch t.(type) {
+	case *types.TypeParam, *types.Instance:
+		return t
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return u
+	case *types.Pointer:
+		return types.Typ[types.UnsafePointer]
+	case *types.Array:
+		return types.NewArray(shapeOf(u.Elem()), u.Len())
+	case *types.Slice:
+		return types.NewSlice(shapeOf(u.Elem()))
+	case *types.Map:
+		return types.NewMap(shapeOf(u.Key()), shapeOf(u.Elem()))
+	case *types.Chan:
+		return types.NewChan(u.Dir(), shapeOf(u.Elem()))
+	}
+	return t
+}
+
+// shapeMapping returns the mapping of the instance sharing its code with the instance of a
+// generic function, or of a method of a generic type, for mapping: each type argument replaced
+// by its shape. Type arguments for type parameters restricted by an interface keep their methods,
+// so they aren't replaced. It reports false if the instance must be instantiated by itself, because
+// its type arguments already are shapes, or because the generic code can't be shared.
+func shapeMapping(cfg *config, fdecl *ast.FuncDecl, mapping map[*types.TypeParam]types.Type) (map[*types.TypeParam]types.Type, bool) {
+	shape := make(map[*types.TypeParam]types.Type)
+	changed := false
+	for param, typ := range mapping {
+		shape[param] = typ
+		if param.Length() == nil && param.Interface() == nil {
+			shape[param] = shapeOf(typ)
+		}
+		changed = changed || !types.Identical(shape[param], typ)
+	}
+	if !changed || len(fdecl.ConstParams) > 0 || !shapeable(cfg, cfg.src, fdecl) {
+		return nil, false
+	}
+	return shape, true
+}
+
+// shapeable reports whether instances of a generic function, or of a method of a generic type,
+// can share the code of the instance for the shapes of their type arguments. They can't if the
+// code, or any generic code it uses with its type parameters, converts values of types depending
+// on them to interfaces, or asserts them back, because the dynamic types would be the shapes.
+func shapeable(cfg *config, src *source, fdecl *ast.FuncDecl) bool {
+	if ok, done := cfg.shapeable[fdecl]; done {
+		return ok
+	}
+	ok := !boxes(cfg, src, fdecl, make(map[*ast.FuncDecl]bool))
+	cfg.shapeable[fdecl] = ok
+	return ok
+}
+
+// boxes reports whether a generic function or method, or generic code it uses with its type
+// parameters, converts values of types depending on them to interfaces, or asserts them back.
+// Declarations in visited have already been checked.
+func boxes(cfg *config, src *source, fdecl *ast.FuncDecl, visited map[*ast.FuncDecl]bool) bool {
+	if visited[fdecl] {
+		return false
+	}
+	visited[fdecl] = true
+
+	info := src.info
+	typeOf := func(e ast.Expr) types.Type {
+		if e == nil {
+			return nil
+		}
+		return info.TypeOf(e)
+	}
+
+	found := false
+	var funcs []*types.Signature // signatures of the enclosing functions, innermost last
+	var stack []ast.Node
+	ast.Inspect(fdecl, func(node ast.Node) bool {
+		if node == nil {
+			if _, ok := stack[len(stack)-1].(*ast.FuncLit); ok {
+				funcs = funcs[:len(funcs)-1]
+			}
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		if found {
+			return false
+		}
+		stack = append(stack, node)
+
+		switch node := node.(type) {
+		case *ast.FuncDecl:
+			funcs = append(funcs, info.Defs[node.Name].Type().(*types.Signature))
+
+		case *ast.FuncLit:
+			funcs = append(funcs, info.TypeOf(node).(*types.Signature))
+
+		case *ast.AssignStmt:
+			found = boxesAssign(info, node.Lhs, node.Rhs)
+
+		case *ast.ValueSpec:
+			if node.Type != nil {
+				var lhs []ast.Expr
+				for _, name := range node.Names {
+					lhs = append(lhs, name)
+				}
+				found = boxesAssign(info, lhs, node.Values)
+			}
+
+		case *ast.ReturnStmt:
+			results := funcs[len(funcs)-1].Results()
+			if len(node.Results) == 1 && results.Len() > 1 {
+				found = boxesTuple(typeOf(node.Results[0]).(*types.Tuple), results)
+				break
+			}
+			for i, result := range node.Results {
+				found = found || boxing(typeOf(result), results.At(i).Type())
+			}
+
+		case *ast.CallExpr:
+			found = boxesCall(cfg, info, node, visited)
+
+		case *ast.CompositeLit:
+			for i, elt := range node.Elts {
+				var key, value ast.Expr = nil, elt
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					key, value = kv.Key, kv.Value
+				}
+				switch u := typeOf(node).Underlying().(type) {
+				case *types.Slice:
+					found = found || boxing(typeOf(value), u.Elem())
+				case *types.Array:
+					found = found || boxing(typeOf(value), u.Elem())
+				case *types.Map:
+					found = found || boxing(typeOf(key), u.Key()) || boxing(typeOf(value), u.Elem())
+				case *types.Struct:
+					field := u.Field(i)
+					if key != nil {
+						for j := 0; j < u.NumFields(); j++ {
+							if u.Field(j).Name() == key.(*ast.Ident).Name {
+								field = u.Field(j)
+							}
+						}
+					}
+					found = found || boxing(typeOf(value), field.Type())
+				}
+			}
+
+		case *ast.SendStmt:
+			if ch, ok := typeOf(node.Chan).Underlying().(*types.Chan); ok {
+				found = boxing(typeOf(node.Value), ch.Elem())
+			}
+
+		case *ast.IndexExpr:
+			if m, ok := typeOf(node.X).Underlying().(*types.Map); ok {
+				found = boxing(typeOf(node.Index), m.Key())
+			}
+
+		case *ast.BinaryExpr:
+			found = boxing(typeOf(node.X), typeOf(node.Y)) || boxing(typeOf(node.Y), typeOf(node.X))
+
+		case *ast.TypeAssertExpr:
+			found = node.Type != nil && dependsOnAny(typeOf(node.Type))
+
+		case *ast.CaseClause:
+			for _, e := range node.List {
+				found = found || info.Types[e].IsType() && dependsOnAny(typeOf(e))
+			}
+
+		case *ast.SelectorExpr:
+			// methods of instances of generic types are shared with the shapes too
+			sel := info.Selections[node]
+			if sel == nil || sel.Kind() == types.FieldVal || !dependsOnAny(sel.Recv()) {
+				break
+			}
+			recv := sel.Recv()
+			if ptr, ok := recv.(*types.Pointer); ok {
+				recv = ptr.Elem()
+			}
+			if _, ok := recv.(*types.Instance); !ok {
+				break
+			}
+			methodSrc, method := methodDecl(cfg, recvNamed(recv), sel.Obj().Name())
+			found = method == nil || boxes(cfg, methodSrc, method, visited)
+		}
+		return !found
+	})
+	return found
+}
+
+// boxesAssign reports whether an assignment of rhs to lhs converts values of types depending
+// on type parameters to interfaces.
+func boxesAssign(info *types.Info, lhs, rhs []ast.Expr) bool {
+	if len(rhs) == 1 && len(lhs) > 1 {
+		var vars []*types.Var
+		for _, e := range lhs {
+			vars = append(vars, types.NewVar(token.NoPos, nil, "", info.TypeOf(e)))
+		}
+		return boxesTuple(info.TypeOf(rhs[0]).(*types.Tuple), types.NewTuple(vars...))
+	}
+	for i := range rhs {
+		if boxing(info.TypeOf(rhs[i]), info.TypeOf(lhs[i])) {
+			return true
+		}
+	}
+	return false
+}
+
+// boxesTuple reports whether assigning multiple values of the types from to variables of the
+// types to converts values of types depending on type parameters to interfaces.
+func boxesTuple(from, to *types.Tuple) bool {
+	for i := 0; i < from.Len(); i++ {
+		if boxing(from.At(i).Type(), to.At(i).Type()) {
+			return true
+		}
+	}
+	return false
+}
+
+// boxesCall reports whether a call converts values of types depending on type parameters to
+// interfaces, either by itself or inside of a generic function it calls with them.
+func boxesCall(cfg *config, info *types.Info, call *ast.CallExpr, visited map[*ast.FuncDecl]bool) bool {
+	tv := info.Types[call.Fun]
+	if tv.IsType() {
+		return len(call.Args) == 1 && boxing(info.TypeOf(call.Args[0]), tv.Type)
+	}
+
+	if ident, ok := unparen(call.Fun).(*ast.Ident); ok {
+		if builtin, ok := info.Uses[ident].(*types.Builtin); ok {
+			switch builtin.Name() {
+			case "panic":
+				return boxing(info.TypeOf(call.Args[0]), types.NewInterface(nil, nil))
+			case "append":
+				slice, ok := info.TypeOf(call.Args[0]).Underlying().(*types.Slice)
+				if !ok || call.Ellipsis.IsValid() {
+					return false
+				}
+				for _, arg := range call.Args[1:] {
+					if boxing(info.TypeOf(arg), slice.Elem()) {
+						return true
+					}
+				}
+			case "delete":
+				m, ok := info.TypeOf(call.Args[0]).Underlying().(*types.Map)
+				return ok && boxing(info.TypeOf(call.Args[1]), m.Key())
+			}
+			return false
+		}
+	}
+
+	args := call.Args
+	if genCall, ok := info.GenericCalls[call]; ok {
+		args = args[genCall.NumUnnamed:]
+		for _, typ := range genCall.Mapping {
+			if !dependsOnAny(typ) {
+				continue
+			}
+			calleeSrc, callee := funcDecl(cfg, info, call.Fun)
+			if callee == nil || boxes(cfg, calleeSrc, callee, visited) {
+				return true
+			}
+			break
+		}
+	}
+
+	sig, ok := info.TypeOf(call.Fun).Underlying().(*types.Signature)
+	if !ok {
+		return false
+	}
+	params := sig.Params()
+	for i, arg := range args {
+		if len(args) == 1 && params.Len() > 1 {
+			return boxesTuple(info.TypeOf(arg).(*types.Tuple), params)
+		}
+		var param types.Type
+		switch {
+		case sig.Variadic() && i >= params.Len()-1 && !call.Ellipsis.IsValid():
+			param = params.At(params.Len() - 1).Type().(*types.Slice).Elem()
+		case i < params.Len():
+			param = params.At(i).Type()
+		}
+		if boxing(info.TypeOf(arg), param) {
+			return true
+		}
+	}
+	return false
+}
+
+// boxing reports whether assigning a value of type from to a variable of type to converts a
+// value of a type depending on type parameters to an interface.
+func boxing(from, to types.Type) bool {
+	if from == nil || to == nil || !dependsOnAny(from) {
+		return false
+	}
+	_, fromInterface := from.Underlying().(*types.Interface)
+	_, toInterface := to.Underlying().(*types.Interface)
+	return toInterface && !fromInterface
+}
+
+// dependsOnAny reports whether t refers to any type parameter.
+func dependsOnAny(t types.Type) bool {
+	return dependsOn(t, func(*types.TypeParam) bool { return true })
+}
+
+// funcDecl finds the declaration of the generic function called by fun, along with the package
+// that declares it, or returns nil if its source is not available.
+func funcDecl(cfg *config, info *types.Info, fun ast.Expr) (*source, *ast.FuncDecl) {
+	var ident *ast.Ident
+	switch fun := unparen(fun).(type) {
+	case *ast.Ident:
+		ident = fun
+	case *ast.SelectorExpr:
+		ident = fun.Sel
+	}
+	obj := info.Uses[ident]
+	if obj == nil || cfg.sources[obj.Pkg()] == nil {
+		return nil, nil
+	}
+	src := cfg.sources[obj.Pkg()]
+	fdecl, _ := src.decls[obj].(*ast.FuncDecl)
+	return src, fdecl
+}
+
+// methodDecl finds the declaration of a method of a generic type, along with the package that
+// declares it, or returns nil if its source is not available.
+func methodDecl(cfg *config, named *types.Named, name string) (*source, *ast.FuncDecl) {
+	src := cfg.sources[named.Obj().Pkg()]
+	if src == nil {
+		return nil, nil
+	}
+	for _, file := range src.files {
+		for _, decl := range file.Decls {
+			fdecl, ok := decl.(*ast.FuncDecl)
+			if !ok || fdecl.Recv.NumFields() == 0 || len(fdecl.TypeParams) == 0 || fdecl.Name.Name != name {
+				continue
+			}
+			recv := src.info.Defs[fdecl.Name].Type().(*types.Signature).Recv().Type()
+			if recvNamed(recv) == named {
+				return src, fdecl
+			}
+		}
+	}
+	return nil, nil
+}
+
+// emitShapeInstance emits an instance of a generic function, or of a method of a generic type,
+// which calls the instance for the shapes of its type arguments: a function, or a method of
+// recv, named name, which converts its parameters to the shapes and the results back. The
+// shape instance is instantiated like any other.
+func emitShapeInstance(cfg *config, fdecl *ast.FuncDecl, mapping, shape map[*types.TypeParam]types.Type, numUnnamed int, name string, recv ast.Expr) {
+	sig := cfg.info.Defs[fdecl.Name].Type().(*types.Signature)
+	instSig := types.MapType(mapping, sig).(*types.Signature)
+	shapeSig := types.MapType(shape, sig).(*types.Signature)
+
+	params, results := localNames(cfg, "p"), localNames(cfg, "r")
+	call := &ast.CallExpr{}
+	var recvList *ast.FieldList
+	if recv == nil {
+		genCall := &types.GenericCall{NumUnnamed: numUnnamed, Mapping: shape}
+		call.Fun = &ast.Ident{Name: instFuncDecl(cfg, genCall, fdecl, fdecl.Pos())}
+	} else {
+		recvName := localName(cfg, "recv")
+		recvList = &ast.FieldList{List: []*ast.Field{{
+			Names: []*ast.Ident{{Name: recvName}},
+			Type:  recv,
+		}}}
+		instRecv := types.MapType(mapping, sig.Recv().Type())
+		shapeRecv := types.MapType(shape, sig.Recv().Type())
+		call.Fun = &ast.SelectorExpr{
+			X:   &ast.ParenExpr{X: convertShape(cfg, &ast.Ident{Name: recvName}, instRecv, shapeRecv)},
+			Sel: &ast.Ident{Name: fdecl.Name.Name},
+		}
+	}
+
+	paramList := &ast.FieldList{}
+	for i := 0; i < instSig.Params().Len(); i++ {
+		instParam, shapeParam := instSig.Params().At(i).Type(), shapeSig.Params().At(i).Type()
+		typ := typeToExpr(cfg, instParam)
+		if instSig.Variadic() && i == instSig.Params().Len()-1 {
+			typ = &ast.Ellipsis{Elt: typeToExpr(cfg, instParam.(*types.Slice).Elem())}
+			call.Ellipsis = fdecl.Type.Params.Closing
+		}
+		paramList.List = append(paramList.List, &ast.Field{
+			Names: []*ast.Ident{{Name: params(i)}},
+			Type:  typ,
+		})
+		call.Args = append(call.Args, convertShape(cfg, &ast.Ident{Name: params(i)}, instParam, shapeParam))
+	}
+	resultList := &ast.FieldList{}
+	for i := 0; i < instSig.Results().Len(); i++ {
+		resultList.List = append(resultList.List, &ast.Field{
+			Type: typeToExpr(cfg, instSig.Results().At(i).Type()),
+		})
+	}
+
+	var body []ast.Stmt
+	if instSig.Results().Len() == 0 {
+		body = []ast.Stmt{&ast.ExprStmt{X: call}}
+	} else {
+		assign := &ast.AssignStmt{Tok: token.DEFINE, Rhs: []ast.Expr{call}}
+		ret := &ast.ReturnStmt{}
+		for i := 0; i < instSig.Results().Len(); i++ {
+			assign.Lhs = append(assign.Lhs, &ast.Ident{Name: results(i)})
+			ret.Results = append(ret.Results, convertShape(cfg, &ast.Ident{Name: results(i)}, shapeSig.Results().At(i).Type(), instSig.Results().At(i).Type()))
+		}
+		body = []ast.Stmt{assign, ret}
+	}
+
+	cfg.output.Decls = append(cfg.output.Decls, &ast.FuncDecl{
+		Doc:  instDoc(cfg, fdecl, mapping),
+		Recv: recvList,
+		Name: &ast.Ident{Name: name},
+		Type: &ast.FuncType{Params: paramList, Results: resultList},
+		Body: &ast.BlockStmt{List: body},
+	})
+}
+
+// convertShape converts the variable x of type from to the type to, which has the same memory
+// layout. Types that can't be converted, like []*T and []unsafe.Pointer, are converted through
+// a pointer to x.
+func convertShape(cfg *config, x *ast.Ident, from, to types.Type) ast.Expr {
+	unsafePointer := func(x ast.Expr) ast.Expr {
+		return &ast.CallExpr{Fun: typeToExpr(cfg, types.Typ[types.UnsafePointer]), Args: []ast.Expr{x}}
+	}
+	switch {
+	case types.Identical(from, to):
+		return x
+	case types.ConvertibleTo(from, to):
+		return &ast.CallExpr{Fun: &ast.ParenExpr{X: typeToExpr(cfg, to)}, Args: []ast.Expr{x}}
+	case isPointer(from) && isPointer(to):
+		return &ast.CallExpr{Fun: &ast.ParenExpr{X: typeToExpr(cfg, to)}, Args: []ast.Expr{unsafePointer(x)}}
+	}
+	return &ast.StarExpr{X: &ast.CallExpr{
+		Fun:  &ast.ParenExpr{X: &ast.StarExpr{X: typeToExpr(cfg, to)}},
+		Args: []ast.Expr{unsafePointer(&ast.UnaryExpr{Op: token.AND, X: x})},
+	}}
+}
@@ -0,0 +1,88 @@
+package degen_test
+
+import (
+	"testing"
+
+	"github.com/faiface/generics/degen"
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/types"
+)
+
+const shapeSrc = `package main
+
+import "fmt"
+
+type Person struct{ Name string }
+
+type Item struct{ ID int }
+
+type Celsius int64
+
+func Reverse(xs []type T) {
+	for i, j := 0, len(xs)-1; i < j; i, j = i+1, j-1 {
+		xs[i], xs[j] = xs[j], xs[i]
+	}
+}
+
+func Show(x type T) string { return fmt.Sprint(x) }
+
+func main() {
+	Reverse([]*Person{{"a"}, {"b"}})
+	Reverse([]*Item{{1}, {2}})
+	Reverse([]Celsius{1, 2})
+	Reverse([]int64{1, 2})
+	println(Show(&Person{"a"}), Show(&Item{1}))
+}
+`
+
+// TestShapeSharing checks that instances whose type arguments have the same shape share one
+// instance for the shape, like Reverse_unsafe_Pointer for all pointers, which is instantiated only
+// once, and that functions converting values of their type parameters to interfaces don't share.
+func TestShapeSharing(t *testing.T) {
+	_, _, file, _ := translateChecked(t, "shape", shapeSrc, degen.Shape)
+	funcs := funcDecls(file)
+
+	shapes := map[string]string{
+		"Reverse_ptr_Person": "Reverse_unsafe_Pointer",
+		"Reverse_ptr_Item":   "Reverse_unsafe_Pointer",
+		"Reverse_Celsius":    "Reverse_int64",
+	}
+	for inst, shape := range shapes {
+		fdecl := funcs[inst]
+		if fdecl == nil {
+			t.Errorf("no instance %s", inst)
+			continue
+		}
+		if len(fdecl.Body.List) != 1 || onlyCall(fdecl.Body, shape) == nil {
+			t.Errorf("%s doesn't just call %s", inst, shape)
+		}
+	}
+
+	// each shape is instantiated once, even when it's also a type argument, like int64
+	count := make(map[string]int)
+	for _, decl := range file.Decls {
+		if fdecl, ok := decl.(*ast.FuncDecl); ok {
+			count[fdecl.Name.Name]++
+		}
+	}
+	for _, shape := range []string{"Reverse_unsafe_Pointer", "Reverse_int64"} {
+		if count[shape] != 1 {
+			t.Errorf("%s is declared %d times, want once", shape, count[shape])
+		}
+	}
+
+	// Show would print the shape instead of the type argument
+	if funcs["Show_unsafe_Pointer"] != nil {
+		t.Errorf("Show shares its code with Show_unsafe_Pointer")
+	}
+	for _, inst := range []string{"Show_ptr_Person", "Show_ptr_Item"} {
+		fdecl := funcs[inst]
+		if fdecl == nil || len(fdecl.Body.List) != 1 {
+			t.Errorf("%s isn't an instance of its own", inst)
+			continue
+		}
+		if ret, ok := fdecl.Body.List[0].(*ast.ReturnStmt); !ok || types.ExprString(ret.Results[0]) != "fmt.Sprint(x)" {
+			t.Errorf("%s isn't an instance of its own", inst)
+		}
+	}
+}
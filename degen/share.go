@@ -0,0 +1,1243 @@
+package degen
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/constant"
+	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
+)
+
+// sharer translates the body of a generic function into its shared implementation. Code that
+// doesn't depend on the type parameters is copied as it is. Operations on values of types
+// depending on them are moved into the dictionary.
+type sharer struct {
+	cfg     *config
+	info    *types.Info
+	sh      *shared
+	none    map[*types.TypeParam]types.Type // mapping of code that doesn't depend on the type parameters
+	dict    string                          // name of the dictionary parameter
+	used    map[string]bool                 // identifiers of the generic function
+	results *types.Tuple                    // results of the innermost function being translated
+}
+
+// unsupported aborts translating a function that can't be shared, which gets monomorphized
+// instead.
+type unsupported struct {
+	what string
+}
+
+// shareFuncDecl translates a generic function into its shared implementation, adding the
+// operations it needs to sh. The shared function is left unnamed, and so is the type of its
+// dictionary parameter. It reports false if the function can't be shared.
+func shareFuncDecl(cfg *config, sh *shared, fdecl *ast.FuncDecl) (decl *ast.FuncDecl, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, isUnsupported := r.(unsupported); !isUnsupported {
+				panic(r)
+			}
+			decl, ok = nil, false
+		}
+	}()
+
+	s := &sharer{
+		cfg:  cfg,
+		info: cfg.info,
+		sh:   sh,
+		none: make(map[*types.TypeParam]types.Type),
+		used: make(map[string]bool),
+	}
+	ast.Inspect(fdecl, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Ident); ok {
+			s.used[ident.Name] = true
+		}
+		return true
+	})
+	s.dict = s.fresh("dict")
+
+	sig := s.info.Defs[fdecl.Name].Type().(*types.Signature)
+	params := &ast.FieldList{List: []*ast.Field{{
+		Names: []*ast.Ident{{Name: s.dict}},
+	}}}
+	if sig.Recv() != nil {
+		params.List = append(params.List, s.param(sig.Recv(), false))
+	}
+	for i := 0; i < sig.Params().Len(); i++ {
+		params.List = append(params.List, s.param(sig.Params().At(i), sig.Variadic() && i == sig.Params().Len()-1))
+	}
+
+	var (
+		results = &ast.FieldList{}
+		body    []ast.Stmt
+	)
+	for i := 0; i < sig.Results().Len(); i++ {
+		result := sig.Results().At(i)
+		field := &ast.Field{Type: sh.sharedType(cfg, result.Type())}
+		if result.Name() != "" {
+			field.Names = []*ast.Ident{{Name: result.Name()}}
+		}
+		results.List = append(results.List, field)
+
+		// named results start out as zero values of their types in the instance
+		if result.Name() != "" && result.Name() != "_" && sh.dep(result.Type()) {
+			body = append(body, &ast.AssignStmt{
+				Lhs: []ast.Expr{&ast.Ident{Name: result.Name()}},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{s.zero(result.Type())},
+			})
+		}
+	}
+
+	s.results = sig.Results()
+	body = append(body, s.stmts(fdecl.Body.List)...)
+
+	return &ast.FuncDecl{
+		Name: &ast.Ident{},
+		Type: &ast.FuncType{Params: params, Results: results},
+		Body: &ast.BlockStmt{List: body},
+	}, true
+}
+
+// fresh returns a new identifier, which the generic function doesn't use.
+func (s *sharer) fresh(name string) string {
+	fresh := name
+	for i := 2; s.used[fresh]; i++ {
+		fresh = name + strconv.Itoa(i)
+	}
+	s.used[fresh] = true
+	return fresh
+}
+
+// param returns the shared parameter for a parameter of the generic function.
+func (s *sharer) param(v *types.Var, variadic bool) *ast.Field {
+	name := v.Name()
+	if name == "" {
+		name = "_"
+	}
+	field := &ast.Field{
+		Names: []*ast.Ident{{Name: name}},
+		Type:  s.sh.sharedType(s.cfg, v.Type()),
+	}
+	if variadic && !s.sh.dep(v.Type()) {
+		field.Type = &ast.Ellipsis{Elt: typeToExpr(s.cfg, v.Type().(*types.Slice).Elem())}
+	}
+	return field
+}
+
+// depExpr reports whether the type of an expression depends on the type parameters.
+func (s *sharer) depExpr(e ast.Expr) bool {
+	if e == nil {
+		return false
+	}
+	t := s.info.TypeOf(e)
+	return t != nil && s.sh.dep(t)
+}
+
+// involves reports whether any part of node depends on the type parameters.
+func (s *sharer) involves(node ast.Node) bool {
+	found := false
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.TypeParam:
+			found = true
+		case ast.Expr:
+			found = found || s.depExpr(node)
+		}
+		return !found
+	})
+	return found
+}
+
+// isNil reports whether e is the predeclared nil.
+func (s *sharer) isNil(e ast.Expr) bool {
+	ident, ok := unparen(e).(*ast.Ident)
+	if !ok {
+		return false
+	}
+	_, ok = s.info.Uses[ident].(*types.Nil)
+	return ok
+}
+
+// unparen returns e without its parentheses.
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		paren, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = paren.X
+	}
+}
+
+// local reports whether t refers to a type declared inside of a function, which the dictionary
+// can't refer to.
+func local(t types.Type) bool {
+	switch t := t.(type) {
+	case *types.Named:
+		obj := t.Obj()
+		return obj.Pkg() != nil && obj.Parent() != obj.Pkg().Scope()
+	case *types.Array:
+		return local(t.Elem())
+	case *types.Slice:
+		return local(t.Elem())
+	case *types.Pointer:
+		return local(t.Elem())
+	case *types.Chan:
+		return local(t.Elem())
+	case *types.Map:
+		return local(t.Key()) || local(t.Elem())
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if local(t.Field(i).Type()) {
+				return true
+			}
+		}
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			if local(t.At(i).Type()) {
+				return true
+			}
+		}
+	case *types.Signature:
+		return local(t.Params()) || local(t.Results())
+	case *types.Instance:
+		for i := 0; i < t.NumArgs(); i++ {
+			if local(t.Arg(i)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// call adds an operation to the dictionary and returns a call of it with args.
+func (s *sharer) call(o *op, args []ast.Expr) *ast.CallExpr {
+	for i, t := range o.params {
+		o.params[i] = types.Default(t)
+	}
+	for i, t := range o.results {
+		o.results[i] = types.Default(t)
+	}
+	for _, t := range append(append([]types.Type(nil), o.params...), o.results...) {
+		if _, ok := t.(*types.Tuple); ok {
+			panic(unsupported{"passes multiple values to an operation"})
+		}
+		if local(t) {
+			panic(unsupported{"refers to a local type"})
+		}
+	}
+
+	name := fmt.Sprintf("op%d", len(s.sh.ops))
+	s.sh.ops = append(s.sh.ops, o)
+	return &ast.CallExpr{
+		Fun: &ast.SelectorExpr{
+			X:   &ast.Ident{Name: s.dict},
+			Sel: &ast.Ident{Name: name},
+		},
+		Args: args,
+	}
+}
+
+// zero returns the zero value of t from the dictionary.
+func (s *sharer) zero(t types.Type) ast.Expr {
+	return s.call(&op{
+		results: []types.Type{t},
+		body: func(cfg *config, mapping map[*types.TypeParam]types.Type, _ []ast.Expr) []ast.Stmt {
+			return []ast.Stmt{&ast.ReturnStmt{Results: []ast.Expr{&ast.StarExpr{X: &ast.CallExpr{
+				Fun:  &ast.Ident{Name: "new"},
+				Args: []ast.Expr{typeToExpr(cfg, types.MapType(mapping, t))},
+			}}}}}
+		},
+	}, nil)
+}
+
+// convert translates e, which is assigned to a variable of type to, or to the blank identifier
+// if to is nil. Values of types depending on the type parameters are converted by the
+// dictionary, if to doesn't depend on them.
+func (s *sharer) convert(e ast.Expr, to types.Type) ast.Expr {
+	from := s.info.TypeOf(e)
+	if basic, ok := from.(*types.Basic); ok && basic.Info()&types.IsUntyped != 0 && to != nil && s.sh.dep(to) {
+		// untyped constants and nil get the type of the variable in the instance
+		return s.constant(e, to)
+	}
+	return s.convertShared(s.expr(e), from, to)
+}
+
+// constant returns the value of a constant or nil e, as a value of type t.
+func (s *sharer) constant(e ast.Expr, t types.Type) ast.Expr {
+	value := ast.Expr(&ast.Ident{Name: "nil"})
+	if tv := s.info.Types[e]; tv.Value != nil {
+		value = constLit(tv.Value)
+	}
+	if !s.sh.dep(t) {
+		return constExpr(s.cfg, s.none, t, value)
+	}
+	return s.call(&op{
+		results: []types.Type{t},
+		body: func(cfg *config, mapping map[*types.TypeParam]types.Type, _ []ast.Expr) []ast.Stmt {
+			return returnAll(cfg, constExpr(cfg, mapping, t, value), 1)
+		},
+	}, nil)
+}
+
+// convertShared converts x, a translated value of type from, to the type to. Values kept in
+// interface{} values are converted by the dictionary, unless the types are identical.
+func (s *sharer) convertShared(x ast.Expr, from, to types.Type) ast.Expr {
+	if to == nil || !s.sh.dep(from) && !s.sh.dep(to) || types.Identical(from, to) {
+		return x
+	}
+	return s.call(&op{
+		params:  []types.Type{from},
+		results: []types.Type{to},
+		body: func(cfg *config, mapping map[*types.TypeParam]types.Type, operands []ast.Expr) []ast.Stmt {
+			// the result is converted explicitly, in case it's kept in an interface{} value
+			return returnAll(cfg, &ast.CallExpr{
+				Fun:  &ast.ParenExpr{X: typeToExpr(cfg, types.MapType(mapping, to))},
+				Args: operands,
+			}, 1)
+		},
+	}, []ast.Expr{x})
+}
+
+// returnAll returns the statements returning all values of x, or evaluating it, if it has none.
+func returnAll(cfg *config, x ast.Expr, n int) []ast.Stmt {
+	switch n {
+	case 0:
+		return []ast.Stmt{&ast.ExprStmt{X: x}}
+	case 1:
+		return []ast.Stmt{&ast.ReturnStmt{Results: []ast.Expr{x}}}
+	}
+	names := localNames(cfg, "r")
+	assign := &ast.AssignStmt{Tok: token.DEFINE, Rhs: []ast.Expr{x}}
+	ret := &ast.ReturnStmt{}
+	for i := 0; i < n; i++ {
+		assign.Lhs = append(assign.Lhs, &ast.Ident{Name: names(i)})
+		ret.Results = append(ret.Results, &ast.Ident{Name: names(i)})
+	}
+	return []ast.Stmt{assign, ret}
+}
+
+func (s *sharer) block(block *ast.BlockStmt) *ast.BlockStmt {
+	return &ast.BlockStmt{List: s.stmts(block.List)}
+}
+
+func (s *sharer) stmts(stmts []ast.Stmt) []ast.Stmt {
+	var shared []ast.Stmt
+	for _, stmt := range stmts {
+		shared = append(shared, s.stmt(stmt))
+	}
+	return shared
+}
+
+// stmt translates a statement of the generic function.
+func (s *sharer) stmt(stmt ast.Stmt) ast.Stmt {
+	if stmt == nil {
+		return nil
+	}
+	if !s.involves(stmt) && !s.returnsDep(stmt) {
+		return instNode(s.cfg, s.none, stmt).(ast.Stmt)
+	}
+
+	switch stmt := stmt.(type) {
+	case *ast.BlockStmt:
+		return s.block(stmt)
+
+	case *ast.ExprStmt:
+		return &ast.ExprStmt{X: s.expr(stmt.X)}
+
+	case *ast.LabeledStmt:
+		return &ast.LabeledStmt{Label: instIdent(s.cfg, stmt.Label), Stmt: s.stmt(stmt.Stmt)}
+
+	case *ast.GoStmt:
+		return &ast.GoStmt{Call: s.expr(stmt.Call).(*ast.CallExpr)}
+
+	case *ast.DeferStmt:
+		return &ast.DeferStmt{Call: s.expr(stmt.Call).(*ast.CallExpr)}
+
+	case *ast.ReturnStmt:
+		ret := &ast.ReturnStmt{}
+		if len(stmt.Results) == 1 && s.results.Len() > 1 {
+			s.matchTuple(stmt.Results[0], s.results)
+			ret.Results = []ast.Expr{s.expr(stmt.Results[0])}
+			return ret
+		}
+		for i, result := range stmt.Results {
+			ret.Results = append(ret.Results, s.convert(result, s.results.At(i).Type()))
+		}
+		return ret
+
+	case *ast.IfStmt:
+		return &ast.IfStmt{
+			Init: s.stmt(stmt.Init),
+			Cond: s.expr(stmt.Cond),
+			Body: s.block(stmt.Body),
+			Else: s.stmt(stmt.Else),
+		}
+
+	case *ast.ForStmt:
+		return &ast.ForStmt{
+			Init: s.stmt(stmt.Init),
+			Cond: s.expr(stmt.Cond),
+			Post: s.stmt(stmt.Post),
+			Body: s.block(stmt.Body),
+		}
+
+	case *ast.SwitchStmt:
+		if s.depExpr(stmt.Tag) {
+			panic(unsupported{"switches on a value of a type depending on type parameters"})
+		}
+		body := &ast.BlockStmt{}
+		for _, clause := range stmt.Body.List {
+			clause := clause.(*ast.CaseClause)
+			body.List = append(body.List, &ast.CaseClause{
+				List: s.exprs(clause.List),
+				Body: s.stmts(clause.Body),
+			})
+		}
+		return &ast.SwitchStmt{
+			Init: s.stmt(stmt.Init),
+			Tag:  s.expr(stmt.Tag),
+			Body: body,
+		}
+
+	case *ast.RangeStmt:
+		return s.rangeStmt(stmt)
+
+	case *ast.DeclStmt:
+		return s.declStmt(stmt)
+
+	case *ast.AssignStmt:
+		return s.assignStmt(stmt)
+
+	case *ast.IncDecStmt, *ast.SendStmt:
+		return s.stmtOp(stmt)
+	}
+
+	panic(unsupported{fmt.Sprintf("has a %T depending on type parameters", stmt)})
+}
+
+// returnsDep reports whether stmt returns values to results of types depending on the type
+// parameters.
+func (s *sharer) returnsDep(stmt ast.Stmt) bool {
+	ret, ok := stmt.(*ast.ReturnStmt)
+	if !ok || len(ret.Results) == 0 {
+		return false
+	}
+	for i := 0; i < s.results.Len(); i++ {
+		if s.sh.dep(s.results.At(i).Type()) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTuple checks that multiple values of rhs can be assigned to variables of the types lhs,
+// without converting them. Nil types stand for the blank identifier.
+func (s *sharer) matchTuple(rhs ast.Expr, lhs *types.Tuple) {
+	tuple := s.info.TypeOf(rhs).(*types.Tuple)
+	for i := 0; i < tuple.Len(); i++ {
+		from, to := tuple.At(i).Type(), lhs.At(i).Type()
+		if to != nil && (s.sh.dep(from) || s.sh.dep(to)) && !types.Identical(from, to) {
+			panic(unsupported{"converts multiple values of types depending on type parameters"})
+		}
+	}
+}
+
+// lhsTuple returns the types of variables assigned to, with nil for the blank identifier.
+func (s *sharer) lhsTuple(lhs []ast.Expr) *types.Tuple {
+	var vars []*types.Var
+	for _, e := range lhs {
+		vars = append(vars, types.NewVar(token.NoPos, nil, "", s.info.TypeOf(e)))
+	}
+	return types.NewTuple(vars...)
+}
+
+func (s *sharer) assignStmt(stmt *ast.AssignStmt) ast.Stmt {
+	define := stmt.Tok == token.ASSIGN || stmt.Tok == token.DEFINE
+	for _, lhs := range stmt.Lhs {
+		ident, ok := lhs.(*ast.Ident)
+		if !ok || !define && s.depExpr(ident) {
+			return s.stmtOp(stmt)
+		}
+	}
+
+	assign := &ast.AssignStmt{Tok: stmt.Tok}
+	for _, lhs := range stmt.Lhs {
+		assign.Lhs = append(assign.Lhs, instNode(s.cfg, s.none, lhs).(ast.Expr))
+	}
+	switch {
+	case len(stmt.Lhs) != len(stmt.Rhs):
+		s.matchTuple(stmt.Rhs[0], s.lhsTuple(stmt.Lhs))
+		assign.Rhs = []ast.Expr{s.expr(stmt.Rhs[0])}
+	case define:
+		for i, rhs := range stmt.Rhs {
+			assign.Rhs = append(assign.Rhs, s.convert(rhs, s.info.TypeOf(stmt.Lhs[i])))
+		}
+	default:
+		assign.Rhs = s.exprs(stmt.Rhs)
+	}
+	return assign
+}
+
+func (s *sharer) declStmt(stmt *ast.DeclStmt) ast.Stmt {
+	decl := stmt.Decl.(*ast.GenDecl)
+	if decl.Tok != token.VAR {
+		panic(unsupported{"declares a constant or a type depending on type parameters"})
+	}
+
+	shared := &ast.GenDecl{Tok: token.VAR}
+	for _, spec := range decl.Specs {
+		spec := spec.(*ast.ValueSpec)
+		sharedSpec := &ast.ValueSpec{Names: instIdents(s.cfg, spec.Names)}
+
+		var typ types.Type
+		if spec.Type != nil {
+			typ = s.info.TypeOf(spec.Type)
+			sharedSpec.Type = s.sh.sharedType(s.cfg, typ)
+			if !s.sh.dep(typ) {
+				sharedSpec.Type = instNode(s.cfg, s.none, spec.Type).(ast.Expr)
+			}
+		}
+
+		switch {
+		case len(spec.Values) == len(spec.Names):
+			for _, value := range spec.Values {
+				sharedSpec.Values = append(sharedSpec.Values, s.convert(value, typ))
+			}
+		case len(spec.Values) > 0:
+			var lhs []ast.Expr
+			for _, name := range spec.Names {
+				lhs = append(lhs, name)
+			}
+			s.matchTuple(spec.Values[0], s.lhsTuple(lhs))
+			sharedSpec.Values = []ast.Expr{s.expr(spec.Values[0])}
+		case s.sh.dep(typ):
+			for range spec.Names {
+				sharedSpec.Values = append(sharedSpec.Values, s.zero(typ))
+			}
+		}
+		shared.Specs = append(shared.Specs, sharedSpec)
+	}
+	return &ast.DeclStmt{Decl: shared}
+}
+
+// rangeStmt translates a range statement. Ranging over a slice, an array, or a pointer to an
+// array of a type depending on the type parameters becomes a loop over the indices, with the
+// length and the elements from the dictionary. Ranging over such a channel becomes a loop
+// receiving from the dictionary.
+func (s *sharer) rangeStmt(stmt *ast.RangeStmt) ast.Stmt {
+	if !s.depExpr(stmt.X) {
+		return &ast.RangeStmt{
+			Key:   maybeNil(instNode(s.cfg, s.none, stmt.Key)),
+			Value: maybeNil(instNode(s.cfg, s.none, stmt.Value)),
+			Tok:   stmt.Tok,
+			X:     s.expr(stmt.X),
+			Body:  s.block(stmt.Body),
+		}
+	}
+
+	// the key and the value are assigned at the start of each iteration
+	var lhs, rhs []ast.Expr
+	assign := func(v ast.Expr, x ast.Expr, t types.Type) {
+		if v == nil {
+			return
+		}
+		if ident, ok := v.(*ast.Ident); !ok {
+			panic(unsupported{"ranges into an expression depending on type parameters"})
+		} else if ident.Name == "_" {
+			return
+		}
+		lhs = append(lhs, instNode(s.cfg, s.none, v).(ast.Expr))
+		if stmt.Tok == token.ASSIGN {
+			x = s.convertShared(x, t, s.info.TypeOf(v))
+		}
+		rhs = append(rhs, x)
+	}
+	body := func(pre ...ast.Stmt) *ast.BlockStmt {
+		block := &ast.BlockStmt{List: pre}
+		if len(lhs) > 0 {
+			block.List = append(block.List, &ast.AssignStmt{Lhs: lhs, Tok: stmt.Tok, Rhs: rhs})
+		}
+		block.List = append(block.List, s.block(stmt.Body))
+		return block
+	}
+
+	xType := s.info.TypeOf(stmt.X)
+	under := xType.Underlying()
+	if ptr, ok := under.(*types.Pointer); ok {
+		under = ptr.Elem().Underlying()
+	}
+	r := &ast.Ident{Name: s.fresh("r")}
+
+	switch under := under.(type) {
+	case *types.Slice, *types.Array:
+		var elem types.Type
+		if slice, ok := under.(*types.Slice); ok {
+			elem = slice.Elem()
+		} else {
+			elem = under.(*types.Array).Elem()
+		}
+		i := &ast.Ident{Name: s.fresh("i")}
+		length := s.call(&op{
+			params:  []types.Type{xType},
+			results: []types.Type{types.Typ[types.Int]},
+			body: func(cfg *config, mapping map[*types.TypeParam]types.Type, operands []ast.Expr) []ast.Stmt {
+				return returnAll(cfg, &ast.CallExpr{Fun: &ast.Ident{Name: "len"}, Args: operands}, 1)
+			},
+		}, []ast.Expr{r})
+		index := s.call(&op{
+			params:  []types.Type{xType, types.Typ[types.Int]},
+			results: []types.Type{elem},
+			body: func(cfg *config, mapping map[*types.TypeParam]types.Type, operands []ast.Expr) []ast.Stmt {
+				return returnAll(cfg, &ast.IndexExpr{X: operands[0], Index: operands[1]}, 1)
+			},
+		}, []ast.Expr{r, i})
+
+		assign(stmt.Key, i, types.Typ[types.Int])
+		assign(stmt.Value, index, elem)
+		return &ast.ForStmt{
+			Init: &ast.AssignStmt{
+				Lhs: []ast.Expr{r, i},
+				Tok: token.DEFINE,
+				Rhs: []ast.Expr{s.expr(stmt.X), &ast.BasicLit{Kind: token.INT, Value: "0"}},
+			},
+			Cond: &ast.BinaryExpr{X: i, Op: token.LSS, Y: length},
+			Post: &ast.IncDecStmt{X: i, Tok: token.INC},
+			Body: body(),
+		}
+
+	case *types.Chan:
+		v, ok := &ast.Ident{Name: s.fresh("v")}, &ast.Ident{Name: s.fresh("ok")}
+		recv := s.call(&op{
+			params:  []types.Type{xType},
+			results: []types.Type{under.Elem(), types.Typ[types.Bool]},
+			body: func(cfg *config, mapping map[*types.TypeParam]types.Type, operands []ast.Expr) []ast.Stmt {
+				return returnAll(cfg, &ast.UnaryExpr{Op: token.ARROW, X: operands[0]}, 2)
+			},
+		}, []ast.Expr{r})
+
+		received := ast.Expr(&ast.Ident{Name: "_"})
+		if stmt.Key != nil && stmt.Key.(*ast.Ident).Name != "_" {
+			received = v
+		}
+		assign(stmt.Key, v, under.Elem())
+		return &ast.ForStmt{
+			Init: &ast.AssignStmt{
+				Lhs: []ast.Expr{r},
+				Tok: token.DEFINE,
+				Rhs: []ast.Expr{s.expr(stmt.X)},
+			},
+			Body: body(
+				&ast.AssignStmt{Lhs: []ast.Expr{received, ok}, Tok: token.DEFINE, Rhs: []ast.Expr{recv}},
+				&ast.IfStmt{
+					Cond: &ast.UnaryExpr{Op: token.NOT, X: ok},
+					Body: &ast.BlockStmt{List: []ast.Stmt{&ast.BranchStmt{Tok: token.BREAK}}},
+				},
+			),
+		}
+	}
+
+	panic(unsupported{"ranges over a map or a value of a type parameter"})
+}
+
+// parts are the parts of an operation, which the shared function evaluates and passes to the
+// dictionary. The rest of the operation is done by the dictionary.
+type parts struct {
+	args   []ast.Expr   // operands evaluated by the shared function
+	consts []ast.Expr   // constants referring to local declarations, replaced by their values
+	roots  []*ast.Ident // local variables assigned to by a statement, passed and returned back
+}
+
+// rootVars returns the first identifier of each variable assigned to by a statement.
+func (p *parts) rootVars(info *types.Info) []*ast.Ident {
+	var (
+		roots []*ast.Ident
+		seen  = make(map[types.Object]bool)
+	)
+	for _, ident := range p.roots {
+		if obj := info.Uses[ident]; !seen[obj] {
+			seen[obj] = true
+			roots = append(roots, ident)
+		}
+	}
+	return roots
+}
+
+// replacing returns a configuration for instantiating the code of an operation, which replaces
+// its parts by the operands, and constants referring to local declarations by their values.
+func (p *parts) replacing(cfg *config, mapping map[*types.TypeParam]types.Type, operands []ast.Expr) *config {
+	opCfg := *cfg
+	opCfg.replace = make(map[ast.Node]ast.Expr)
+	roots := p.rootVars(cfg.info)
+	for i, root := range roots {
+		for _, ident := range p.roots {
+			if cfg.info.Uses[ident] == cfg.info.Uses[root] {
+				opCfg.replace[ident] = operands[i]
+			}
+		}
+	}
+	for i, arg := range p.args {
+		opCfg.replace[arg] = operands[len(roots)+i]
+	}
+	for _, c := range p.consts {
+		tv := cfg.info.Types[c]
+		opCfg.replace[c] = constExpr(cfg, mapping, tv.Type, constLit(tv.Value))
+	}
+	return &opCfg
+}
+
+// stmtOp moves an assignment, an increment, a decrement, or a send depending on the type
+// parameters into the dictionary. Local variables assigned to are passed to it and assigned
+// back.
+func (s *sharer) stmtOp(stmt ast.Stmt) ast.Stmt {
+	var p parts
+	switch stmt := stmt.(type) {
+	case *ast.AssignStmt:
+		if len(stmt.Lhs) != len(stmt.Rhs) {
+			panic(unsupported{"assigns multiple values to expressions depending on type parameters"})
+		}
+		for _, lhs := range stmt.Lhs {
+			s.addr(lhs, &p, &p.roots)
+		}
+		for _, rhs := range stmt.Rhs {
+			s.operand(rhs, &p)
+		}
+	case *ast.IncDecStmt:
+		s.addr(stmt.X, &p, &p.roots)
+	case *ast.SendStmt:
+		s.operand(stmt.Chan, &p)
+		s.operand(stmt.Value, &p)
+	}
+
+	roots := p.rootVars(s.info)
+	o := &op{}
+	var args, lhs []ast.Expr
+	for _, root := range roots {
+		o.params = append(o.params, s.info.TypeOf(root))
+		o.results = append(o.results, s.info.TypeOf(root))
+		args = append(args, instIdent(s.cfg, root))
+		lhs = append(lhs, instIdent(s.cfg, root))
+	}
+	for _, arg := range p.args {
+		o.params = append(o.params, s.info.TypeOf(arg))
+	}
+	args = append(args, s.exprs(p.args)...)
+	o.body = func(cfg *config, mapping map[*types.TypeParam]types.Type, operands []ast.Expr) []ast.Stmt {
+		body := []ast.Stmt{instNode(p.replacing(cfg, mapping, operands), mapping, stmt).(ast.Stmt)}
+		if len(roots) > 0 {
+			body = append(body, &ast.ReturnStmt{Results: operands[:len(roots)]})
+		}
+		return body
+	}
+
+	call := s.call(o, args)
+	if len(roots) == 0 {
+		return &ast.ExprStmt{X: call}
+	}
+	return &ast.AssignStmt{Lhs: lhs, Tok: token.ASSIGN, Rhs: []ast.Expr{call}}
+}
+
+func (s *sharer) exprs(exprs []ast.Expr) []ast.Expr {
+	var shared []ast.Expr
+	for _, e := range exprs {
+		shared = append(shared, s.expr(e))
+	}
+	return shared
+}
+
+// expr translates an expression of the generic function.
+func (s *sharer) expr(e ast.Expr) ast.Expr {
+	if e == nil {
+		return nil
+	}
+	if !s.involves(e) {
+		return instNode(s.cfg, s.none, e).(ast.Expr)
+	}
+
+	tv := s.info.Types[e]
+	switch {
+	case tv.IsType():
+		panic(unsupported{"uses a type depending on type parameters as a value"})
+
+	case tv.Value != nil || s.isNil(e):
+		return s.constant(e, tv.Type)
+	}
+
+	switch e := e.(type) {
+	case *ast.Ident:
+		return instNode(s.cfg, s.none, e).(ast.Expr)
+
+	case *ast.ParenExpr:
+		return &ast.ParenExpr{X: s.expr(e.X)}
+
+	case *ast.FuncLit:
+		sig := tv.Type.(*types.Signature)
+		if s.sh.dep(sig) {
+			panic(unsupported{"has a function literal with a signature depending on type parameters"})
+		}
+		results := s.results
+		s.results = sig.Results()
+		body := s.block(e.Body)
+		s.results = results
+		return &ast.FuncLit{
+			Type: instNode(s.cfg, s.none, e.Type).(*ast.FuncType),
+			Body: body,
+		}
+	}
+
+	if s.isOp(e) {
+		return s.exprOp(e)
+	}
+
+	switch e := e.(type) {
+	case *ast.BinaryExpr:
+		return &ast.BinaryExpr{X: s.expr(e.X), Op: e.Op, Y: s.expr(e.Y)}
+
+	case *ast.UnaryExpr:
+		return &ast.UnaryExpr{Op: e.Op, X: s.expr(e.X)}
+
+	case *ast.StarExpr:
+		return &ast.StarExpr{X: s.expr(e.X)}
+
+	case *ast.SelectorExpr:
+		return &ast.SelectorExpr{X: s.expr(e.X), Sel: s.field(e.Sel)}
+
+	case *ast.IndexExpr:
+		return &ast.IndexExpr{X: s.expr(e.X), Index: s.expr(e.Index)}
+
+	case *ast.SliceExpr:
+		return &ast.SliceExpr{
+			X:      s.expr(e.X),
+			Low:    s.expr(e.Low),
+			High:   s.expr(e.High),
+			Max:    s.expr(e.Max),
+			Slice3: e.Slice3,
+		}
+
+	case *ast.TypeAssertExpr:
+		return &ast.TypeAssertExpr{X: s.expr(e.X), Type: maybeNil(instNode(s.cfg, s.none, e.Type))}
+
+	case *ast.CallExpr:
+		if genCall, ok := s.info.GenericCalls[e]; ok {
+			src, decl := genericDecl(s.cfg, e.Fun)
+			funcDecl := decl.(*ast.FuncDecl)
+			return &ast.CallExpr{
+				Fun:      &ast.Ident{Name: instFuncDecl(s.cfg.forDecl(src, funcDecl), genCall, funcDecl, e.Pos())},
+				Args:     s.exprs(e.Args[genCall.NumUnnamed:]),
+				Ellipsis: e.Ellipsis,
+			}
+		}
+		return &ast.CallExpr{
+			Fun:      s.expr(e.Fun),
+			Args:     s.exprs(e.Args),
+			Ellipsis: e.Ellipsis,
+		}
+
+	case *ast.CompositeLit:
+		lit := &ast.CompositeLit{Type: maybeNil(instNode(s.cfg, s.none, e.Type))}
+		_, isStruct := tv.Type.Underlying().(*types.Struct)
+		for _, elt := range e.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				lit.Elts = append(lit.Elts, s.expr(elt))
+				continue
+			}
+			key := s.expr(kv.Key)
+			if isStruct {
+				key = s.field(kv.Key.(*ast.Ident))
+			}
+			lit.Elts = append(lit.Elts, &ast.KeyValueExpr{Key: key, Value: s.expr(kv.Value)})
+		}
+		return lit
+	}
+
+	panic(unsupported{fmt.Sprintf("has an unexpected %T", e)})
+}
+
+// isOp reports whether an expression operates on values of types depending on the type
+// parameters, so that it must be done by the dictionary.
+func (s *sharer) isOp(e ast.Expr) bool {
+	if s.depExpr(e) {
+		return true
+	}
+	if s.involvesAddr(e) {
+		return true
+	}
+	var children []ast.Expr
+	switch e := e.(type) {
+	case *ast.BinaryExpr:
+		children = []ast.Expr{e.X, e.Y}
+	case *ast.UnaryExpr:
+		children = []ast.Expr{e.X}
+	case *ast.StarExpr:
+		children = []ast.Expr{e.X}
+	case *ast.SelectorExpr:
+		children = []ast.Expr{e.X}
+	case *ast.IndexExpr:
+		children = []ast.Expr{e.X, e.Index}
+	case *ast.SliceExpr:
+		children = []ast.Expr{e.X, e.Low, e.High, e.Max}
+	case *ast.TypeAssertExpr:
+		children = []ast.Expr{e.X, e.Type}
+	case *ast.CallExpr:
+		if genCall, ok := s.info.GenericCalls[e]; ok && s.depMapping(genCall.Mapping) {
+			return true
+		}
+		if genInst, ok := s.info.GenericInstances[e]; ok && s.depMapping(genInst.Mapping) {
+			return true
+		}
+		children = append([]ast.Expr{e.Fun}, e.Args...)
+		if sel, ok := e.Fun.(*ast.SelectorExpr); ok {
+			children = append(children, sel.X)
+		}
+	case *ast.CompositeLit:
+		for _, elt := range e.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				children = append(children, kv.Key, kv.Value)
+			} else {
+				children = append(children, elt)
+			}
+		}
+	}
+	for _, child := range children {
+		if s.depExpr(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// involvesAddr reports whether e needs an addressable operand, which depends on the type
+// parameters. The shared function can't keep it addressable, so e must be done by the dictionary.
+func (s *sharer) involvesAddr(e ast.Expr) bool {
+	switch e := e.(type) {
+	case *ast.UnaryExpr:
+		return e.Op == token.AND && s.involves(e.X)
+	case *ast.SliceExpr:
+		_, ok := s.info.TypeOf(e.X).Underlying().(*types.Array)
+		return ok && s.involves(e.X)
+	case *ast.SelectorExpr:
+		sel := s.info.Selections[e]
+		return sel != nil && sel.Kind() == types.MethodVal && pointerRecv(sel) && !isPointer(s.info.TypeOf(e.X)) && s.involves(e.X)
+	case *ast.CallExpr:
+		return s.involvesAddr(unparen(e.Fun))
+	}
+	return false
+}
+
+func (s *sharer) depMapping(mapping map[*types.TypeParam]types.Type) bool {
+	for _, t := range mapping {
+		if s.sh.dep(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// exprOp moves an operation on values of types depending on the type parameters into the
+// dictionary.
+func (s *sharer) exprOp(e ast.Expr) ast.Expr {
+	var p parts
+	s.operands(e, &p)
+
+	o := &op{}
+	for _, arg := range p.args {
+		o.params = append(o.params, s.info.TypeOf(arg))
+	}
+	tv := s.info.Types[e]
+	if tuple, ok := tv.Type.(*types.Tuple); ok {
+		for i := 0; i < tuple.Len(); i++ {
+			o.results = append(o.results, tuple.At(i).Type())
+		}
+	} else if !tv.IsVoid() {
+		o.results = []types.Type{tv.Type}
+	}
+	o.body = func(cfg *config, mapping map[*types.TypeParam]types.Type, operands []ast.Expr) []ast.Stmt {
+		x := instNode(p.replacing(cfg, mapping, operands), mapping, e).(ast.Expr)
+		return returnAll(cfg, x, len(o.results))
+	}
+	return s.call(o, s.exprs(p.args))
+}
+
+// operands collects the parts of an operation: the operands of e, which the shared function
+// evaluates.
+func (s *sharer) operands(e ast.Expr, p *parts) {
+	switch e := e.(type) {
+	case *ast.ParenExpr:
+		s.operands(e.X, p)
+
+	case *ast.BinaryExpr:
+		s.operand(e.X, p)
+		s.operand(e.Y, p)
+
+	case *ast.UnaryExpr:
+		if e.Op == token.AND {
+			s.addr(e.X, p, nil)
+		} else {
+			s.operand(e.X, p)
+		}
+
+	case *ast.StarExpr:
+		s.operand(e.X, p)
+
+	case *ast.IndexExpr:
+		s.operand(e.X, p)
+		s.operand(e.Index, p)
+
+	case *ast.SliceExpr:
+		if _, ok := s.info.TypeOf(e.X).Underlying().(*types.Array); ok {
+			s.addr(e.X, p, nil)
+		} else {
+			s.operand(e.X, p)
+		}
+		s.operand(e.Low, p)
+		s.operand(e.High, p)
+		s.operand(e.Max, p)
+
+	case *ast.SelectorExpr:
+		sel := s.info.Selections[e]
+		switch {
+		case sel == nil || sel.Kind() == types.MethodExpr:
+		case sel.Kind() == types.MethodVal && pointerRecv(sel) && !isPointer(s.info.TypeOf(e.X)):
+			s.addr(e.X, p, nil)
+		default:
+			s.operand(e.X, p)
+		}
+
+	case *ast.TypeAssertExpr:
+		s.operand(e.X, p)
+
+	case *ast.CallExpr:
+		if builtin, ok := s.object(unparen(e.Fun)).(*types.Builtin); ok && builtin.Name() == "Offsetof" {
+			// the selector isn't evaluated, its operand is
+			s.operand(unparen(e.Args[0]).(*ast.SelectorExpr).X, p)
+			break
+		}
+		if sel, ok := e.Fun.(*ast.SelectorExpr); ok && s.info.Selections[sel] != nil {
+			s.operands(sel, p)
+		} else {
+			s.operand(e.Fun, p)
+		}
+		if genCall, ok := s.info.GenericCalls[e]; ok {
+			for _, arg := range e.Args[genCall.NumUnnamed:] {
+				s.operand(arg, p)
+			}
+			break
+		}
+		for _, arg := range e.Args {
+			s.operand(arg, p)
+		}
+
+	case *ast.CompositeLit:
+		_, isStruct := s.info.TypeOf(e).Underlying().(*types.Struct)
+		for _, elt := range e.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				s.operand(elt, p)
+				continue
+			}
+			if !isStruct {
+				s.operand(kv.Key, p)
+			}
+			s.operand(kv.Value, p)
+		}
+
+	default:
+		panic(unsupported{fmt.Sprintf("has an unexpected %T", e)})
+	}
+}
+
+// operand adds e to the parts of an operation, unless it's a type, a constant, or something else
+// the dictionary can refer to by itself.
+func (s *sharer) operand(e ast.Expr, p *parts) {
+	if e == nil {
+		return
+	}
+	tv := s.info.Types[e]
+	switch {
+	case tv.IsType():
+		if local(tv.Type) {
+			panic(unsupported{"refers to a local type"})
+		}
+		return
+	case tv.Value != nil:
+		if s.refersToLocal(e) {
+			p.consts = append(p.consts, e)
+		}
+		return
+	case s.isNil(e), tv.IsBuiltin():
+		return
+	case isUntyped(tv.Type):
+		// untyped values, like 1 << n, get their types from the operation in the instance
+		s.operands(e, p)
+		return
+	}
+
+	switch e := e.(type) {
+	case *ast.ParenExpr:
+		s.operand(e.X, p)
+		return
+	case *ast.CompositeLit:
+		if e.Type == nil {
+			// the type is elided, so the literal is a part of the enclosing one
+			s.operands(e, p)
+			return
+		}
+	case *ast.Ident, *ast.SelectorExpr:
+		if fn, ok := s.object(e).(*types.Func); ok && fn.Parent() == fn.Pkg().Scope() {
+			return
+		}
+	}
+	p.args = append(p.args, e)
+}
+
+// object returns the object referred to by an identifier or a qualified identifier.
+// field translates the name of a field or a method, renaming embedded instances of generic types
+// like in instantiated code.
+func (s *sharer) field(ident *ast.Ident) *ast.Ident {
+	field := instIdent(s.cfg, ident)
+	if name := embeddedName(s.cfg, s.none, s.info.Uses[ident]); name != "" {
+		field.Name = name
+	}
+	return field
+}
+
+func (s *sharer) object(e ast.Expr) types.Object {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return s.info.Uses[e]
+	case *ast.SelectorExpr:
+		if s.info.Selections[e] == nil {
+			return s.info.Uses[e.Sel]
+		}
+	}
+	return nil
+}
+
+// refersToLocal reports whether an expression refers to a declaration inside of a function.
+func (s *sharer) refersToLocal(e ast.Expr) bool {
+	found := false
+	ast.Inspect(e, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Ident); ok {
+			switch obj := s.info.Uses[ident].(type) {
+			case nil, *types.PkgName:
+			default:
+				found = found || obj.Pkg() != nil && obj.Parent() != obj.Pkg().Scope()
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// addr collects the parts of an addressable expression, which must stay addressable in the
+// operation. If roots is nil, it must not be a local variable, because the shared function keeps
+// those in interface{} values. Otherwise, local variables are added to roots, so that the
+// operation can assign to them and return them back.
+func (s *sharer) addr(e ast.Expr, p *parts, roots *[]*ast.Ident) {
+	switch e := e.(type) {
+	case *ast.Ident:
+		if e.Name == "_" {
+			return
+		}
+		obj := s.info.Uses[e]
+		if obj.Parent() == obj.Pkg().Scope() {
+			return
+		}
+		if roots == nil {
+			panic(unsupported{"takes the address of a local variable"})
+		}
+		*roots = append(*roots, e)
+
+	case *ast.ParenExpr:
+		s.addr(e.X, p, roots)
+
+	case *ast.IndexExpr:
+		if _, ok := s.info.TypeOf(e.X).Underlying().(*types.Array); ok {
+			s.addr(e.X, p, roots)
+		} else {
+			s.operand(e.X, p)
+		}
+		s.operand(e.Index, p)
+
+	case *ast.SelectorExpr:
+		sel := s.info.Selections[e]
+		switch {
+		case sel == nil:
+		case sel.Indirect() || isPointer(s.info.TypeOf(e.X)):
+			s.operand(e.X, p)
+		default:
+			s.addr(e.X, p, roots)
+		}
+
+	case *ast.StarExpr:
+		s.operand(e.X, p)
+
+	case *ast.CompositeLit:
+		s.operands(e, p)
+
+	default:
+		panic(unsupported{"takes the address of an unexpected expression"})
+	}
+}
+
+func pointerRecv(sel *types.Selection) bool {
+	return isPointer(sel.Obj().Type().(*types.Signature).Recv().Type())
+}
+
+func isPointer(t types.Type) bool {
+	_, ok := t.Underlying().(*types.Pointer)
+	return ok
+}
+
+// isUntyped reports whether t is the type of an untyped constant or value.
+func isUntyped(t types.Type) bool {
+	basic, ok := t.(*types.Basic)
+	return ok && basic.Info()&types.IsUntyped != 0
+}
+
+// constExpr returns a constant value of type t, as it is in an instance.
+func constExpr(cfg *config, mapping map[*types.TypeParam]types.Type, t types.Type, value ast.Expr) ast.Expr {
+	if basic, ok := t.(*types.Basic); ok && basic.Info()&types.IsUntyped != 0 {
+		return value
+	}
+	return &ast.CallExpr{
+		Fun:  &ast.ParenExpr{X: typeToExpr(cfg, types.MapType(mapping, t))},
+		Args: []ast.Expr{value},
+	}
+}
+
+// constLit returns an untyped constant expression with the value v.
+func constLit(v constant.Value) ast.Expr {
+	switch v.Kind() {
+	case constant.Bool:
+		return &ast.Ident{Name: v.String()}
+	case constant.String:
+		return &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(constant.StringVal(v))}
+	case constant.Int, constant.Float:
+		if constant.Sign(v) < 0 {
+			return &ast.ParenExpr{X: &ast.UnaryExpr{Op: token.SUB, X: constLit(constant.UnaryOp(token.SUB, v, 0))}}
+		}
+		if v.Kind() == constant.Int {
+			return &ast.BasicLit{Kind: token.INT, Value: v.ExactString()}
+		}
+		return &ast.ParenExpr{X: &ast.BinaryExpr{
+			X:  &ast.BasicLit{Kind: token.FLOAT, Value: constant.Num(v).ExactString() + ".0"},
+			Op: token.QUO,
+			Y:  &ast.BasicLit{Kind: token.INT, Value: constant.Denom(v).ExactString()},
+		}}
+	case constant.Complex:
+		return &ast.ParenExpr{X: &ast.BinaryExpr{
+			X:  constLit(constant.Real(v)),
+			Op: token.ADD,
+			Y: &ast.BinaryExpr{
+				X:  constLit(constant.Imag(v)),
+				Op: token.MUL,
+				Y:  &ast.BasicLit{Kind: token.IMAG, Value: "1i"},
+			},
+		}}
+	}
+	panic(fmt.Sprintf("constLit: unexpected constant %v", v))
+}
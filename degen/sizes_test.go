@@ -0,0 +1,87 @@
+package degen_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/constant"
+	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
+)
+
+const sizesSrc = `package main
+
+import "unsafe"
+
+type Pair(type K, type V) struct {
+	Key   K
+	Value V
+}
+
+func Size(x type T) uintptr { return unsafe.Sizeof(x) }
+
+func Offset(p Pair(type K, type V)) uintptr { return unsafe.Offsetof(p.Value) }
+
+const pairSize = unsafe.Sizeof(Pair(int8, int64){})
+
+func Align(x type T) uintptr { return unsafe.Alignof(x) }
+
+func main() {
+	println(Size(1), Size("a"), Offset(Pair(int8, int64){}), Offset(Pair(string, bool){}), pairSize, Align(int8(1)))
+}
+`
+
+// checkSizes checks the constant layouts in the instances translated from sizesSrc, by the
+// declarations they're found in. In dictionary mode, they're found in the methods of the
+// dictionaries, like Size_int_dict.
+func checkSizes(t *testing.T, file *ast.File, info *types.Info) {
+	want := map[string]int64{
+		"Size_int":           8,
+		"Size_string":        16,
+		"Offset_int8_int64":  8,
+		"Offset_string_bool": 16,
+		"pairSize":           16,
+		"Align_int8":         1,
+	}
+
+	got := make(map[string]int64)
+	for _, decl := range file.Decls {
+		var name string
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			name = decl.Name.Name
+			if decl.Recv != nil {
+				recv, _ := decl.Recv.List[0].Type.(*ast.Ident)
+				if recv == nil {
+					continue
+				}
+				name = strings.TrimSuffix(recv.Name, "_dict")
+			}
+		case *ast.GenDecl:
+			if decl.Tok != token.CONST {
+				continue
+			}
+			name = decl.Specs[0].(*ast.ValueSpec).Names[0].Name
+		}
+		ast.Inspect(decl, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+				if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "unsafe" {
+					val, _ := constant.Int64Val(info.Types[call].Value)
+					got[name] = val
+				}
+			}
+			return true
+		})
+	}
+
+	for name, size := range want {
+		if got[name] != size {
+			t.Errorf("layout in %s is %d, want %d", name, got[name], size)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package degen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/parser"
+	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
+)
+
+// checkedImporter imports packages type-checked beforehand, whose source isn't known to the
+// Importer using it as its fallback.
+type checkedImporter map[string]*types.Package
+
+func (imp checkedImporter) Import(path string) (*types.Package, error) {
+	return imp[path], nil
+}
+
+// TestGenericDeclWithoutSource checks that generic functions of packages without source are
+// reported, instead of being looked up in the missing source.
+func TestGenericDeclWithoutSource(t *testing.T) {
+	fset := token.NewFileSet()
+	lib, err := parser.ParseFile(fset, "lib.go", "package lib\n\nfunc Id(x type T) T { return x }\n", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := (&types.Config{}).Check("lib", fset, []*ast.File{lib}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := parser.ParseFile(fset, "main.go", "package main\n\nimport \"lib\"\n\nfunc main() { println(lib.Id(1)) }\n", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imp := newImporter(fset, checkedImporter{"lib": pkg})
+	result, err := Translate(fset, []*ast.File{file}, Options{Importer: imp})
+	if want := "main.go:5:23: cannot instantiate Id: source of package lib is not available"; err == nil || len(result.Diagnostics) != 1 || !strings.Contains(result.Diagnostics[0].Error(), want) {
+		t.Errorf("got error %v, want one diagnostic containing %q", err, want)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import "fmt"
+
+// List is a linked list.
+type List(type T) struct {
+	Value T
+	Next  *List(T)
+}
+
+// Len returns the length of the list.
+func (l *List(type T)) Len() int {
+	if l == nil {
+		return 0
+	}
+	return 1 + l.Next.Len()
+}
+
+// Map applies f to each value of the list.
+func Map(l *List(type T), f func(T) type U) *List(U) {
+	if l == nil {
+		return nil
+	}
+	return &List(U){f(l.Value), Map(l.Next, f)}
+}
+
+// Index returns the index of the first x in the list, or -1.
+func Index(l *List(type T eq), x T) int {
+	for i := 0; l != nil; i, l = i+1, l.Next {
+		if l.Value == x {
+			return i
+		}
+	}
+	return -1
+}
+
+// Min returns the smaller of x and y.
+func Min(x, y type T ord) T {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+// Zero returns the zero value of T.
+func Zero(type T) T {
+	var zero T
+	return zero
+}
+
+// Join joins the strings of the values.
+func Join(l *List(type T fmt.Stringer)) string {
+	s := ""
+	for ; l != nil; l = l.Next {
+		s += l.Value.String()
+	}
+	return s
+}
+
+// Keys returns the distinct values which are stringers.
+func Keys(l *List(type T eq fmt.Stringer)) map[T]string {
+	keys := make(map[T]string)
+	for ; l != nil; l = l.Next {
+		keys[l.Value] = l.Value.String()
+	}
+	return keys
+}
+
+type name string
+
+func (n name) String() string { return string(n) }
+
+func main() {
+	l := &List(int){1, &List(int){2, nil}}
+	names := Map(l, func(x int) name { return name(fmt.Sprint(x)) })
+	fmt.Println(l.Len(), Index(l, 2), Min("a", "b"), Zero(string), Join(names), len(Keys(names)))
+}
@@ -0,0 +1,35 @@
+package main
+
+// Vec is a vector of two numbers.
+type Vec(type T num) struct{ X, Y T }
+
+// Sum returns the sum of the coordinates as a float64.
+func (v Vec(type T num)) Sum() float64 { return float64(v.X) + float64(v.Y) }
+
+// Average returns the average of xs.
+func Average(xs []type T num) float64 {
+	var sum float64
+	for _, x := range xs {
+		sum += float64(x)
+	}
+	return sum / float64(len(xs))
+}
+
+// Total adds up xs, which may be complex.
+func Total(xs []type T num) T {
+	total := T(0)
+	for _, x := range xs {
+		total += x
+	}
+	return total
+}
+
+// Convert converts x to the type of the second argument.
+func Convert(x type T num, _ type U num) U { return U(x) }
+
+// Mask keeps the lowest n bits of x.
+func Mask(x type T integer, n uint) T { return x & (1<<n - 1) }
+
+func main() {
+	println(Average([]int{1, 2}), Total([]complex128{1i}), Convert(1, 2.0), Vec(int){1, 2}.Sum(), Mask(uint8(255), 4))
+}
@@ -0,0 +1,349 @@
+package degen
+
+import (
+	goconstant "go/constant"
+	goimporter "go/importer"
+	gotoken "go/token"
+	gotypes "go/types"
+
+	"github.com/faiface/generics/go/constant"
+	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
+)
+
+// toolchainImporter imports standard library packages type-checked by the go/types package of the
+// toolchain this program is built with, and converts them to the types of this fork. The fork
+// parses only the syntax of this proposal, so it can't type-check the standard library of current
+// toolchains itself, which uses Go's own type parameters.
+//
+// Generic declarations of the standard library have no counterpart in this proposal, so they are
+// left out of the converted packages, along with interfaces that are only usable as constraints.
+// Instances of generic types, like atomic.Pointer[T] in the fields of a struct, become named types
+// of their own. Converted objects have no positions.
+type toolchainImporter struct {
+	imp      gotypes.ImporterFrom
+	packages map[*gotypes.Package]*types.Package
+	complete map[*gotypes.Package]bool
+	objects  map[gotypes.Object]types.Object
+	unusable map[gotypes.Object]bool // generic objects and constraints, which are left out
+	insts    map[string]*types.Named // converted instances of generic types by their type strings
+}
+
+// newToolchainImporter returns a toolchainImporter importing packages with the importer of the
+// toolchain for compiler, either "source" or "gc".
+func newToolchainImporter(compiler string) *toolchainImporter {
+	return &toolchainImporter{
+		imp:      goimporter.ForCompiler(gotoken.NewFileSet(), compiler, nil).(gotypes.ImporterFrom),
+		packages: make(map[*gotypes.Package]*types.Package),
+		complete: make(map[*gotypes.Package]bool),
+		objects:  make(map[gotypes.Object]types.Object),
+		unusable: make(map[gotypes.Object]bool),
+		insts:    make(map[string]*types.Named),
+	}
+}
+
+func (t *toolchainImporter) Import(path string) (*types.Package, error) {
+	return t.ImportFrom(path, ".", 0)
+}
+
+func (t *toolchainImporter) ImportFrom(path, srcDir string, mode types.ImportMode) (*types.Package, error) {
+	if path == "unsafe" {
+		// the functions of unsafe are builtins, which only the fork's own package declares
+		return types.Unsafe, nil
+	}
+	gopkg, err := t.imp.ImportFrom(path, srcDir, 0)
+	if err != nil {
+		return nil, err
+	}
+	pkg := t.pkg(gopkg)
+	if !t.complete[gopkg] {
+		t.complete[gopkg] = true
+		scope := gopkg.Scope()
+		for _, name := range scope.Names() {
+			t.object(scope.Lookup(name))
+		}
+		var imports []*types.Package
+		for _, imported := range gopkg.Imports() {
+			imports = append(imports, t.pkg(imported))
+		}
+		pkg.SetImports(imports)
+		pkg.MarkComplete()
+	}
+	return pkg, nil
+}
+
+// pkg returns the converted package, creating it empty if it hasn't been converted yet. Objects
+// are added to it as they are converted.
+func (t *toolchainImporter) pkg(gopkg *gotypes.Package) *types.Package {
+	if gopkg == nil {
+		return nil
+	}
+	if gopkg == gotypes.Unsafe {
+		return types.Unsafe
+	}
+	pkg, ok := t.packages[gopkg]
+	if !ok {
+		pkg = types.NewPackage(gopkg.Path(), gopkg.Name())
+		t.packages[gopkg] = pkg
+	}
+	return pkg
+}
+
+// object returns the converted object, or nil if it can't be converted. Package-level objects
+// are added to the scopes of their packages.
+func (t *toolchainImporter) object(goobj gotypes.Object) types.Object {
+	if obj, ok := t.objects[goobj]; ok {
+		return obj
+	}
+	if t.unusable[goobj] {
+		return nil
+	}
+
+	pkg := t.pkg(goobj.Pkg())
+	var obj types.Object
+	switch goobj := goobj.(type) {
+	case *gotypes.TypeName:
+		if goobj.IsAlias() {
+			typ := t.typ(goobj.Type())
+			if typ == nil {
+				break
+			}
+			obj = types.NewTypeName(token.NoPos, pkg, goobj.Name(), typ)
+			break
+		}
+		gonamed, ok := goobj.Type().(*gotypes.Named)
+		if !ok || gonamed.TypeParams().Len() > 0 || isConstraint(gonamed) {
+			break
+		}
+		typeName := types.NewTypeName(token.NoPos, pkg, goobj.Name(), nil)
+		named := types.NewNamed(typeName, nil, nil)
+		// the named type is registered before its underlying type and its methods, which may
+		// refer to it
+		t.objects[goobj] = typeName
+		t.setUp(named, gonamed)
+		obj = typeName
+
+	case *gotypes.Const:
+		typ := t.typ(goobj.Type())
+		if typ == nil {
+			break
+		}
+		obj = types.NewConst(token.NoPos, pkg, goobj.Name(), typ, convertConstant(goobj.Val()))
+
+	case *gotypes.Var:
+		typ := t.typ(goobj.Type())
+		if typ == nil {
+			break
+		}
+		obj = types.NewVar(token.NoPos, pkg, goobj.Name(), typ)
+
+	case *gotypes.Func:
+		gosig := goobj.Type().(*gotypes.Signature)
+		if gosig.TypeParams().Len() > 0 || gosig.RecvTypeParams().Len() > 0 {
+			break
+		}
+		sig := t.signature(gosig)
+		if sig == nil {
+			break
+		}
+		obj = types.NewFunc(token.NoPos, pkg, goobj.Name(), sig)
+	}
+
+	if obj == nil {
+		t.unusable[goobj] = true
+		return nil
+	}
+	t.objects[goobj] = obj
+	if goobj.Pkg() != nil && goobj.Parent() == goobj.Pkg().Scope() {
+		pkg.Scope().Insert(obj)
+	}
+	return obj
+}
+
+// setUp sets the underlying type and the methods of a converted named type. Methods that can't be
+// converted are left out, and a named type whose underlying type can't be converted is invalid.
+func (t *toolchainImporter) setUp(named *types.Named, gonamed *gotypes.Named) {
+	underlying := t.typ(gonamed.Underlying())
+	if underlying == nil {
+		underlying = types.Typ[types.Invalid]
+	}
+	named.SetUnderlying(underlying)
+
+	for i := 0; i < gonamed.NumMethods(); i++ {
+		gomethod := gonamed.Method(i)
+		sig := t.signature(gomethod.Type().(*gotypes.Signature))
+		if sig == nil {
+			continue
+		}
+		named.AddMethod(types.NewFunc(token.NoPos, t.pkg(gomethod.Pkg()), gomethod.Name(), sig))
+	}
+}
+
+// typ returns the converted type, or nil if it can't be converted.
+func (t *toolchainImporter) typ(gotyp gotypes.Type) types.Type {
+	switch gotyp := gotypes.Unalias(gotyp).(type) {
+	case *gotypes.Basic:
+		switch gotyp.Name() {
+		case "byte", "rune":
+			return types.Universe.Lookup(gotyp.Name()).Type()
+		}
+		return types.Typ[types.BasicKind(gotyp.Kind())]
+
+	case *gotypes.Pointer:
+		if elem := t.typ(gotyp.Elem()); elem != nil {
+			return types.NewPointer(elem)
+		}
+
+	case *gotypes.Slice:
+		if elem := t.typ(gotyp.Elem()); elem != nil {
+			return types.NewSlice(elem)
+		}
+
+	case *gotypes.Array:
+		if elem := t.typ(gotyp.Elem()); elem != nil {
+			return types.NewArray(elem, gotyp.Len())
+		}
+
+	case *gotypes.Map:
+		key, elem := t.typ(gotyp.Key()), t.typ(gotyp.Elem())
+		if key != nil && elem != nil {
+			return types.NewMap(key, elem)
+		}
+
+	case *gotypes.Chan:
+		if elem := t.typ(gotyp.Elem()); elem != nil {
+			return types.NewChan(types.ChanDir(gotyp.Dir()), elem)
+		}
+
+	case *gotypes.Struct:
+		var fields []*types.Var
+		var tags []string
+		for i := 0; i < gotyp.NumFields(); i++ {
+			gofield := gotyp.Field(i)
+			typ := t.typ(gofield.Type())
+			if typ == nil {
+				return nil
+			}
+			fields = append(fields, types.NewField(token.NoPos, t.pkg(gofield.Pkg()), gofield.Name(), typ, gofield.Embedded()))
+			tags = append(tags, gotyp.Tag(i))
+		}
+		return types.NewStruct(fields, tags)
+
+	case *gotypes.Signature:
+		if sig := t.signature(gotyp); sig != nil {
+			return sig
+		}
+
+	case *gotypes.Interface:
+		if !gotyp.IsMethodSet() {
+			return nil
+		}
+		// the interface is flattened: the methods of embedded interfaces become its own
+		var methods []*types.Func
+		for i := 0; i < gotyp.NumMethods(); i++ {
+			gomethod := gotyp.Method(i)
+			gosig := gomethod.Type().(*gotypes.Signature)
+			sig := t.signature(gotypes.NewSignatureType(nil, nil, nil, gosig.Params(), gosig.Results(), gosig.Variadic()))
+			if sig == nil {
+				return nil
+			}
+			methods = append(methods, types.NewFunc(token.NoPos, t.pkg(gomethod.Pkg()), gomethod.Name(), sig))
+		}
+		return types.NewInterfaceType(methods, nil).Complete()
+
+	case *gotypes.Named:
+		obj := gotyp.Obj()
+		if obj.Pkg() == nil {
+			// error, the only named type of the universe outside of constraints
+			return types.Universe.Lookup(obj.Name()).Type()
+		}
+		if gotyp.TypeArgs().Len() > 0 {
+			return t.instance(gotyp)
+		}
+		if typeName, ok := t.object(obj).(*types.TypeName); ok {
+			return typeName.Type()
+		}
+	}
+	return nil
+}
+
+// instance returns an instance of a generic type converted to a named type of its own, named
+// after the instance, like Pointer[int].
+func (t *toolchainImporter) instance(gonamed *gotypes.Named) types.Type {
+	key := gotypes.TypeString(gonamed, nil)
+	if named, ok := t.insts[key]; ok {
+		return named
+	}
+	if isConstraint(gonamed) {
+		return nil
+	}
+	gopkg := gonamed.Obj().Pkg()
+	typeName := types.NewTypeName(token.NoPos, t.pkg(gopkg), gotypes.TypeString(gonamed, gotypes.RelativeTo(gopkg)), nil)
+	named := types.NewNamed(typeName, nil, nil)
+	t.insts[key] = named
+	t.setUp(named, gonamed)
+	return named
+}
+
+// signature returns the converted signature, or nil if it can't be converted.
+func (t *toolchainImporter) signature(gosig *gotypes.Signature) *types.Signature {
+	var recv *types.Var
+	if gorecv := gosig.Recv(); gorecv != nil {
+		typ := t.typ(gorecv.Type())
+		if typ == nil {
+			return nil
+		}
+		recv = types.NewParam(token.NoPos, t.pkg(gorecv.Pkg()), gorecv.Name(), typ)
+	}
+	params, ok := t.tuple(gosig.Params())
+	if !ok {
+		return nil
+	}
+	results, ok := t.tuple(gosig.Results())
+	if !ok {
+		return nil
+	}
+	return types.NewSignature(recv, params, results, gosig.Variadic())
+}
+
+// tuple returns the converted tuple, which is nil if it's empty, and reports whether it could be
+// converted.
+func (t *toolchainImporter) tuple(gotuple *gotypes.Tuple) (*types.Tuple, bool) {
+	var vars []*types.Var
+	for i := 0; i < gotuple.Len(); i++ {
+		govar := gotuple.At(i)
+		typ := t.typ(govar.Type())
+		if typ == nil {
+			return nil, false
+		}
+		vars = append(vars, types.NewParam(token.NoPos, t.pkg(govar.Pkg()), govar.Name(), typ))
+	}
+	return types.NewTuple(vars...), true
+}
+
+// isConstraint reports whether a named type is an interface only usable as a constraint.
+func isConstraint(named *gotypes.Named) bool {
+	iface, ok := named.Underlying().(*gotypes.Interface)
+	return ok && !iface.IsMethodSet()
+}
+
+// convertConstant returns the converted value of a constant.
+func convertConstant(val goconstant.Value) constant.Value {
+	switch val.Kind() {
+	case goconstant.Bool:
+		return constant.MakeBool(goconstant.BoolVal(val))
+	case goconstant.String:
+		return constant.MakeString(goconstant.StringVal(val))
+	case goconstant.Int:
+		return constant.MakeFromLiteral(val.ExactString(), token.INT, 0)
+	case goconstant.Float:
+		num := constant.MakeFromLiteral(goconstant.Num(val).ExactString(), token.INT, 0)
+		denom := constant.MakeFromLiteral(goconstant.Denom(val).ExactString(), token.INT, 0)
+		return constant.BinaryOp(constant.ToFloat(num), token.QUO, constant.ToFloat(denom))
+	case goconstant.Complex:
+		re := convertConstant(goconstant.Real(val))
+		im := convertConstant(goconstant.Imag(val))
+		return constant.BinaryOp(re, token.ADD, constant.MakeImag(im))
+	}
+	return constant.MakeUnknown()
+}
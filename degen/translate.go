@@ -0,0 +1,252 @@
+package degen
+
+import (
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/scanner"
+	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
+)
+
+// Options configure the translation of Translate. The zero value monomorphizes with readable
+// names and no limits, importing packages with a new Importer.
+type Options struct {
+	Importer       *Importer // importer of the packages the files import; nil for NewImporter
+	LineDirectives bool      // whether instantiated code keeps the positions of the generic code
+	MaxDepth       int       // maximum length of a chain of instances; 0 for no limit
+	Mangling       Mangling  // naming of instances
+	Mode           Mode      // translation of generic functions and methods of generic types
+}
+
+// Result is a translated package.
+type Result struct {
+	// Files are the translated files, at the same indices as the input files. They're nil if
+	// the translation failed.
+	Files []*ast.File
+
+	// Instances are the instantiated declarations, in the order they were instantiated.
+	Instances []*Instance
+
+	// Diagnostics are the problems that kept the files from being translated, sorted by position.
+	Diagnostics scanner.ErrorList
+
+	// Positions map each declaration of an instance to the position of the generic declaration
+	// it was instantiated from.
+	Positions map[ast.Decl]token.Pos
+}
+
+// Instance is a generic function or type instantiated with type arguments.
+type Instance struct {
+	Name    string                          // name of the instantiated declaration
+	Generic types.Object                    // generic function or type
+	Mapping map[*types.TypeParam]types.Type // type arguments by the type parameters
+	Pos     token.Pos                       // generic call or instance first needing the instance
+	Decls   []ast.Decl                      // declarations of the instance, methods of a type included
+}
+
+// Translate translates the files of a single package into files without generics, like Degen,
+// and removes the generic declarations, along with their comments and the imports only they
+// used. If opts.LineDirectives is set, print the files with printer.SourcePos, so that their
+// //line directives point at the generic source.
+//
+// If the files don't type-check, or contain constructs that can't be translated, Translate
+// returns a Result with no files, along with its Diagnostics as the error.
+func Translate(fset *token.FileSet, input []*ast.File, opts Options) (*Result, error) {
+	if opts.Importer == nil {
+		opts.Importer = NewImporter(fset)
+	}
+
+	output, instances, err := degen(fset, input, opts)
+	if err != nil {
+		result := &Result{Diagnostics: err.(scanner.ErrorList)}
+		return result, result.Diagnostics
+	}
+
+	for _, file := range output {
+		filterGeneric(file)
+	}
+	removeUnusedImports(fset, opts.Importer, output)
+
+	result := &Result{
+		Files:     output,
+		Positions: make(map[ast.Decl]token.Pos),
+	}
+	for _, inst := range instances {
+		var generic types.Object
+		switch decl := inst.decl.(type) {
+		case *ast.FuncDecl:
+			generic = inst.cfg.src.info.Defs[decl.Name]
+		case *ast.TypeSpec:
+			generic = inst.cfg.src.info.Defs[decl.Name]
+		}
+
+		result.Instances = append(result.Instances, &Instance{
+			Name:    inst.name,
+			Generic: generic,
+			Mapping: inst.mapping,
+			Pos:     inst.pos,
+			Decls:   inst.decls,
+		})
+		for _, decl := range inst.decls {
+			result.Positions[decl] = inst.decl.Pos()
+		}
+	}
+	return result, nil
+}
+
+// filterGeneric removes generic function and type declarations from the file, along with
+// their comments.
+func filterGeneric(file *ast.File) {
+	var (
+		decls   []ast.Decl
+		removed []ast.Node
+	)
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		default:
+			decls = append(decls, decl)
+
+		case *ast.FuncDecl:
+			if len(decl.TypeParams) == 0 && len(decl.ConstParams) == 0 {
+				decls = append(decls, decl)
+			} else {
+				removed = append(removed, decl)
+			}
+
+		case *ast.GenDecl:
+			if decl.Tok != token.TYPE {
+				decls = append(decls, decl)
+				continue
+			}
+
+			var specs []ast.Spec
+			for _, spec := range decl.Specs {
+				if len(spec.(*ast.TypeSpec).Params) == 0 {
+					specs = append(specs, spec)
+				} else {
+					removed = append(removed, spec)
+				}
+			}
+			if len(specs) == 0 {
+				removed = append(removed, decl)
+				continue
+			}
+
+			filtered := *decl
+			filtered.Specs = specs
+			decls = append(decls, &filtered)
+		}
+	}
+	file.Decls = decls
+	file.Comments = removeComments(file.Comments, removed)
+}
+
+// removeComments removes the comments inside of the nodes, including their doc and line comments.
+func removeComments(comments []*ast.CommentGroup, nodes []ast.Node) []*ast.CommentGroup {
+	var kept []*ast.CommentGroup
+	for _, comment := range comments {
+		inside := false
+		for _, node := range nodes {
+			start, end := node.Pos(), node.End()
+			switch node := node.(type) {
+			case *ast.FuncDecl:
+				if node.Doc != nil {
+					start = node.Doc.Pos()
+				}
+			case *ast.GenDecl:
+				if node.Doc != nil {
+					start = node.Doc.Pos()
+				}
+			case *ast.TypeSpec:
+				if node.Doc != nil {
+					start = node.Doc.Pos()
+				}
+				if node.Comment != nil {
+					end = node.Comment.End()
+				}
+			case *ast.ImportSpec:
+				if node.Doc != nil {
+					start = node.Doc.Pos()
+				}
+				if node.Comment != nil {
+					end = node.Comment.End()
+				}
+			}
+			if start <= comment.Pos() && comment.End() <= end {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			kept = append(kept, comment)
+		}
+	}
+	return kept
+}
+
+// removeUnusedImports removes imports that were only used by generic declarations or by
+// generic calls and instances from other packages. Blank and dot imports are kept.
+func removeUnusedImports(fset *token.FileSet, imp types.Importer, files []*ast.File) {
+	typesCfg := types.Config{
+		Importer: imp,
+		Error:    func(error) {},
+	}
+	info := types.Info{
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Implicits: make(map[ast.Node]types.Object),
+	}
+	typesCfg.Check("", fset, files, &info)
+
+	used := make(map[types.Object]bool)
+	for _, obj := range info.Uses {
+		if pkgName, ok := obj.(*types.PkgName); ok {
+			used[pkgName] = true
+		}
+	}
+
+	for _, file := range files {
+		var removed []ast.Node
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.GenDecl)
+			if !ok || decl.Tok != token.IMPORT {
+				continue
+			}
+
+			var specs []ast.Spec
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.ImportSpec)
+				if spec.Name != nil && (spec.Name.Name == "_" || spec.Name.Name == ".") {
+					// blank and dot imports are never referred to by name
+					specs = append(specs, spec)
+					continue
+				}
+				obj := info.Implicits[spec]
+				if spec.Name != nil {
+					obj = info.Defs[spec.Name]
+				}
+				if obj == nil || used[obj] {
+					specs = append(specs, spec)
+				} else {
+					removed = append(removed, spec)
+				}
+			}
+			decl.Specs = specs
+		}
+
+		var decls []ast.Decl
+		for _, decl := range file.Decls {
+			if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.IMPORT && len(decl.Specs) == 0 {
+				if decl.Lparen.IsValid() {
+					removed = append(removed, decl)
+				} else if decl.Doc != nil {
+					// without parentheses and specs, the declaration has no end
+					removed = append(removed, decl.Doc)
+				}
+				continue
+			}
+			decls = append(decls, decl)
+		}
+		file.Decls = decls
+		file.Comments = removeComments(file.Comments, removed)
+	}
+}
@@ -0,0 +1,891 @@
+package degen_test
+
+import (
+	goast "go/ast"
+	goimporter "go/importer"
+	goparser "go/parser"
+	gotoken "go/token"
+	gotypes "go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/faiface/generics/degen"
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/parser"
+	"github.com/faiface/generics/go/printer"
+	"github.com/faiface/generics/go/scanner"
+	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
+)
+
+const translateSrc = `package main
+
+// List is a linked list.
+type List(type T) struct {
+	Value T
+	Next  *List(T)
+}
+
+func (l *List(type T)) Len() int {
+	if l == nil {
+		return 0
+	}
+	return 1 + l.Next.Len()
+}
+
+// Push prepends x to the list.
+func Push(l *List(type T), x T) *List(T) {
+	return &List(T){Value: x, Next: l}
+}
+
+func main() {
+	println(Push(Push(nil, 1), 2).Len())
+}
+`
+
+// TestTranslate checks the translated files and the instances reported by Translate.
+func TestTranslate(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "list.go", translateSrc, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := degen.Translate(fset, []*ast.File{file}, degen.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Files) != 1 {
+		t.Fatalf("got %d files, want 1", len(result.Files))
+	}
+
+	var printed strings.Builder
+	printer.Fprint(&printed, fset, result.Files[0])
+	for _, generic := range []string{"type List struct", "func Push(", "List(T)"} {
+		if strings.Contains(printed.String(), generic) {
+			t.Errorf("translated file contains %q:\n%s", generic, printed.String())
+		}
+	}
+
+	want := map[string]int{"Push_int": 1, "List_int": 2}
+	if len(result.Instances) != len(want) {
+		t.Fatalf("got %d instances, want %d", len(result.Instances), len(want))
+	}
+	for _, inst := range result.Instances {
+		numDecls, ok := want[inst.Name]
+		if !ok {
+			t.Errorf("unexpected instance %s", inst.Name)
+			continue
+		}
+		if len(inst.Decls) != numDecls {
+			t.Errorf("%s has %d declarations, want %d", inst.Name, len(inst.Decls), numDecls)
+		}
+		if inst.Generic == nil || !strings.HasPrefix(inst.Name, inst.Generic.Name()+"_") {
+			t.Errorf("%s is instantiated from %v", inst.Name, inst.Generic)
+		}
+		for _, decl := range inst.Decls {
+			if pos := result.Positions[decl]; !pos.IsValid() {
+				t.Errorf("declaration of %s has no generic position", inst.Name)
+			}
+		}
+	}
+}
+
+// TestDegen checks that Degen keeps the generic declarations along with the instances.
+func TestDegen(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "list.go", translateSrc, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := degen.Degen(fset, []*ast.File{file}, degen.Options{Mangling: degen.Readable})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var printed strings.Builder
+	printer.Fprint(&printed, fset, output[0])
+	for _, want := range []string{"type List(type T) struct", "func Push(", "type List_int struct", "func Push_int(", "Push_int(Push_int(nil, 1), 2).Len()"} {
+		if !strings.Contains(printed.String(), want) {
+			t.Errorf("output doesn't contain %q:\n%s", want, printed.String())
+		}
+	}
+}
+
+const directivesSrc = `//go:build linux
+
+package main
+
+// Reverse reverses a.
+//
+//go:noinline
+func Reverse(a []type T) {
+	for i, j := 0, len(a)-1; i < j; i, j = i+1, j-1 {
+		a[i], a[j] = a[j], a[i]
+	}
+}
+
+func main() {
+	Reverse([]int{1, 2})
+}
+`
+
+// TestTranslateDirectives checks that the line telling where an instance is from goes into the
+// text of its doc comment, above the directives.
+func TestTranslateDirectives(t *testing.T) {
+	const want = `// Reverse reverses a.
+//
+// Reverse instantiated with T=int from directives.go:8
+//
+//go:noinline
+func Reverse_int(`
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "directives.go", directivesSrc, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := degen.Translate(fset, []*ast.File{file}, degen.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var printed strings.Builder
+	printer.Fprint(&printed, fset, result.Files[0])
+	if !strings.HasPrefix(printed.String(), "//go:build linux\n\npackage main\n") || !strings.Contains(printed.String(), want) {
+		t.Errorf("got:\n%s\nwant the build constraint above the package clause, and:\n%s", printed.String(), want)
+	}
+}
+
+const floatingCommentsSrc = `package main
+
+// one
+
+func main() {
+	println(First([]int{1}), Last([]string{"a"}))
+}
+
+// two
+
+// First returns the first element.
+func First(xs []type T) T { return xs[0] }
+
+// three
+
+// Last returns the last element.
+func Last(xs []type T) T { return xs[len(xs)-1] }
+
+// four
+`
+
+// TestTranslateFloatingComments checks that instances are printed where their generic
+// declarations were, so that the comments around them keep their places.
+func TestTranslateFloatingComments(t *testing.T) {
+	const want = `package main
+
+// one
+
+func main() {
+	println(First_int([]int{1}), Last_string([]string{"a"}))
+}
+
+// two
+
+// First returns the first element.
+//
+// First instantiated with T=int from floating.go:12
+func First_int(xs []int) int {
+	return xs[0]
+}
+
+// three
+
+// Last returns the last element.
+//
+// Last instantiated with T=string from floating.go:17
+func Last_string(xs []string) string {
+	return xs[len(xs)-1]
+}
+
+// four
+`
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "floating.go", floatingCommentsSrc, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := degen.Translate(fset, []*ast.File{file}, degen.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var printed strings.Builder
+	(&printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}).Fprint(&printed, fset, result.Files[0])
+	if printed.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", printed.String(), want)
+	}
+}
+
+// TestTranslateDiagnostics checks that Translate reports problems as diagnostics.
+func TestTranslateDiagnostics(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "bad.go", "package main\n\nfunc main() { undefined() }\n", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := degen.Translate(fset, []*ast.File{file}, degen.Options{})
+	if _, ok := err.(scanner.ErrorList); !ok {
+		t.Fatalf("got error %v, want a scanner.ErrorList", err)
+	}
+	if result == nil || result.Files != nil || len(result.Diagnostics) != 1 {
+		t.Fatalf("got result %+v, want one diagnostic and no files", result)
+	}
+	if pos := result.Diagnostics[0].Pos; pos.Filename != "bad.go" || pos.Line != 3 {
+		t.Errorf("got diagnostic at %v, want at bad.go:3", pos)
+	}
+}
+
+const recursiveSrc = `package main
+
+type List(type T) struct {
+	First T
+	Rest  *List(T)
+}
+
+func Map(l *List(type T), f func(T) type U) *List(U) {
+	if l == nil {
+		return nil
+	}
+	return &List(U){f(l.First), Map(l.Rest, f)}
+}
+
+func main() {
+	Map(&List(int){1, nil}, func(x int) string { return "x" })
+}
+`
+
+// TestTranslateRecursive checks that a recursive generic call in instantiated code calls the
+// instance it's in.
+func TestTranslateRecursive(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "map.go", recursiveSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := degen.Translate(fset, []*ast.File{file}, degen.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var printed strings.Builder
+	printer.Fprint(&printed, fset, result.Files[0])
+	if want := "return &List_string{f(l.First), Map_int_string(l.Rest, f)}"; !strings.Contains(printed.String(), want) {
+		t.Errorf("translated file doesn't contain %q:\n%s", want, printed.String())
+	}
+	if len(result.Instances) != 3 {
+		var names []string
+		for _, inst := range result.Instances {
+			names = append(names, inst.Name)
+		}
+		t.Errorf("got instances %v, want Map_int_string, List_int and List_string", names)
+	}
+}
+
+// TestTranslateEndless checks that chains of instantiations with growing type arguments are
+// reported, even when the arguments trade places, and without a maximum depth.
+func TestTranslateEndless(t *testing.T) {
+	tests := map[string]string{
+		"nested":  "func F(x type T) { F([]T{x}) }\n\nfunc main() { F(1) }\n",
+		"swapped": "func F(x type T, y type U) { F(y, []T{x}) }\n\nfunc main() { F(1, \"a\") }\n",
+		"mutual":  "func F(x type T) { G(x, x) }\n\nfunc G(x type T, y type U) { F([]U{y}) }\n\nfunc main() { F(1) }\n",
+	}
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "endless.go", "package main\n\n"+src, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = degen.Translate(fset, []*ast.File{file}, degen.Options{})
+			if err == nil || !strings.Contains(err.Error(), "endless instantiation") {
+				t.Errorf("got error %v, want endless instantiation", err)
+			}
+		})
+	}
+}
+
+const conversionsSrc = `package main
+
+func Average(xs []type T num) float64 {
+	var sum float64
+	for _, x := range xs {
+		sum += float64(x)
+	}
+	return sum / float64(len(xs))
+}
+
+func Convert(x type T num, _ type U num) U {
+	return U(x)
+}
+
+func main() {
+	println(Average([]int{1, 2}), Convert(2.5, int8(0)), Average([]complex128{1}))
+}
+`
+
+const interfaceRestrictionSrc = `package main
+
+type Lener interface {
+	Len() int
+}
+
+type Words []string
+
+func (w Words) Len() int { return len(w) }
+
+func Total(xs []type T Lener) int {
+	total := 0
+	for _, x := range xs {
+		total += x.Len()
+	}
+	return total
+}
+
+func main() {
+	println(Total([]Words{{"a"}, {"b", "c"}}))
+}
+`
+
+const integerRestrictionSrc = `package main
+
+func Hash(data []type T integer, seed T) T {
+	h := seed
+	for i, x := range data {
+		h ^= x << uint(i%3)
+		h = h<<5 | h>>3
+		h &^= 1 << uint(i)
+		h %= 127
+	}
+	return h
+}
+
+func main() {
+	println(Hash([]uint32{1, 2, 3}, 7), Hash([]int8{-1}, 0))
+}
+`
+
+const importsSrc = `package main
+
+import (
+	_ "embed"
+	. "strings"
+)
+
+func Shout(xs []type T, f func(T) string) []string {
+	var ys []string
+	for _, x := range xs {
+		ys = append(ys, ToUpper(f(x)))
+	}
+	return ys
+}
+
+func main() {
+	println(len(Shout([]int{1}, func(int) string { return "a" })))
+}
+`
+
+const packageVarsSrc = `package main
+
+import "unsafe"
+
+type Stack(type T) struct {
+	items []T
+}
+
+func (s *Stack(type T)) Push(x T) { s.items = append(s.items, x) }
+
+func Max(x, y type T ord) T {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+var x = Max(1, 2)
+
+var s Stack(int)
+
+var (
+	names = Stack(string){}
+	first = Max("a", "b")
+)
+
+const size = unsafe.Sizeof(Stack(int){})
+
+func main() {
+	s.Push(x)
+	names.Push(first)
+	println(len(s.items), len(names.items), size)
+}
+`
+
+const arrayLengthSrc = `package main
+
+func Reverse(a *[const n]type T) {
+	for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+		a[i], a[j] = a[j], a[i]
+	}
+}
+
+func main() {
+	a := [5]int{1, 2, 3, 4, 5}
+	Reverse(&a)
+	Reverse(&[2]string{"a", "b"})
+	println(a[0])
+}
+`
+
+const foreignTypesSrc = `package main
+
+import "time"
+
+type Duration string
+
+func First(xs []type T) T {
+	return xs[0]
+}
+
+func main() {
+	println(First([]time.Duration{time.Second}), First([]Duration{"s"}))
+}
+`
+
+const nestedInstancesSrc = `package main
+
+type List(type T) struct {
+	Value T
+	Next  *List(T)
+}
+
+func Map(xs []type T, f func(T) type U) []U {
+	ys := make([]U, 0, len(xs))
+	for _, x := range xs {
+		ys = append(ys, f(x))
+	}
+	return ys
+}
+
+func main() {
+	lists := Map([]int{1, 2}, func(x int) *List(int) { return &List(int){Value: x} })
+	var nested List(List(int))
+	println(len(lists), nested.Value.Value)
+}
+`
+
+// translateCase is a source translated in each mode, along with what's expected of the output.
+type translateCase struct {
+	name      string
+	src       string
+	instances []string // names of the instances
+	want      []string // parts of the printed output
+	diag      string   // part of the only diagnostic, with its position, if the source doesn't translate
+
+	// check checks the output, type-checked again; it may be nil
+	check func(t *testing.T, file *ast.File, info *types.Info)
+}
+
+var translateModes = []struct {
+	name string
+	mode degen.Mode
+}{
+	{"monomorphize", degen.Monomorphize},
+	{"dictionary", degen.Dictionary},
+	{"shape", degen.Shape},
+}
+
+// testTranslate translates the source of each case in each mode, and checks the output. The
+// output must type-check.
+func testTranslate(t *testing.T, cases []translateCase) {
+	for _, c := range cases {
+		for _, m := range translateModes {
+			t.Run(c.name+"/"+m.name, func(t *testing.T) {
+				if c.diag != "" {
+					fset := token.NewFileSet()
+					file, err := parser.ParseFile(fset, c.name+".go", c.src, 0)
+					if err != nil {
+						t.Fatal(err)
+					}
+					result, _ := degen.Translate(fset, []*ast.File{file}, degen.Options{Mode: m.mode})
+					if len(result.Diagnostics) != 1 || !strings.Contains(result.Diagnostics[0].Error(), c.diag) {
+						t.Errorf("got diagnostics %v, want one containing %q", result.Diagnostics, c.diag)
+					}
+					return
+				}
+
+				result, printed, file, info := translateChecked(t, c.name, c.src, m.mode)
+				var names []string
+				for _, inst := range result.Instances {
+					names = append(names, inst.Name)
+				}
+				for _, name := range c.instances {
+					if !containsString(names, name) {
+						t.Errorf("no instance %s among %v", name, names)
+					}
+				}
+				for _, want := range c.want {
+					if !strings.Contains(printed, want) {
+						t.Errorf("translated file doesn't contain %q:\n%s", want, printed)
+					}
+				}
+				if c.check != nil {
+					c.check(t, file, info)
+				}
+			})
+		}
+	}
+}
+
+// translateChecked translates a source in a mode, and returns the result along with the printed
+// output, parsed and type-checked again. The output must type-check.
+func translateChecked(t *testing.T, name, src string, mode degen.Mode) (*degen.Result, string, *ast.File, *types.Info) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, name+".go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := degen.Translate(fset, []*ast.File{file}, degen.Options{Mode: mode})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var printed strings.Builder
+	printer.Fprint(&printed, fset, result.Files[0])
+
+	fset = token.NewFileSet()
+	file, err = parser.ParseFile(fset, name+".go", printed.String(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	if _, err := (&types.Config{Importer: degen.NewImporter(fset)}).Check("main", fset, []*ast.File{file}, info); err != nil {
+		t.Fatalf("translated file doesn't type-check: %v\n%s", err, printed.String())
+	}
+
+	// the toolchain must compile it too
+	gofile, err := goparser.ParseFile(hostFset, name+".go", printed.String(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&gotypes.Config{Importer: hostImporter}).Check("main", hostFset, []*goast.File{gofile}, nil); err != nil {
+		t.Fatalf("translated file doesn't type-check with the toolchain: %v\n%s", err, printed.String())
+	}
+	return result, printed.String(), file, info
+}
+
+// hostImporter imports packages of the standard library for the go/types package of the
+// toolchain, from the export data of its compiler.
+var (
+	hostFset     = gotoken.NewFileSet()
+	hostImporter = goimporter.ForCompiler(hostFset, "gc", nil)
+)
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// TestTranslateFeatures translates sources using features of generics in each mode.
+func TestTranslateFeatures(t *testing.T) {
+	testTranslate(t, []translateCase{
+		{
+			// conversions involving type parameters are checked for each instance
+			name: "conv",
+			src:  conversionsSrc,
+			diag: "conv.go:6:10: cannot convert complex128 to float64 in Average(complex128)",
+		},
+		{
+			// instances of a type parameter restricted by an interface call its methods directly
+			name:      "len",
+			src:       interfaceRestrictionSrc,
+			instances: []string{"Total_Words"},
+			want:      []string{"Total_Words([]Words{{\"a\"}, {\"b\", \"c\"}})", ".Len()"},
+		},
+		{
+			// type arguments must implement the interface
+			name: "len",
+			src:  strings.Replace(interfaceRestrictionSrc, `Total([]Words{{"a"}, {"b", "c"}})`, "Total([]int{1})", 1),
+			diag: "len.go:20:16: cannot use",
+		},
+		{
+			// the integer restriction allows the integer operators
+			name:      "hash",
+			src:       integerRestrictionSrc,
+			instances: []string{"Hash_uint32", "Hash_int8"},
+			want:      []string{"%= 127", "&^= 1 <<", "<<", "Hash_uint32([]uint32{1, 2, 3}, 7), Hash_int8([]int8{-1}, 0)"},
+		},
+		{
+			// and rejects other numeric types
+			name: "hash",
+			src:  strings.Replace(integerRestrictionSrc, "Hash([]int8{-1}, 0)", "Hash([]float64{1}, 0)", 1),
+			diag: "[]float64",
+		},
+		{
+			// blank and dot imports aren't referred to by name, but they're used
+			name:      "imports",
+			src:       importsSrc,
+			instances: []string{"Shout_int"},
+			want:      []string{"_ \"embed\"", ". \"strings\"", "ToUpper("},
+		},
+		{
+			// generic calls and instances in package-level declarations
+			name:      "vars",
+			src:       packageVarsSrc,
+			instances: []string{"Max_int", "Stack_int", "Stack_string"},
+			want:      []string{"var x = Max_int(1, 2)", "var s Stack_int", "const size = unsafe.Sizeof(Stack_int{})", "Stack_string{}"},
+		},
+		{
+			// the length of an array is inferred and replaces its parameter
+			name:      "length",
+			src:       arrayLengthSrc,
+			instances: []string{"Reverse_5_int", "Reverse_2_string"},
+			want:      []string{"a *[5]int", "j := 0, 5-1", "Reverse_5_int(&a)"},
+		},
+		{
+			// named types of other packages are qualified, and don't collide with local ones
+			name:      "foreign",
+			src:       foreignTypesSrc,
+			instances: []string{"First_time_Duration", "First_Duration"},
+			want:      []string{"[]time.Duration) time.Duration", "[]Duration) Duration"},
+		},
+		{
+			// instances are type arguments of other instances
+			name:      "nested",
+			src:       nestedInstancesSrc,
+			instances: []string{"List_int", "List_List_int", "Map_int_ptr_List_int"},
+			want:      []string{"*List_List_int", "[]*List_int", "var nested List_List_int"},
+		},
+		{
+			name:      "sizes",
+			src:       sizesSrc,
+			instances: []string{"Size_int", "Size_string", "Align_int8", "Offset_int8_int64", "Offset_string_bool"},
+			check:     checkSizes,
+		},
+	})
+}
+
+// unexportedFiles make up a module, whose collections package refers to its unexported
+// declarations from generic code.
+var unexportedFiles = map[string]string{
+	"go.mod": "module example.com/m\n",
+	"collections/collections.go": `package collections
+
+import "strings"
+
+// Map applies f to each element of xs.
+func Map(xs []type T, f func(T) type U) []U {
+	ys := make([]U, 0, capacity(len(xs)))
+	for _, x := range xs {
+		ys = append(ys, f(x))
+	}
+	return ys
+}
+
+const spare = 2
+
+func capacity(n int) int { return n + spare }
+
+type counter struct{ n int }
+
+func (c *counter) inc() { c.n++ }
+
+// Count counts the elements of xs.
+func Count(xs []type T) int {
+	var c counter
+	for range xs {
+		c.inc()
+	}
+	return c.n
+}
+
+var total int
+
+// Add adds the length of xs to the total.
+func Add(xs []type T) { total += len(xs) }
+
+// Join joins the strings of xs.
+func Join(xs []type T, f func(T) string) string {
+	return strings.Join(Map(xs, f), ",")
+}
+`,
+	"main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/m/collections"
+)
+
+func main() {
+	println(len(collections.Map([]int{1}, func(x int) string { return "x" })), collections.Count([]string{"a"}))
+	fmt.Println(collections.Join([]int{1, 2}, func(x int) string { return fmt.Sprint(x) }))
+}
+`,
+}
+
+// TestTranslateUnexported checks that instances of generic code from another package get
+// copies of the unexported functions and types it refers to, and that unexported variables are
+// reported.
+func TestTranslateUnexported(t *testing.T) {
+	dir := t.TempDir()
+	for name, src := range unexportedFiles {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, m := range translateModes {
+		t.Run(m.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, filepath.Join(dir, "main.go"), nil, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := degen.Translate(fset, []*ast.File{file}, degen.Options{Mode: m.mode})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var printed strings.Builder
+			printer.Fprint(&printed, fset, result.Files[0])
+			for _, want := range []string{
+				"func collections_capacity(n int) int",
+				"return n + 2",
+				"collections_capacity(",
+				"type collections_counter struct",
+				"func (c *collections_counter) inc()",
+				"var c collections_counter",
+			} {
+				if !strings.Contains(printed.String(), want) {
+					t.Errorf("translated file doesn't contain %q:\n%s", want, printed.String())
+				}
+			}
+
+			// imports of copied code join the imports of the file
+			if n := strings.Count(printed.String(), "import"); n != 1 || !strings.Contains(printed.String(), `"strings"`) {
+				t.Errorf("translated file has %d import declarations, want one importing strings:\n%s", n, printed.String())
+			}
+
+			fset = token.NewFileSet()
+			file, err = parser.ParseFile(fset, "main.go", printed.String(), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := (&types.Config{Importer: degen.NewImporter(fset)}).Check("main", fset, []*ast.File{file}, nil); err != nil {
+				t.Fatalf("translated file doesn't type-check: %v\n%s", err, printed.String())
+			}
+		})
+	}
+
+	t.Run("variable", func(t *testing.T) {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, filepath.Join(dir, "main.go"), strings.Replace(unexportedFiles["main.go"], "println(", "collections.Add([]int{1})\n\tprintln(", 1), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := degen.Translate(fset, []*ast.File{file}, degen.Options{})
+		if want := "total is an unexported variable"; err == nil || len(result.Diagnostics) != 1 || !strings.Contains(result.Diagnostics[0].Error(), want) {
+			t.Errorf("got error %v, want one diagnostic containing %q", err, want)
+		}
+	})
+}
+
+const collisionSrc = `package main
+
+func Reverse(xs []type T) {
+	for i, j := 0, len(xs)-1; i < j; i, j = i+1, j-1 {
+		xs[i], xs[j] = xs[j], xs[i]
+	}
+}
+
+// Reverse_int is declared by hand, so the instance must not take its name.
+func Reverse_int() {}
+
+func main() {
+	Reverse_int()
+	Reverse([]int{1, 2})
+}
+`
+
+// TestTranslateCollision checks that an instance whose name is taken by a declaration of the
+// package is numbered.
+func TestTranslateCollision(t *testing.T) {
+	testTranslate(t, []translateCase{
+		{
+			name:      "collision",
+			src:       collisionSrc,
+			instances: []string{"Reverse_int_2"},
+			want:      []string{"func Reverse_int()", "Reverse_int_2([]int{1, 2})"},
+		},
+	})
+}
+
+const nestedSrc = `package main
+
+func Len(x type T) int { return 1 }
+
+func main() {
+	println(Len(map[string][]map[int][]*[]chan map[string]int{}), Len(map[string][]map[int][]*[]chan map[string]uint{}))
+}
+`
+
+// TestTranslateHashed checks that hashed names of instances stay short however deeply nested
+// their type arguments are, and that they're the same in each translation.
+func TestTranslateHashed(t *testing.T) {
+	translate := func() []string {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, "nested.go", nestedSrc, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := degen.Translate(fset, []*ast.File{file}, degen.Options{Mangling: degen.Hashed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, inst := range result.Instances {
+			names = append(names, inst.Name)
+		}
+		return names
+	}
+
+	names := translate()
+	if len(names) != 2 || names[0] == names[1] {
+		t.Fatalf("got instances %v, want two with different names", names)
+	}
+	for _, name := range names {
+		// Len_ followed by 8 hexadecimal digits
+		if len(name) != len("Len_")+8 || !strings.HasPrefix(name, "Len_") {
+			t.Errorf("hashed name %s isn't Len_ followed by a hash", name)
+		}
+	}
+	if again := translate(); strings.Join(again, " ") != strings.Join(names, " ") {
+		t.Errorf("translated again, got instances %v, want %v", again, names)
+	}
+}
@@ -1 +1,3 @@
 module github.com/faiface/generics
+
+go 1.22
@@ -373,6 +373,7 @@ const (
 	RestrictionEq = 1 << iota
 	RestrictionOrd
 	RestrictionNum
+	RestrictionInteger
 )
 
 // A type is represented by a tree consisting of one
@@ -431,6 +432,14 @@ type (
 		Type        token.Pos
 		Name        *Ident
 		Restriction Restriction
+		Interface   Expr // interface restriction (*Ident, *SelectorExpr or *InterfaceType); or nil
+	}
+
+	// A ConstParam node represents the first occurrence of a generic array
+	// length in a function signature.
+	ConstParam struct {
+		Const token.Pos // position of "const" keyword
+		Name  *Ident
 	}
 )
 
@@ -469,16 +478,27 @@ func (x *InterfaceType) Pos() token.Pos { return x.Interface }
 func (x *MapType) Pos() token.Pos       { return x.Map }
 func (x *ChanType) Pos() token.Pos      { return x.Begin }
 func (x *TypeParam) Pos() token.Pos     { return x.Type }
+func (x *ConstParam) Pos() token.Pos    { return x.Const }
 
 func (x *BadExpr) End() token.Pos { return x.To }
-func (x *Ident) End() token.Pos   { return token.Pos(int(x.NamePos) + len(x.Name)) }
+func (x *Ident) End() token.Pos {
+	if !x.NamePos.IsValid() {
+		return token.NoPos // generated identifier without position
+	}
+	return token.Pos(int(x.NamePos) + len(x.Name))
+}
 func (x *Ellipsis) End() token.Pos {
 	if x.Elt != nil {
 		return x.Elt.End()
 	}
 	return x.Ellipsis + 3 // len("...")
 }
-func (x *BasicLit) End() token.Pos       { return token.Pos(int(x.ValuePos) + len(x.Value)) }
+func (x *BasicLit) End() token.Pos {
+	if !x.ValuePos.IsValid() {
+		return token.NoPos // generated literal without position
+	}
+	return token.Pos(int(x.ValuePos) + len(x.Value))
+}
 func (x *FuncLit) End() token.Pos        { return x.Body.End() }
 func (x *CompositeLit) End() token.Pos   { return x.Rbrace + 1 }
 func (x *ParenExpr) End() token.Pos      { return x.Rparen + 1 }
@@ -502,7 +522,13 @@ func (x *FuncType) End() token.Pos {
 func (x *InterfaceType) End() token.Pos { return x.Methods.End() }
 func (x *MapType) End() token.Pos       { return x.Value.End() }
 func (x *ChanType) End() token.Pos      { return x.Value.End() }
-func (x *TypeParam) End() token.Pos     { return x.Name.End() }
+func (x *TypeParam) End() token.Pos {
+	if x.Interface != nil {
+		return x.Interface.End()
+	}
+	return x.Name.End()
+}
+func (x *ConstParam) End() token.Pos { return x.Name.End() }
 
 // exprNode() ensures that only expression/type nodes can be
 // assigned to an Expr.
@@ -531,6 +557,7 @@ func (*InterfaceType) exprNode() {}
 func (*MapType) exprNode()       {}
 func (*ChanType) exprNode()      {}
 func (*TypeParam) exprNode()     {}
+func (*ConstParam) exprNode()    {}
 
 // ----------------------------------------------------------------------------
 // Convenience functions for Idents
@@ -946,12 +973,13 @@ type (
 
 	// A FuncDecl node represents a function declaration.
 	FuncDecl struct {
-		Doc        *CommentGroup // associated documentation; or nil
-		TypeParams []*TypeParam  // type parameters declared in the signature; sorted by name
-		Recv       *FieldList    // receiver (methods); or nil (functions)
-		Name       *Ident        // function/method name
-		Type       *FuncType     // function signature: parameters, results, and position of "func" keyword
-		Body       *BlockStmt    // function body; or nil for external (non-Go) function
+		Doc         *CommentGroup // associated documentation; or nil
+		TypeParams  []*TypeParam  // type parameters declared in the signature; sorted by name
+		ConstParams []*ConstParam // generic array lengths declared in the signature; sorted by name
+		Recv        *FieldList    // receiver (methods); or nil (functions)
+		Name        *Ident        // function/method name
+		Type        *FuncType     // function signature: parameters, results, and position of "func" keyword
+		Body        *BlockStmt    // function body; or nil for external (non-Go) function
 	}
 )
 
@@ -152,6 +152,8 @@ func filterType(typ Expr, f Filter, export bool) bool {
 		return filterType(t.Value, f, export)
 	case *TypeParam:
 		return true
+	case *ConstParam:
+		return true
 	}
 	return false
 }
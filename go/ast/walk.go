@@ -180,6 +180,12 @@ func Walk(v Visitor, node Node) {
 
 	case *TypeParam:
 		Walk(v, n.Name)
+		if n.Interface != nil {
+			Walk(v, n.Interface)
+		}
+
+	case *ConstParam:
+		Walk(v, n.Name)
 
 	// Statements
 	case *BadStmt:
@@ -12,6 +12,8 @@ import (
 	"github.com/faiface/generics/go/doc"
 	"github.com/faiface/generics/go/parser"
 	"github.com/faiface/generics/go/token"
+	gobuild "go/build"
+	"go/build/constraint"
 	"io"
 	"io/ioutil"
 	"log"
@@ -291,11 +293,10 @@ func defaultContext() Context {
 	// in all releases >= Go 1.x. Code that requires Go 1.x or later should
 	// say "+build go1.x", and code that should only be built before Go 1.x
 	// (perhaps it is the stub to use in that case) should say "+build !go1.x".
-	// NOTE: If you add to this list, also update the doc comment in doc.go.
-	const version = 10 // go1.10
-	for i := 1; i <= version; i++ {
-		c.ReleaseTags = append(c.ReleaseTags, "go1."+strconv.Itoa(i))
-	}
+	// The sources in GOROOT are as new as the toolchain this program is
+	// built with, so the release tags are those of its go/build package,
+	// which it keeps up to date.
+	c.ReleaseTags = append([]string(nil), gobuild.Default.ReleaseTags...)
 
 	env := os.Getenv("CGO_ENABLED")
 	if env == "" {
@@ -1161,6 +1162,10 @@ var binaryOnlyComment = []byte("//go:binary-only-package")
 //
 // marks the file as applicable only on Windows and Linux.
 //
+// A '//go:build' line, like '//go:build windows || linux', takes
+// precedence over the '// +build' lines. The file is accepted only
+// if its expression is satisfied.
+//
 // If shouldBuild finds a //go:binary-only-package comment in the file,
 // it sets *binaryOnly to true. Otherwise it does not change *binaryOnly.
 //
@@ -1192,6 +1197,7 @@ func (ctxt *Context) shouldBuild(content []byte, allTags map[string]bool, binary
 	// Pass 2.  Process each line in the run.
 	p = content
 	allok := true
+	goBuild, goBuildOK := false, true
 	for len(p) > 0 {
 		line := p
 		if i := bytes.IndexByte(line, '\n'); i >= 0 {
@@ -1206,6 +1212,16 @@ func (ctxt *Context) shouldBuild(content []byte, allTags map[string]bool, binary
 		if bytes.Equal(line, binaryOnlyComment) {
 			sawBinaryOnly = true
 		}
+		if constraint.IsGoBuild(string(line)) {
+			expr, err := constraint.Parse(string(line))
+			if !goBuild {
+				goBuildOK = err == nil && expr.Eval(func(tag string) bool {
+					return ctxt.match(tag, allTags)
+				})
+			}
+			goBuild = true
+			continue
+		}
 		line = bytes.TrimSpace(line[len(slashslash):])
 		if len(line) > 0 && line[0] == '+' {
 			// Looks like a comment +line.
@@ -1228,6 +1244,9 @@ func (ctxt *Context) shouldBuild(content []byte, allTags map[string]bool, binary
 		*binaryOnly = true
 	}
 
+	if goBuild {
+		return goBuildOK
+	}
 	return allok
 }
 
@@ -1499,6 +1518,15 @@ func (ctxt *Context) match(name string, allTags map[string]bool) bool {
 	if ctxt.GOOS == "android" && name == "linux" {
 		return true
 	}
+	if ctxt.GOOS == "illumos" && name == "solaris" {
+		return true
+	}
+	if ctxt.GOOS == "ios" && name == "darwin" {
+		return true
+	}
+	if name == "unix" && unixOS[ctxt.GOOS] {
+		return true
+	}
 
 	// other tags
 	for _, tag := range ctxt.BuildTags {
@@ -1583,11 +1611,15 @@ func (ctxt *Context) goodOSArchFile(name string, allTags map[string]bool) bool {
 
 var knownOS = make(map[string]bool)
 var knownArch = make(map[string]bool)
+var unixOS = make(map[string]bool)
 
 func init() {
 	for _, v := range strings.Fields(goosList) {
 		knownOS[v] = true
 	}
+	for _, v := range strings.Fields(unixOSList) {
+		unixOS[v] = true
+	}
 	for _, v := range strings.Fields(goarchList) {
 		knownArch[v] = true
 	}
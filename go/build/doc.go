@@ -107,6 +107,7 @@
 //	- "go1.8", from Go version 1.8 onward
 //	- "go1.9", from Go version 1.9 onward
 //	- "go1.10", from Go version 1.10 onward
+//	- and so on, up to the version of the toolchain this program is built with
 //	- any additional words listed in ctxt.BuildTags
 //
 // If a file's name, after stripping the extension and a possible _test suffix,
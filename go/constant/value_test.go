@@ -0,0 +1,32 @@
+package constant
+
+import (
+	"testing"
+
+	"github.com/faiface/generics/go/token"
+)
+
+// TestLiterals checks the values of the number literals of current Go.
+func TestLiterals(t *testing.T) {
+	tests := []struct {
+		lit  string
+		tok  token.Token
+		want string // exact string of the value
+	}{
+		{"0b1010", token.INT, "10"},
+		{"0o17", token.INT, "15"},
+		{"017", token.INT, "15"},
+		{"1_000_000", token.INT, "1000000"},
+		{"0x_FF", token.INT, "255"},
+		{"0x1p-2", token.FLOAT, "1/4"},
+		{"0x1.8p1", token.FLOAT, "3"},
+		{"1_0.2_5", token.FLOAT, "41/4"},
+		{"0x1p4i", token.IMAG, "(0 + 16i)"},
+	}
+	for _, test := range tests {
+		val := MakeFromLiteral(test.lit, test.tok, 0)
+		if got := val.ExactString(); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.lit, got, test.want)
+		}
+	}
+}
@@ -14,6 +14,12 @@
 // entries where the spec permits exactly one. Consequently, the corresponding
 // field in the AST (ast.FuncDecl.Recv) field is not restricted to one entry.
 //
+// Generics are parsed in the syntax of the generics proposal this fork
+// implements, like func F(x type T) or List(int). Go's own type parameters,
+// like func F[T any](x T) or List[int], are out of scope and don't parse.
+// Packages of the standard library that use them are type-checked by the
+// toolchain instead (see degen.NewImporter).
+//
 package parser
 
 import (
@@ -59,6 +65,11 @@ type parser struct {
 	exprLev int  // < 0: in control clause, >= 0: in expression
 	inRhs   bool // if set, the parser is parsing a rhs expression
 
+	// Conversions of composite types, like []byte(s), where byte(s)
+	// would otherwise be parsed as a generic type instantiation
+	operandType bool          // if set, the parser is parsing the type of an operand
+	conversion  *ast.CallExpr // arguments of a conversion of the operand type; Fun is nil
+
 	// Ordinary identifier scopes
 	pkgScope   *ast.Scope        // pkgScope.Outer == nil
 	topScope   *ast.Scope        // top-most scope; may be pkgScope
@@ -675,30 +686,66 @@ func (p *parser) parseTypeName(genericOk bool) ast.Expr {
 	ident := p.parseIdent()
 	// don't resolve ident yet - it may be a parameter or field name
 
+	var typ ast.Expr = ident
 	if p.tok == token.PERIOD {
 		// ident is a package name
 		p.next()
 		p.resolve(ident)
 		sel := p.parseIdent()
-		return &ast.SelectorExpr{X: ident, Sel: sel}
+		typ = &ast.SelectorExpr{X: ident, Sel: sel}
 	}
 
 	if p.tok == token.LPAREN {
+		if p.operandType && typ == ident && predeclaredTypes[ident.Name] {
+			// conversion like []byte(s), predeclared types aren't generic
+			return typ
+		}
+
 		// generic type instatiation
 		lparen := p.pos
 		p.next()
-		p.resolve(ident)
+		if p.operandType && !startsType(p.tok) {
+			// conversion like []T("x"), the argument can't be a type
+			p.operandType = false
+			p.conversion = p.parseCallArgs(nil, lparen)
+			return typ
+		}
+		if typ == ident {
+			p.resolve(ident)
+		}
+		operandType := p.operandType
+		p.operandType = false
 		args := p.parseTypeList(genericOk)
+		p.operandType = operandType
 		rparen := p.expect(token.RPAREN)
 		return &ast.CallExpr{
-			Fun:    ident,
+			Fun:    typ,
 			Lparen: lparen,
 			Args:   args,
 			Rparen: rparen,
 		}
 	}
 
-	return ident
+	return typ
+}
+
+// predeclaredTypes are the names of the predeclared types.
+var predeclaredTypes = map[string]bool{
+	"any": true, "bool": true, "byte": true, "complex64": true, "complex128": true,
+	"error": true, "float32": true, "float64": true, "int": true, "int8": true,
+	"int16": true, "int32": true, "int64": true, "rune": true, "string": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"uintptr": true,
+}
+
+// startsType reports whether a type may start with the token.
+func startsType(tok token.Token) bool {
+	switch tok {
+	case token.IDENT, token.LBRACK, token.STRUCT, token.MUL, token.FUNC, token.INTERFACE,
+		token.MAP, token.CHAN, token.ARROW, token.LPAREN, token.TYPE:
+		return true
+	}
+	return false
 }
 
 func (p *parser) parseArrayType(genericOk bool) ast.Expr {
@@ -713,6 +760,8 @@ func (p *parser) parseArrayType(genericOk bool) ast.Expr {
 	if p.tok == token.ELLIPSIS {
 		len = &ast.Ellipsis{Ellipsis: p.pos}
 		p.next()
+	} else if genericOk && p.tok == token.CONST {
+		len = p.parseConstParam()
 	} else if p.tok != token.RBRACK {
 		len = p.parseRhs()
 	}
@@ -1101,16 +1150,31 @@ func (p *parser) parseTypeParam() *ast.TypeParam {
 	ident := p.parseIdent()
 	param := &ast.TypeParam{Type: pos, Name: ident}
 
-	for p.tok == token.IDENT {
-		switch p.lit {
-		case "eq":
+	for p.tok == token.IDENT || p.tok == token.INTERFACE {
+		switch {
+		case p.lit == "eq":
 			param.Restriction |= ast.RestrictionEq
-		case "ord":
+		case p.lit == "ord":
 			param.Restriction |= ast.RestrictionEq | ast.RestrictionOrd
-		case "num":
+		case p.lit == "num":
 			param.Restriction |= ast.RestrictionEq | ast.RestrictionNum
+		case p.lit == "integer":
+			param.Restriction |= ast.RestrictionEq | ast.RestrictionNum | ast.RestrictionInteger
 		default:
-			p.error(p.pos, fmt.Sprintf("invalid type restriction '%s', valid are 'eq', 'ord', and 'num'", p.lit))
+			// an interface restriction, named or literal
+			pos := p.pos
+			var iface ast.Expr
+			if p.tok == token.INTERFACE {
+				iface = p.parseInterfaceType(false)
+			} else {
+				iface = p.parseSimpleTypeName()
+				p.resolve(iface)
+			}
+			if param.Interface != nil {
+				p.error(pos, "type parameter can only be restricted by one interface")
+			}
+			param.Interface = iface
+			continue
 		}
 		p.next()
 	}
@@ -1120,6 +1184,21 @@ func (p *parser) parseTypeParam() *ast.TypeParam {
 	return param
 }
 
+// Parses and declares a generic array length in the current scope.
+func (p *parser) parseConstParam() *ast.ConstParam {
+	if p.trace {
+		defer un(trace(p, "ConstParam"))
+	}
+
+	pos := p.expect(token.CONST)
+	ident := p.parseIdent()
+	param := &ast.ConstParam{Const: pos, Name: ident}
+
+	p.declare(param, nil, p.topScope, ast.Con, ident)
+
+	return param
+}
+
 // If the result is an identifier, it is not resolved.
 func (p *parser) tryIdentOrType(genericOk bool) ast.Expr {
 	switch p.tok {
@@ -1265,10 +1344,19 @@ func (p *parser) parseOperand(lhs bool) ast.Expr {
 		return p.parseFuncTypeOrLit()
 	}
 
-	if typ := p.tryIdentOrType(false); typ != nil {
+	operandType := p.operandType
+	p.operandType = true
+	typ := p.tryIdentOrType(false)
+	p.operandType = operandType
+	if typ != nil {
 		// could be type for composite literal or conversion
 		_, isIdent := typ.(*ast.Ident)
 		assert(!isIdent, "type cannot be identifier")
+		if conv := p.conversion; conv != nil {
+			p.conversion = nil
+			conv.Fun = typ
+			return conv
+		}
 		return typ
 	}
 
@@ -1360,6 +1448,12 @@ func (p *parser) parseCallOrConversion(fun ast.Expr) *ast.CallExpr {
 	}
 
 	lparen := p.expect(token.LPAREN)
+	return p.parseCallArgs(fun, lparen)
+}
+
+// parseCallArgs parses the arguments of a call or conversion after its
+// opening parenthesis.
+func (p *parser) parseCallArgs(fun ast.Expr, lparen token.Pos) *ast.CallExpr {
 	p.exprLev++
 	var list []ast.Expr
 	var ellipsis token.Pos
@@ -2445,6 +2539,9 @@ func (p *parser) parseTypeSpec(doc *ast.CommentGroup, _ token.Token, _ int) ast.
 
 	if p.tok == token.LPAREN {
 		spec.Lparen = p.pos
+		if p.topScope.Outer != p.pkgScope {
+			p.error(p.pos, "generic types must be declared at package level")
+		}
 		p.next()
 		spec.Params = p.parseTypeParamList()
 		spec.Rparen = p.expect(token.RPAREN)
@@ -2517,22 +2614,32 @@ func (p *parser) parseFuncDecl() *ast.FuncDecl {
 	}
 	p.expectSemi()
 
-	var typeParams []*ast.TypeParam
+	var (
+		typeParams  []*ast.TypeParam
+		constParams []*ast.ConstParam
+	)
 	for _, obj := range p.topScope.Objects {
-		if typeParam, ok := obj.Decl.(*ast.TypeParam); ok {
-			typeParams = append(typeParams, typeParam)
+		switch param := obj.Decl.(type) {
+		case *ast.TypeParam:
+			typeParams = append(typeParams, param)
+		case *ast.ConstParam:
+			constParams = append(constParams, param)
 		}
 	}
 	sort.Slice(typeParams, func(i, j int) bool {
 		return typeParams[i].Name.Name < typeParams[j].Name.Name
 	})
+	sort.Slice(constParams, func(i, j int) bool {
+		return constParams[i].Name.Name < constParams[j].Name.Name
+	})
 	p.closeScope()
 
 	decl := &ast.FuncDecl{
-		Doc:        doc,
-		TypeParams: typeParams,
-		Recv:       recv,
-		Name:       ident,
+		Doc:         doc,
+		TypeParams:  typeParams,
+		ConstParams: constParams,
+		Recv:        recv,
+		Name:        ident,
 		Type: &ast.FuncType{
 			Func:    pos,
 			Params:  params,
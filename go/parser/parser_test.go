@@ -0,0 +1,48 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/faiface/generics/go/token"
+)
+
+// TestCurrentSyntax checks that the syntax of current Go parses along with the syntax of generics
+// in this proposal.
+func TestCurrentSyntax(t *testing.T) {
+	tests := []string{
+		"var x = 0b1010 + 0o17 + 1_000 + 0x1p-2",
+		"var x any",
+		"var x = min(1, 2) + max(3, 4)",
+		"func f(m map[string]int) { clear(m) }",
+		"func f() { for i := range 10 { _ = i } }",
+		"func f(seq func(func(int) bool)) { for x := range seq { _ = x } }",
+		"func f(b []byte) string { return string([]byte(b)) }",
+		"func f(x int) uint8 { return uint8(x) }",
+		"func f(p unsafe.Pointer) unsafe.Pointer { return unsafe.Add(p, 1) }",
+		"func f(x int, n int) int { return x << n }",
+		"func F(x type T) T { return x }",
+		"type List(type T) struct { Next *List(T) }",
+		"func f() []List(int) { return []List(int)(nil) }",
+	}
+	for _, src := range tests {
+		_, err := ParseFile(token.NewFileSet(), "", "package p\n\n"+src, DeclarationErrors)
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+		}
+	}
+}
+
+// TestGoTypeParams checks that Go's own type parameters are rejected. They're out of scope: this
+// proposal is an alternative to them.
+func TestGoTypeParams(t *testing.T) {
+	tests := []string{
+		"func F[T any](x T) T { return x }",
+		"type List[T any] struct { Next *List[T] }",
+	}
+	for _, src := range tests {
+		_, err := ParseFile(token.NewFileSet(), "", "package p\n\n"+src, 0)
+		if err == nil {
+			t.Errorf("%s: parsed without errors", src)
+		}
+	}
+}
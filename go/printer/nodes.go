@@ -391,6 +391,10 @@ func (p *printer) fieldList(fields *ast.FieldList, isStruct, isIncomplete bool)
 	rbrace := fields.Closing
 	hasComments := isIncomplete || p.commentBefore(p.posFor(rbrace))
 	srcIsOneLine := lbrace.IsValid() && rbrace.IsValid() && p.lineFor(lbrace) == p.lineFor(rbrace)
+	if !lbrace.IsValid() && !rbrace.IsValid() && len(list) == 0 {
+		// generated struct{} and interface{} have no positions
+		srcIsOneLine = true
+	}
 
 	if !hasComments && srcIsOneLine {
 		// possibly a one-line struct/interface
@@ -923,9 +927,19 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 		if x.Restriction&ast.RestrictionOrd != 0 {
 			p.print(blank, "ord")
 		}
-		if x.Restriction&ast.RestrictionNum != 0 {
+		if x.Restriction&ast.RestrictionInteger != 0 {
+			p.print(blank, "integer")
+		} else if x.Restriction&ast.RestrictionNum != 0 {
 			p.print(blank, "num")
 		}
+		if x.Interface != nil {
+			p.print(blank)
+			p.expr(x.Interface)
+		}
+
+	case *ast.ConstParam:
+		p.print(token.CONST, blank)
+		p.expr(x.Name)
 
 	default:
 		panic("unreachable")
@@ -1511,7 +1525,7 @@ func (p *printer) genDecl(d *ast.GenDecl) {
 	p.setComment(d.Doc)
 	p.print(d.Pos(), d.Tok, blank)
 
-	if d.Lparen.IsValid() {
+	if d.Lparen.IsValid() || len(d.Specs) > 1 {
 		// group of parenthesized declarations
 		p.print(d.Lparen, token.LPAREN)
 		if n := len(d.Specs); n > 0 {
@@ -1603,6 +1617,10 @@ func (p *printer) bodySize(b *ast.BlockStmt, maxSize int) int {
 		// opening and closing brace are on different lines - don't make it a one-liner
 		return maxSize + 1
 	}
+	if !pos1.IsValid() && !pos2.IsValid() {
+		// generated body without lines to follow - don't make it a one-liner
+		return maxSize + 1
+	}
 	if len(b.List) > 5 {
 		// too many statements - don't make it a one-liner
 		return maxSize + 1
@@ -1717,6 +1735,8 @@ func (p *printer) declList(list []ast.Decl) {
 	for _, d := range list {
 		prev := tok
 		tok = declToken(d)
+		positioned := d.Pos().IsValid() && (p.declFile == nil || p.fset.File(d.Pos()) == p.declFile)
+		anchored := positioned && p.generated(d)
 		// If the declaration token changed (e.g., from CONST to TYPE)
 		// or the next declaration has documentation associated with it,
 		// print an empty line between top-level declarations.
@@ -1731,15 +1751,84 @@ func (p *printer) declList(list []ast.Decl) {
 			if prev != tok || getDoc(d) != nil {
 				min = 2
 			}
+			if (!positioned || anchored) && p.trailingComments() {
+				min-- // the comments ended the line
+			}
+			line := p.lineFor(d.Pos())
+			if anchored && p.commentsBefore(d.Pos()) {
+				// the comments ended the line, and an empty line follows
+				line, min = p.pos.Line+1, 1
+			}
 			// start a new section if the next declaration is a function
 			// that spans multiple lines (see also issue #19544)
-			p.linebreak(p.lineFor(d.Pos()), min, ignore, tok == token.FUNC && p.numLines(d) > 1)
+			p.linebreak(line, min, ignore, tok == token.FUNC && p.numLines(d) > 1)
+		}
+		if positioned && !anchored {
+			p.decl(d)
+		} else {
+			p.generatedDecl(d)
 		}
-		p.decl(d)
 	}
 }
 
+// generatedDecl prints a declaration without position information, like
+// one generated by a tool, or with positions from another file. Such a
+// declaration can't be placed among the file comments, so it is printed
+// with its node comments instead.
+func (p *printer) generatedDecl(d ast.Decl) {
+	comments, info, useNodeComments := p.comments, p.commentInfo, p.useNodeComments
+	p.comments = nil
+	p.commentInfo = commentInfo{commentOffset: infinity}
+	p.useNodeComments = true
+	p.decl(d)
+	p.comments, p.commentInfo, p.useNodeComments = comments, info, useNodeComments
+}
+
+// generated reports whether a declaration with a position in the file is
+// generated nonetheless: its keyword is positioned, so that it's placed
+// among the file comments, but the rest of it isn't.
+func (p *printer) generated(d ast.Decl) bool {
+	var pos token.Pos
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		pos = d.Name.Pos()
+	case *ast.GenDecl:
+		if len(d.Specs) == 0 {
+			return false
+		}
+		pos = d.Specs[0].Pos()
+	default:
+		return false
+	}
+	return !pos.IsValid() || p.declFile != nil && p.fset.File(pos) != p.declFile
+}
+
+// commentsBefore prints the file comments before the position of an
+// anchored declaration, ending the line. It reports whether there were any.
+func (p *printer) commentsBefore(pos token.Pos) bool {
+	p.impliedSemi = false // the line ends before the declaration
+	if !p.commentBefore(p.posFor(pos)) {
+		return false
+	}
+	p.flush(p.posFor(pos), token.EOF)
+	return true
+}
+
+// trailingComments prints the comments on the last line printed, like a
+// trailing comment of the previous declaration, ending the line. Otherwise
+// they would follow a generated declaration printed next. It reports
+// whether there were any.
+func (p *printer) trailingComments() bool {
+	if p.commentOffset == infinity || p.posFor(p.comment.Pos()).Line != p.pos.Line {
+		return false
+	}
+	p.impliedSemi = false // the line ends after the comments
+	p.flush(p.posFor(p.comment.End()), token.EOF)
+	return true
+}
+
 func (p *printer) file(src *ast.File) {
+	p.declFile = p.fset.File(src.Pos())
 	p.setComment(src.Doc)
 	p.print(src.Pos(), token.PACKAGE, blank)
 	p.expr(src.Name)
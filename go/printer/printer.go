@@ -79,6 +79,8 @@ type printer struct {
 	// The list of all source comments, in order of appearance.
 	comments        []*ast.CommentGroup // may be nil
 	useNodeComments bool                // if not set, ignore lead and line comments of nodes
+	declFile        *token.File         // file of the declarations being printed; or nil
+	lastSrc         token.Pos           // source position of the last item with position information
 
 	// Information about p.comments[p.cindex]; set up by nextComment.
 	commentInfo
@@ -190,22 +192,38 @@ func (p *printer) linesFrom(line int) int {
 	return p.out.Line - line
 }
 
+// posFor returns the absolute position of pos, ignoring //line comments,
+// so that they don't affect the formatting.
 func (p *printer) posFor(pos token.Pos) token.Position {
 	// not used frequently enough to cache entire token.Position
-	return p.fset.Position(pos)
+	return p.fset.PositionFor(pos, false)
 }
 
 func (p *printer) lineFor(pos token.Pos) int {
 	if pos != p.cachedPos {
 		p.cachedPos = pos
-		p.cachedLine = p.fset.Position(pos).Line
+		p.cachedLine = p.fset.PositionFor(pos, false).Line
 	}
 	return p.cachedLine
 }
 
-// writeLineDirective writes a //line directive if necessary.
+// writeLineDirective writes a //line directive if necessary. The directive
+// refers to the source position of pos, adjusted by the //line comments of
+// the source itself.
 func (p *printer) writeLineDirective(pos token.Position) {
-	if pos.IsValid() && (p.out.Line != pos.Line || p.out.Filename != pos.Filename) {
+	if !pos.IsValid() || !p.lastSrc.IsValid() {
+		return
+	}
+	// pos is either the position of the last item with position
+	// information, or estimated relative to it
+	src := p.posFor(p.lastSrc)
+	if pos.Filename != src.Filename {
+		return
+	}
+	line := pos.Line
+	pos = p.fset.Position(p.lastSrc)
+	pos.Line += line - src.Line
+	if pos.Line > 0 && (p.out.Line != pos.Line || p.out.Filename != pos.Filename) {
 		p.output = append(p.output, tabwriter.Escape) // protect '\n' in //line from tabwriter interpretation
 		p.output = append(p.output, fmt.Sprintf("//line %s:%d\n", pos.Filename, pos.Line)...)
 		p.output = append(p.output, tabwriter.Escape)
@@ -386,6 +404,12 @@ func (p *printer) writeCommentPrefix(pos, next token.Position, prev *ast.Comment
 		// comment on a different line:
 		// separate with at least one line break
 		droppedLinebreak := false
+		pendingLinebreaks := 0
+		for _, ch := range p.wsbuf {
+			if ch == newline || ch == formfeed {
+				pendingLinebreaks++
+			}
+		}
 		j := 0
 		for i, ch := range p.wsbuf {
 			switch ch {
@@ -429,6 +453,11 @@ func (p *printer) writeCommentPrefix(pos, next token.Position, prev *ast.Comment
 			if n < 0 { // should never happen
 				n = 0
 			}
+		} else if !pos.IsValid() {
+			// a comment without position keeps the line breaks
+			// requested before it, which are dropped below
+			n = pendingLinebreaks
+			droppedLinebreak = false
 		}
 
 		// at the package scope level only (p.indent == 0),
@@ -619,6 +648,9 @@ func stripCommonPrefix(lines []string) {
 func (p *printer) writeComment(comment *ast.Comment) {
 	text := comment.Text
 	pos := p.posFor(comment.Pos())
+	if pos.IsValid() {
+		p.lastSrc = comment.Pos()
+	}
 
 	const linePrefix = "//line "
 	if strings.HasPrefix(text, linePrefix) && (!pos.IsValid() || pos.Column == 1) {
@@ -642,6 +674,11 @@ func (p *printer) writeComment(comment *ast.Comment) {
 		}
 	}
 
+	if !pos.IsValid() {
+		// like tokens, comments without position continue at the current position
+		pos = p.pos
+	}
+
 	// shortcut common case of //-style comments
 	if text[1] == '/' {
 		p.writeString(pos, trimRight(text), true)
@@ -738,8 +775,16 @@ func (p *printer) containsLinebreak() bool {
 func (p *printer) intersperseComments(next token.Position, tok token.Token) (wroteNewline, droppedFF bool) {
 	var last *ast.Comment
 	for p.commentBefore(next) {
-		for _, c := range p.comment.List {
+		for i, c := range p.comment.List {
 			p.writeCommentPrefix(p.posFor(c.Pos()), next, last, tok)
+			if !c.Pos().IsValid() {
+				// a comment without position, like in the doc comment of a
+				// generated declaration, takes the lines right before the next item
+				p.pos = next
+				for _, c := range p.comment.List[i:] {
+					p.pos.Line -= 1 + strings.Count(c.Text, "\n")
+				}
+			}
 			p.writeComment(c)
 			last = c
 		}
@@ -957,6 +1002,7 @@ func (p *printer) print(args ...interface{}) {
 		case token.Pos:
 			if x.IsValid() {
 				p.pos = p.posFor(x) // accurate position of next item
+				p.lastSrc = x
 			}
 			continue
 
@@ -0,0 +1,139 @@
+package printer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/parser"
+	"github.com/faiface/generics/go/token"
+)
+
+// TestGeneratedDecls checks that declarations without positions are printed between the file
+// comments around them, keeping trailing comments with their declarations.
+func TestGeneratedDecls(t *testing.T) {
+	const src = `package p
+
+func helper() int { return 1 } // trailing
+
+// floating
+
+// Doc of main.
+func main() {} /* trailing */
+
+// end
+`
+	const want = `package p
+
+func helper() int { return 1 } // trailing
+
+// generated0 is generated.
+func generated0() {
+}
+
+// floating
+
+// Doc of main.
+func main() {} /* trailing */
+
+// generated1 is generated.
+func generated1() {
+}
+
+// end
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated := func(name string) ast.Decl {
+		return &ast.FuncDecl{
+			Doc:  &ast.CommentGroup{List: []*ast.Comment{{Text: "// " + name + " is generated."}}},
+			Name: ast.NewIdent(name),
+			Type: &ast.FuncType{Params: &ast.FieldList{}},
+			Body: &ast.BlockStmt{},
+		}
+	}
+	file.Decls = []ast.Decl{file.Decls[0], generated("generated0"), file.Decls[1], generated("generated1")}
+
+	var buf bytes.Buffer
+	if err := (&Config{Mode: UseSpaces | TabIndent, Tabwidth: 8}).Fprint(&buf, fset, file); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestGeneratedEmptyTypes checks that empty struct and interface types without positions are
+// printed on one line.
+func TestGeneratedEmptyTypes(t *testing.T) {
+	const want = `func f(x interface{}) struct{} {
+	return struct{}{}
+}`
+	empty := func() *ast.FieldList { return &ast.FieldList{} }
+	decl := &ast.FuncDecl{
+		Name: ast.NewIdent("f"),
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{List: []*ast.Field{{
+				Names: []*ast.Ident{ast.NewIdent("x")},
+				Type:  &ast.InterfaceType{Methods: empty()},
+			}}},
+			Results: &ast.FieldList{List: []*ast.Field{{Type: &ast.StructType{Fields: empty()}}}},
+		},
+		Body: &ast.BlockStmt{List: []ast.Stmt{&ast.ReturnStmt{
+			Results: []ast.Expr{&ast.CompositeLit{Type: &ast.StructType{Fields: empty()}}},
+		}}},
+	}
+
+	var buf bytes.Buffer
+	if err := (&Config{Mode: UseSpaces | TabIndent, Tabwidth: 8}).Fprint(&buf, token.NewFileSet(), decl); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestAnchoredDecls checks that a generated declaration, whose keyword has the position of a
+// declaration it replaces, is printed after the file comments before that position.
+func TestAnchoredDecls(t *testing.T) {
+	const src = `package p
+
+// floating
+
+func replaced() {}
+
+// end
+`
+	const want = `package p
+
+// floating
+
+// generated is generated.
+func generated() {
+}
+
+// end
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Decls = []ast.Decl{&ast.FuncDecl{
+		Doc:  &ast.CommentGroup{List: []*ast.Comment{{Text: "// generated is generated."}}},
+		Name: ast.NewIdent("generated"),
+		Type: &ast.FuncType{Func: file.Decls[0].Pos(), Params: &ast.FieldList{}},
+		Body: &ast.BlockStmt{},
+	}}
+
+	var buf bytes.Buffer
+	if err := (&Config{Mode: UseSpaces | TabIndent, Tabwidth: 8}).Fprint(&buf, fset, file); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
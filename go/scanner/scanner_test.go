@@ -0,0 +1,52 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/faiface/generics/go/token"
+)
+
+// TestNumbers checks the number literals of current Go: binary, octal with 0o, hexadecimal
+// floats and '_' separators.
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		src string
+		tok token.Token
+		bad bool // whether the literal is reported as an error
+	}{
+		{"0b1010", token.INT, false},
+		{"0B_1", token.INT, false},
+		{"0o17", token.INT, false},
+		{"0O_7", token.INT, false},
+		{"017", token.INT, false},
+		{"1_000_000", token.INT, false},
+		{"0x_FF", token.INT, false},
+		{"0x1p-2", token.FLOAT, false},
+		{"0x1.8P+1", token.FLOAT, false},
+		{"0X.8p0", token.FLOAT, false},
+		{"1_0.2_5e1_0", token.FLOAT, false},
+		{"0b1_0i", token.IMAG, false},
+		{"0x1p4i", token.IMAG, false},
+		{"0b102", token.INT, true},
+		{"0o8", token.INT, true},
+		{"1__0", token.INT, true},
+		{"1_", token.INT, true},
+		{"0x1.8", token.FLOAT, true},
+		{"0x", token.INT, true},
+	}
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		file := fset.AddFile("", fset.Base(), len(test.src))
+		errors := 0
+		var s Scanner
+		s.Init(file, []byte(test.src), func(token.Position, string) { errors++ }, 0)
+
+		_, tok, lit := s.Scan()
+		if tok != test.tok || lit != test.src {
+			t.Errorf("%s: got %s %q, want %s %q", test.src, tok, lit, test.tok, test.src)
+		}
+		if bad := errors > 0; bad != test.bad {
+			t.Errorf("%s: got %d errors, want bad = %v", test.src, errors, test.bad)
+		}
+	}
+}
@@ -21,6 +21,12 @@ func assignableToTypeParam(x Type, p *TypeParam) bool {
 	if p.Restriction()&RestrictionNum != 0 && !isNumeric(x) {
 		return false
 	}
+	if p.Restriction()&RestrictionInteger != 0 && !isInteger(x) {
+		return false
+	}
+	if iface := p.methods(); iface != nil && !Implements(x, iface) {
+		return false
+	}
 	return true
 }
 
@@ -41,7 +47,8 @@ func (check *Checker) assignment(mapping map[*TypeParam]Type, x *operand, T Type
 		unreachable()
 	}
 
-	if typeParam, ok := T.Underlying().(*TypeParam); ok && mapping != nil {
+	// T is nil for assignments to _, so it's not asked for its underlying type
+	if typeParam, ok := T.(*TypeParam); ok && mapping != nil {
 		if typ, ok := mapping[typeParam]; ok {
 			T = typ
 		} else {
@@ -0,0 +1,33 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/parser"
+	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
+)
+
+// TestUntypedAssignment checks the assignments without a type to assign to: to the blank
+// identifier, of switch expressions and of arguments of builtins like println.
+func TestUntypedAssignment(t *testing.T) {
+	const src = `package p
+
+func f(x int) {
+	_ = x
+	_ = "untyped"
+	switch 1 {
+	}
+	println(x, 1.5)
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&types.Config{}).Check("p", fset, []*ast.File{file}, nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -156,7 +156,7 @@ func (check *Checker) builtin(x *operand, call *ast.CallExpr, id builtinId) (_ b
 			// if the type of s is an array or pointer to an array and
 			// the expression s does not contain channel receives or
 			// function calls; in this case s is not evaluated."
-			if !check.hasCallOrRecv {
+			if !check.hasCallOrRecv && t.param == nil {
 				mode = constant_
 				val = constant.MakeInt64(t.len)
 			}
@@ -182,6 +182,22 @@ func (check *Checker) builtin(x *operand, call *ast.CallExpr, id builtinId) (_ b
 			check.recordBuiltinType(call.Fun, makeSig(x.typ, typ))
 		}
 
+	case _Clear:
+		// clear(m)
+		// clear(s)
+		switch x.typ.Underlying().(type) {
+		case *Map, *Slice:
+			// ok
+		default:
+			check.invalidArg(x.pos(), "cannot clear %s: argument must be a map or slice", x)
+			return
+		}
+
+		x.mode = novalue
+		if check.Types != nil {
+			check.recordBuiltinType(call.Fun, makeSig(nil, x.typ))
+		}
+
 	case _Close:
 		// close(c)
 		c, _ := x.typ.Underlying().(*Chan)
@@ -454,6 +470,78 @@ func (check *Checker) builtin(x *operand, call *ast.CallExpr, id builtinId) (_ b
 			check.recordBuiltinType(call.Fun, makeSig(x.typ, params[:1+len(sizes)]...))
 		}
 
+	case _Max, _Min:
+		// max(x, ...)
+		// min(x, ...)
+		op := token.LSS
+		if id == _Max {
+			op = token.GTR
+		}
+
+		args := []operand{*x}
+		for i := 1; i < nargs; i++ {
+			var y operand
+			arg(&y, i)
+			if y.mode == invalid {
+				return
+			}
+			args = append(args, y)
+		}
+
+		for i := range args {
+			a := &args[i]
+			if !isOrdered(a.typ) {
+				check.invalidArg(a.pos(), "%s cannot be ordered", a)
+				return
+			}
+			if i == 0 {
+				continue
+			}
+
+			check.convertUntyped(x, a.typ)
+			if x.mode == invalid {
+				return
+			}
+			check.convertUntyped(a, x.typ)
+			if a.mode == invalid {
+				return
+			}
+			if !Identical(x.typ, a.typ) {
+				check.invalidArg(a.pos(), "mismatched types %s (previous argument) and %s (type of %s)", x.typ, a.typ, a.expr)
+				return
+			}
+
+			if x.mode == constant_ && a.mode == constant_ {
+				if constant.Compare(a.val, op, x.val) {
+					*x = *a
+				}
+			} else {
+				x.mode = value
+			}
+		}
+
+		// a single argument may be an untyped constant, which min and max don't change
+		if x.mode != constant_ {
+			x.mode = value
+			check.assignment(nil, x, nil, "argument to "+bin.name)
+			if x.mode == invalid {
+				return
+			}
+		}
+
+		// all the arguments take the final type
+		for i := range args {
+			check.updateExprType(args[i].expr, x.typ, true)
+		}
+
+		if check.Types != nil && x.mode != constant_ {
+			params := make([]Type, nargs)
+			for i := range params {
+				params[i] = x.typ
+			}
+			check.recordBuiltinType(call.Fun, makeSig(x.typ, params...))
+		}
+
 	case _New:
 		// new(T)
 		// (no argument evaluated yet)
@@ -512,6 +600,25 @@ func (check *Checker) builtin(x *operand, call *ast.CallExpr, id builtinId) (_ b
 			check.recordBuiltinType(call.Fun, makeSig(x.typ))
 		}
 
+	case _Add:
+		// unsafe.Add(ptr unsafe.Pointer, len IntegerType) unsafe.Pointer
+		check.assignment(nil, x, Typ[UnsafePointer], "argument to unsafe.Add")
+		if x.mode == invalid {
+			return
+		}
+
+		var y operand
+		arg(&y, 1)
+		if !check.intArg(&y, "offset", true) {
+			return
+		}
+
+		x.mode = value
+		x.typ = Typ[UnsafePointer]
+		if check.Types != nil {
+			check.recordBuiltinType(call.Fun, makeSig(x.typ, x.typ, y.typ))
+		}
+
 	case _Alignof:
 		// unsafe.Alignof(x T) uintptr
 		check.assignment(nil, x, nil, "argument to unsafe.Alignof")
@@ -519,6 +626,16 @@ func (check *Checker) builtin(x *operand, call *ast.CallExpr, id builtinId) (_ b
 			return
 		}
 
+		if hasVarLayout(x.typ) {
+			// the alignment is only known in instances
+			if check.Types != nil {
+				check.recordBuiltinType(call.Fun, makeSig(Typ[Uintptr], x.typ))
+			}
+			x.mode = value
+			x.typ = Typ[Uintptr]
+			break
+		}
+
 		x.mode = constant_
 		x.val = constant.MakeInt64(check.conf.alignof(x.typ))
 		x.typ = Typ[Uintptr]
@@ -563,6 +680,16 @@ func (check *Checker) builtin(x *operand, call *ast.CallExpr, id builtinId) (_ b
 		// TODO(gri) Should we pass x.typ instead of base (and indirect report if derefStructPtr indirected)?
 		check.recordSelection(selx, FieldVal, base, obj, index, false)
 
+		if hasVarLayout(base) {
+			// the offset is only known in instances
+			if check.Types != nil {
+				check.recordBuiltinType(call.Fun, makeSig(Typ[Uintptr], obj.Type()))
+			}
+			x.mode = value
+			x.typ = Typ[Uintptr]
+			break
+		}
+
 		offs := check.conf.offsetof(base, index)
 		x.mode = constant_
 		x.val = constant.MakeInt64(offs)
@@ -576,11 +703,87 @@ func (check *Checker) builtin(x *operand, call *ast.CallExpr, id builtinId) (_ b
 			return
 		}
 
+		if hasVarLayout(x.typ) {
+			// the size is only known in instances
+			if check.Types != nil {
+				check.recordBuiltinType(call.Fun, makeSig(Typ[Uintptr], x.typ))
+			}
+			x.mode = value
+			x.typ = Typ[Uintptr]
+			break
+		}
+
 		x.mode = constant_
 		x.val = constant.MakeInt64(check.conf.sizeof(x.typ))
 		x.typ = Typ[Uintptr]
 		// result is constant - no need to record signature
 
+	case _Slice:
+		// unsafe.Slice(ptr *T, len IntegerType) []T
+		ptr, _ := x.typ.Underlying().(*Pointer)
+		if ptr == nil {
+			check.invalidArg(x.pos(), "%s is not a pointer", x)
+			return
+		}
+
+		var y operand
+		arg(&y, 1)
+		if !check.intArg(&y, "length", false) {
+			return
+		}
+
+		x.mode = value
+		x.typ = NewSlice(ptr.base)
+		if check.Types != nil {
+			check.recordBuiltinType(call.Fun, makeSig(x.typ, ptr, y.typ))
+		}
+
+	case _SliceData:
+		// unsafe.SliceData(slice []T) *T
+		slice, _ := x.typ.Underlying().(*Slice)
+		if slice == nil {
+			check.invalidArg(x.pos(), "%s is not a slice", x)
+			return
+		}
+
+		x.mode = value
+		x.typ = NewPointer(slice.elem)
+		if check.Types != nil {
+			check.recordBuiltinType(call.Fun, makeSig(x.typ, slice))
+		}
+
+	case _String:
+		// unsafe.String(ptr *byte, len IntegerType) string
+		check.assignment(nil, x, NewPointer(universeByte), "argument to unsafe.String")
+		if x.mode == invalid {
+			return
+		}
+
+		var y operand
+		arg(&y, 1)
+		if !check.intArg(&y, "length", false) {
+			return
+		}
+
+		x.mode = value
+		x.typ = Typ[String]
+		if check.Types != nil {
+			check.recordBuiltinType(call.Fun, makeSig(x.typ, NewPointer(universeByte), y.typ))
+		}
+
+	case _StringData:
+		// unsafe.StringData(str string) *byte
+		check.assignment(nil, x, Typ[String], "argument to unsafe.StringData")
+		if x.mode == invalid {
+			return
+		}
+
+		x.mode = value
+		x.typ = NewPointer(universeByte)
+		if check.Types != nil {
+			check.recordBuiltinType(call.Fun, makeSig(x.typ, Typ[String]))
+		}
+
 	case _Assert:
 		// assert(pred) causes a typechecker error if pred is false.
 		// The result of assert is the value of pred if there is no error.
@@ -606,7 +809,7 @@ func (check *Checker) builtin(x *operand, call *ast.CallExpr, id builtinId) (_ b
 		// Note: trace is only available in self-test mode.
 		// (no argument evaluated yet)
 		if nargs == 0 {
-			check.dump("%s: trace() without arguments", call.Pos())
+			check.dump("%v: trace() without arguments", call.Pos())
 			x.mode = novalue
 			break
 		}
@@ -614,7 +817,7 @@ func (check *Checker) builtin(x *operand, call *ast.CallExpr, id builtinId) (_ b
 		x1 := x
 		for _, arg := range call.Args {
 			check.rawExpr(x1, arg, nil) // permit trace for types, e.g.: new(trace(T))
-			check.dump("%s: %s", x1.pos(), x1)
+			check.dump("%v: %s", x1.pos(), x1)
 			x1 = &t // use incoming x only for first argument
 		}
 		// trace is only available in test mode - no need to record signature
@@ -642,6 +845,48 @@ func makeSig(res Type, args ...Type) *Signature {
 	return &Signature{params: params, results: result}
 }
 
+// hasVarLayout reports whether the memory layout of T depends on type parameters, or on generic
+// array lengths, so that its size and alignment, and the offsets of its fields, vary between
+// instances.
+func hasVarLayout(T Type) bool {
+	switch t := T.Underlying().(type) {
+	case *TypeParam:
+		return true
+	case *Array:
+		return t.param != nil || hasVarLayout(t.elem)
+	case *Struct:
+		for _, f := range t.fields {
+			if hasVarLayout(f.typ) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// intArg checks an integer argument of a built-in, like the length of unsafe.Slice. An untyped
+// constant must be representable as an int, and a constant must not be negative, unless
+// negative is set. It reports whether the argument is valid.
+func (check *Checker) intArg(x *operand, what string, negative bool) bool {
+	if x.mode == invalid {
+		return false
+	}
+
+	check.convertUntyped(x, Typ[Int])
+	if x.mode == invalid {
+		return false
+	}
+	if !isInteger(x.typ) {
+		check.invalidArg(x.pos(), "%s %s must be integer", what, x)
+		return false
+	}
+	if x.mode == constant_ && !negative && constant.Sign(x.val) < 0 {
+		check.invalidArg(x.pos(), "%s %s must not be negative", what, x)
+		return false
+	}
+	return true
+}
+
 // implicitArrayDeref returns A if typ is of the form *A and A is an array;
 // otherwise it returns typ.
 //
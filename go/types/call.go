@@ -23,6 +23,12 @@ func mapVar(mapping map[*TypeParam]Type, v *Var, visited map[Type]Type) *Var {
 	)
 }
 
+// MapType returns typ with its generic type parameters and array lengths replaced according
+// to mapping.
+func MapType(mapping map[*TypeParam]Type, typ Type) Type {
+	return mapType(mapping, typ, make(map[Type]Type))
+}
+
 func mapType(mapping map[*TypeParam]Type, x Type, visited map[Type]Type) (mapped Type) {
 	if visited[x] != nil {
 		return visited[x]
@@ -34,7 +40,12 @@ func mapType(mapping map[*TypeParam]Type, x Type, visited map[Type]Type) (mapped
 
 	case *Array:
 		array := &Array{
-			len: x.len,
+			len:   x.len,
+			param: x.param,
+		}
+		if bound, ok := mapping[x.param]; ok && x.param != nil {
+			array.len = bound.(*Array).len
+			array.param = bound.(*Array).param
 		}
 		visited[x] = array
 		array.elem = mapType(mapping, x.elem, visited)
@@ -50,11 +61,12 @@ func mapType(mapping map[*TypeParam]Type, x Type, visited map[Type]Type) (mapped
 		str := &Struct{}
 		visited[x] = str
 		for i, f := range x.fields {
-			str.fields = append(str.fields, NewVar(
+			str.fields = append(str.fields, NewField(
 				f.Pos(),
 				f.Pkg(),
 				f.Name(),
 				mapType(mapping, f.Type(), visited),
+				f.Anonymous(),
 			))
 			if x.tags != nil {
 				str.tags = append(str.tags, x.tags[i])
@@ -98,6 +110,9 @@ func mapType(mapping map[*TypeParam]Type, x Type, visited map[Type]Type) (mapped
 		for _, emb := range x.embeddeds {
 			iface.embeddeds = append(iface.embeddeds, mapType(mapping, emb, visited).(*Named))
 		}
+		if x.allMethods != nil {
+			iface.allMethods = make([]*Func, 0, len(x.allMethods)) // a complete interface stays complete
+		}
 		for _, meth := range x.allMethods {
 			meth := *meth
 			meth.typ = mapType(mapping, meth.typ, visited)
@@ -435,7 +450,7 @@ func (check *Checker) argument(mapping map[*TypeParam]Type, fun ast.Expr, sig *S
 		typ = sig.params.vars[n-1].typ
 		if debug {
 			if _, ok := typ.(*Slice); !ok {
-				check.dump("%s: expected unnamed slice type, got %s", sig.params.vars[n-1].Pos(), typ)
+				check.dump("%v: expected unnamed slice type, got %s", sig.params.vars[n-1].Pos(), typ)
 			}
 		}
 	default:
@@ -609,7 +624,7 @@ func (check *Checker) selector(x *operand, e *ast.SelectorExpr) {
 				// lookup.
 				mset := NewMethodSet(typ)
 				if m := mset.Lookup(check.pkg, sel); m == nil || m.obj != obj {
-					check.dump("%s: (%s).%v -> %s", e.Pos(), typ, obj.name, m)
+					check.dump("%v: (%s).%v -> %s", e.Pos(), typ, obj.name, m)
 					check.dump("%s\n", mset)
 					panic("method sets and lookup don't agree")
 				}
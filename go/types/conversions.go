@@ -30,7 +30,7 @@ func (check *Checker) conversion(x *operand, T Type) {
 			// If codepoint < 0 the absolute value is too large (or unknown) for
 			// conversion. This is the same as converting any other out-of-range
 			// value - let string(codepoint) do the work.
-			x.val = constant.MakeString(string(codepoint))
+			x.val = constant.MakeString(string(rune(codepoint)))
 			ok = true
 		}
 	case x.convertibleTo(check.conf, T):
@@ -112,6 +112,13 @@ func (x *operand) convertibleTo(conf *Config, T Type) bool {
 		return true
 	}
 
+	// a numeric type parameter and another numeric type, possibly also a type parameter,
+	// convert both ways; instances converting complex to non-complex numbers are rejected
+	// when they are translated
+	if isNumeric(V) && isNumeric(T) && (isTypeParam(V) || isTypeParam(T)) {
+		return true
+	}
+
 	// "x is an integer or a slice of bytes or runes and T is a string type"
 	if (isInteger(V) || isBytesOrRunes(Vu)) && isString(T) {
 		return true
@@ -122,6 +129,19 @@ func (x *operand) convertibleTo(conf *Config, T Type) bool {
 		return true
 	}
 
+	// "x is a slice, T is an array or a pointer to an array, and the slice
+	// and array types have identical element types"
+	if s, ok := Vu.(*Slice); ok {
+		switch a := Tu.(type) {
+		case *Array:
+			return Identical(s.elem, a.elem)
+		case *Pointer:
+			if a, ok := a.base.Underlying().(*Array); ok {
+				return Identical(s.elem, a.elem)
+			}
+		}
+	}
+
 	// package unsafe:
 	// "any pointer or value of underlying type uintptr can be converted into a unsafe.Pointer"
 	if (isPointer(Vu) || isUintptr(Vu)) && isUnsafePointer(T) {
@@ -135,6 +155,11 @@ func (x *operand) convertibleTo(conf *Config, T Type) bool {
 	return false
 }
 
+func isTypeParam(typ Type) bool {
+	_, ok := typ.Underlying().(*TypeParam)
+	return ok
+}
+
 func isUintptr(typ Type) bool {
 	t, ok := typ.Underlying().(*Basic)
 	return ok && t.kind == Uintptr
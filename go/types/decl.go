@@ -55,7 +55,7 @@ func (check *Checker) objDecl(obj Object, def *Named, path []*TypeName) {
 
 	d := check.objMap[obj]
 	if d == nil {
-		check.dump("%s: %s should have been declared", obj.Pos(), obj.Name())
+		check.dump("%v: %s should have been declared", obj.Pos(), obj.Name())
 		unreachable()
 	}
 
@@ -348,10 +348,13 @@ func (check *Checker) funcDecl(obj *Func, decl *declInfo) {
 		// ok to continue
 	}
 
-	// collect all generic type parameters
+	// collect all generic type parameters and array lengths
 	for _, param := range decl.fdecl.TypeParams {
 		sig.typeParams = append(sig.typeParams, sig.scope.Lookup(param.Name.Name).Type().(*TypeParam))
 	}
+	for _, param := range decl.fdecl.ConstParams {
+		sig.typeParams = append(sig.typeParams, check.lengths[sig.scope.Lookup(param.Name.Name).(*Var)])
+	}
 
 	// separate unnamed generic type parameters
 	for sig.params != nil && len(sig.params.vars) > 0 && sig.params.vars[0].name == "" {
@@ -382,7 +382,7 @@ func (check *Checker) updateExprType(x ast.Expr, typ Type, final bool) {
 		// The respective sub-expressions got their final types
 		// upon assignment or use.
 		if debug {
-			check.dump("%s: found old type(%s): %s (new: %s)", x.Pos(), x, old.typ, typ)
+			check.dump("%v: found old type(%s): %s (new: %s)", x.Pos(), x, old.typ, typ)
 			unreachable()
 		}
 		return
@@ -563,6 +563,11 @@ func (check *Checker) convertUntyped(x *operand, target Type) {
 		if t.Restriction()&RestrictionNum == 0 {
 			goto Error
 		}
+		// only integer values and constants representable as integers convert to integer type
+		// parameters
+		if t.Restriction()&RestrictionInteger != 0 && !isInteger(x.typ) && (x.mode != constant_ || constant.ToInt(x.val).Kind() != constant.Int) {
+			goto Error
+		}
 		return
 	default:
 		goto Error
@@ -647,20 +652,28 @@ func (check *Checker) shift(x, y *operand, e *ast.BinaryExpr, op token.Token) {
 		return
 	}
 
-	// spec: "The right operand in a shift expression must have unsigned
-	// integer type or be an untyped constant representable by a value of
-	// type uint."
+	// spec: "The right operand in a shift expression must have integer type
+	// or be an untyped constant representable by a value of type uint.
+	// If the right operand of a constant shift expression is a constant,
+	// it must be non-negative."
+	if y.mode == constant_ {
+		if yval := constant.ToInt(y.val); yval.Kind() == constant.Int && constant.Sign(yval) < 0 {
+			check.invalidOp(y.pos(), "negative shift count %s", y)
+			x.mode = invalid
+			return
+		}
+	}
 	switch {
-	case isUnsigned(y.typ):
-		// nothing to do
 	case isUntyped(y.typ):
 		check.convertUntyped(y, Typ[Uint])
 		if y.mode == invalid {
 			x.mode = invalid
 			return
 		}
+	case isInteger(y.typ):
+		// nothing to do, a negative count panics at run time
 	default:
-		check.invalidOp(y.pos(), "shift count %s must be unsigned integer", y)
+		check.invalidOp(y.pos(), "shift count %s must be integer", y)
 		x.mode = invalid
 		return
 	}
@@ -670,7 +683,7 @@ func (check *Checker) shift(x, y *operand, e *ast.BinaryExpr, op token.Token) {
 			// rhs must be an integer value
 			yval := constant.ToInt(y.val)
 			if yval.Kind() != constant.Int {
-				check.invalidOp(y.pos(), "shift count %s must be unsigned integer", y)
+				check.invalidOp(y.pos(), "shift count %s must be integer", y)
 				x.mode = invalid
 				return
 			}
@@ -800,6 +813,14 @@ func (check *Checker) binary(x *operand, e *ast.BinaryExpr, lhs, rhs ast.Expr, o
 		return
 	}
 
+	// untyped operands convert to type parameters, but keep their untyped types, which
+	// aren't recorded as type parameters; the operation has the type parameter
+	if isTypeParam(x.typ) && isUntyped(y.typ) {
+		y.typ = x.typ
+	} else if isUntyped(x.typ) && isTypeParam(y.typ) {
+		x.typ = y.typ
+	}
+
 	if !Identical(x.typ, y.typ) {
 		// only report an error if we have valid types
 		// (otherwise we had an error reported elsewhere already)
@@ -1164,7 +1185,7 @@ func (check *Checker) exprInternal(x *operand, e ast.Expr, hint Type) exprKind {
 			// If we have an "open" [...]T array, set the length now that we know it
 			// and record the type for [...] (usually done by check.typExpr which is
 			// not called for [...]).
-			if utyp.len < 0 {
+			if utyp.len < 0 && utyp.param == nil {
 				utyp.len = n
 				check.recordTypeAndValue(e.Type, typexpr, utyp, nil)
 			}
@@ -0,0 +1,67 @@
+package types_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/parser"
+	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
+)
+
+// unsafeImporter imports only package unsafe.
+type unsafeImporter struct{}
+
+func (unsafeImporter) Import(path string) (*types.Package, error) {
+	return types.Unsafe, nil
+}
+
+// TestCurrentGo checks the rules of current Go outside of generics: number literals, any, min,
+// max and clear, ranging over integers and functions, the functions of unsafe added since Go 1.17
+// and signed shift counts.
+func TestCurrentGo(t *testing.T) {
+	tests := []struct {
+		src string
+		err string // part of the expected error; empty if the source is valid
+	}{
+		{"const c = 0b1010 + 0o17 + 1_000 + 0x1p-2", ""},
+		{"const c int = 0x1p-2", "truncated"},
+		{"var x any = 1", ""},
+		{"const c = min(1, 2.5) + max(3, 4)", ""},
+		{"func f(x, y float64) float64 { return min(x, y, 0) }", ""},
+		{"func f(x int, s string) { _ = min(x, s) }", "mismatched types"},
+		{"func f(m map[string]int, s []int) { clear(m); clear(s) }", ""},
+		{"func f(x int) { clear(x) }", "clear"},
+		{"func f() int { n := 0; for i := range 10 { n += i }; return n }", ""},
+		{"func f(n uint8) uint8 { for i := range n { return i }; return 0 }", ""},
+		{"func f() { for i, j := range 10 { _, _ = i, j } }", "permits only one iteration variable"},
+		{"func f(seq func(func(int, string) bool)) { for k, v := range seq { _, _ = k, v } }", ""},
+		{"func f(seq func(func() bool)) { for range seq {} }", ""},
+		{"func f(seq func(func(int) bool)) { for k, v := range seq { _, _ = k, v } }", "permits fewer iteration variables"},
+		{"func f(p unsafe.Pointer) unsafe.Pointer { return unsafe.Add(p, 8) }", ""},
+		{"func f(p *byte, n int) []byte { return unsafe.Slice(p, n) }", ""},
+		{"func f(p *byte, n int) string { return unsafe.String(p, n) }", ""},
+		{"func f(s []int, t string) (*int, *byte) { return unsafe.SliceData(s), unsafe.StringData(t) }", ""},
+		{"func f(x, n int) int { return x << n }", ""},
+		{"func f(x int, n int8) int { return x >> n }", ""},
+		{"func f(x int) int { return x << -1 }", "negative shift count"},
+		{"func f(x int, n float64) int { return x << n }", "must be integer"},
+	}
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, "p.go", "package p\n\nimport \"unsafe\"\n\nvar _ unsafe.Pointer\n\n"+test.src, 0)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+			continue
+		}
+
+		_, err = (&types.Config{Importer: unsafeImporter{}}).Check("p", fset, []*ast.File{file}, nil)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: %v", test.src, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: got error %v, want %q", test.src, err, test.err)
+		}
+	}
+}
@@ -16,7 +16,8 @@ package types
 // type where the entry was found, either:
 //
 //	1) the list of declared methods of a named type; or
-//	2) the list of all methods (method set) of an interface type; or
+//	2) the list of all methods (method set) of an interface type, or of
+//	   the interface restricting a type parameter; or
 //	3) the list of fields of a struct type.
 //
 // The earlier index entries are the indices of the anonymous struct fields
@@ -32,6 +33,10 @@ package types
 //      but there was no pointer on the path from the actual receiver type to
 //	the method's formal receiver base type, nor was the receiver addressable.
 //
+// If the method found is declared on a generic type, which is embedded as an
+// instance or is T itself, mapping maps the type parameters of its receiver to
+// the type arguments of the instance, and the signature is substituted with them.
+//
 func LookupFieldOrMethod(T Type, addressable bool, pkg *Package, name string) (obj Object, index []int, indirect bool, mapping map[*TypeParam]Type) {
 	// Methods cannot be associated to a named pointer type
 	// (spec: "The type denoted by T is called the receiver base type;
@@ -68,28 +73,24 @@ func lookupFieldOrMethod(T Type, addressable bool, pkg *Package, name string) (o
 
 	typ, isPtr := deref(T)
 
-	// *typ where typ is an interface has no methods.
-	if isPtr && IsInterface(typ) {
+	// *typ where typ is an interface or a type parameter has no methods.
+	if isPtr && (IsInterface(typ) || isTypeParam(typ)) {
 		return
 	}
 
-	inst, ok := typ.(*Instance)
-	if ok {
-		mapping = inst.Mapping()
-		typ = inst.Named()
-	}
-
 	// Start with typ as single entry at shallowest depth.
 	current := []embeddedType{{typ, nil, isPtr, false}}
 
-	// Named types that we have seen already, allocated lazily.
+	// Named types and instances that we have seen already, allocated lazily.
 	// Used to avoid endless searches in case of recursive types.
 	// Since only Named types can be used for recursive types, we
-	// only need to track those.
-	// (If we ever allow type aliases to construct recursive types,
-	// we must use type identity rather than pointer equality for
-	// the map key comparison, as we do in consolidateMultiples.)
-	var seen map[*Named]bool
+	// only need to track those. Instances of the same generic type
+	// are distinct if their type arguments are, so they are compared
+	// by identity, like in consolidateMultiples.
+	var seen map[Type]int
+
+	// instance of a generic type declaring the method found, if any
+	var inst *Instance
 
 	// search current depth
 	for len(current) > 0 {
@@ -99,22 +100,26 @@ func lookupFieldOrMethod(T Type, addressable bool, pkg *Package, name string) (o
 		for _, e := range current {
 			typ := e.typ
 
-			// If we have a named type, we may have associated methods.
+			// If we have a named type or an instance, we may have associated methods.
 			// Look for those first.
-			if named, ok := typ.(*Named); ok {
-				if seen[named] {
+			named, _ := typ.(*Named)
+			typInst, _ := typ.(*Instance)
+			if typInst != nil {
+				named = typInst.Named()
+			}
+			if named != nil {
+				if _, found := lookupType(seen, typ); found {
 					// We have seen this type before, at a more shallow depth
 					// (note that multiples of this type at the current depth
 					// were consolidated before). The type at that depth shadows
 					// this same type at the current depth, so we can ignore
 					// this one.
-					//XXX: disabled because it doesn't work well with generics
-					//continue
+					continue
 				}
 				if seen == nil {
-					seen = make(map[*Named]bool)
+					seen = make(map[Type]int)
 				}
-				seen[named] = true
+				seen[typ] = len(seen)
 
 				// look for a matching attached method
 				if i, m := lookupMethod(named.methods, pkg, name); m != nil {
@@ -126,11 +131,15 @@ func lookupFieldOrMethod(T Type, addressable bool, pkg *Package, name string) (o
 					}
 					obj = m
 					indirect = e.indirect
+					inst = typInst
 					continue // we can't have a matching field or interface method
 				}
 
-				// continue with underlying type
+				// continue with underlying type, with the type arguments substituted
 				typ = named.underlying
+				if typInst != nil {
+					typ = typInst.Underlying()
+				}
 			}
 
 			switch t := typ.(type) {
@@ -177,6 +186,20 @@ func lookupFieldOrMethod(T Type, addressable bool, pkg *Package, name string) (o
 					obj = m
 					indirect = e.indirect
 				}
+
+			case *TypeParam:
+				// look for a method of the interface restricting the type parameter
+				if iface := t.methods(); iface != nil {
+					if i, m := lookupMethod(iface.allMethods, pkg, name); m != nil {
+						assert(m.typ != nil)
+						index = concat(e.index, i)
+						if obj != nil || e.multiples {
+							return nil, index, false, nil // collision
+						}
+						obj = m
+						indirect = e.indirect
+					}
+				}
 			}
 		}
 
@@ -190,29 +213,14 @@ func lookupFieldOrMethod(T Type, addressable bool, pkg *Package, name string) (o
 				return nil, nil, true, nil // pointer/addressable receiver required
 			}
 
-			// check whether the generic arguments fit in a method a map it
-			if f, ok := obj.(*Func); ok && mapping != nil {
-				sig := f.Type().(*Signature)
-				assert(len(sig.Unnamed()) == 0)
-
-				recv, _ := deref(sig.Recv().Type())
-				recvInst := recv.(*Instance)
-
-				newMapping := make(map[*TypeParam]Type)
-				var x operand
-				x.mode = value
-				x.typ = inst
-				if !x.assignableTo(newMapping, nil, recvInst, nil) {
+			// check whether the type arguments of the instance fit the receiver of
+			// its method and map its signature
+			if inst != nil {
+				f, m := instMethod(inst, obj.(*Func))
+				if f == nil {
 					return nil, nil, false, nil
 				}
-
-				obj = NewFunc(f.Pos(), f.Pkg(), f.Name(), mapType(newMapping, sig, make(map[Type]Type)).(*Signature))
-				mapping = newMapping
-			}
-
-			// map a field if the type is generic
-			if f, ok := obj.(*Var); ok && mapping != nil {
-				obj = NewVar(f.Pos(), f.Pkg(), f.Name(), mapType(mapping, f.Type(), make(map[Type]Type)))
+				obj, mapping = f, m
 			}
 
 			return
@@ -224,6 +232,27 @@ func lookupFieldOrMethod(T Type, addressable bool, pkg *Package, name string) (o
 	return nil, nil, false, nil // not found
 }
 
+// instMethod returns the method f of the generic type of inst with the type parameters of its
+// receiver inferred from inst and substituted in its signature, along with their mapping.
+// It returns nil if inst doesn't fit the receiver of f.
+func instMethod(inst *Instance, f *Func) (*Func, map[*TypeParam]Type) {
+	sig := f.Type().(*Signature)
+	assert(len(sig.Unnamed()) == 0)
+
+	recv, _ := deref(sig.Recv().Type())
+	recvInst := recv.(*Instance)
+
+	mapping := make(map[*TypeParam]Type)
+	var x operand
+	x.mode = value
+	x.typ = inst
+	if !x.assignableTo(mapping, nil, recvInst, nil) {
+		return nil, nil
+	}
+
+	return NewFunc(f.Pos(), f.Pkg(), f.Name(), mapType(mapping, sig, make(map[Type]Type)).(*Signature)), mapping
+}
+
 // embeddedType represents an embedded type
 type embeddedType struct {
 	typ       Type
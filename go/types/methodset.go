@@ -73,22 +73,21 @@ func NewMethodSet(T Type) *MethodSet {
 
 	typ, isPtr := deref(T)
 
-	// *typ where typ is an interface has no methods.
-	if isPtr && IsInterface(typ) {
+	// *typ where typ is an interface or a type parameter has no methods.
+	if isPtr && (IsInterface(typ) || isTypeParam(typ)) {
 		return &emptyMethodSet
 	}
 
 	// Start with typ as single entry at shallowest depth.
 	current := []embeddedType{{typ, nil, isPtr, false}}
 
-	// Named types that we have seen already, allocated lazily.
+	// Named types and instances that we have seen already, allocated lazily.
 	// Used to avoid endless searches in case of recursive types.
 	// Since only Named types can be used for recursive types, we
-	// only need to track those.
-	// (If we ever allow type aliases to construct recursive types,
-	// we must use type identity rather than pointer equality for
-	// the map key comparison, as we do in consolidateMultiples.)
-	var seen map[*Named]bool
+	// only need to track those. Instances of the same generic type
+	// are distinct if their type arguments are, so they are compared
+	// by identity, like in consolidateMultiples.
+	var seen map[Type]int
 
 	// collect methods at current depth
 	for len(current) > 0 {
@@ -101,10 +100,15 @@ func NewMethodSet(T Type) *MethodSet {
 		for _, e := range current {
 			typ := e.typ
 
-			// If we have a named type, we may have associated methods.
+			// If we have a named type or an instance, we may have associated methods.
 			// Look for those first.
-			if named, _ := typ.(*Named); named != nil {
-				if seen[named] {
+			named, _ := typ.(*Named)
+			inst, _ := typ.(*Instance)
+			if inst != nil {
+				named = inst.Named()
+			}
+			if named != nil {
+				if _, found := lookupType(seen, typ); found {
 					// We have seen this type before, at a more shallow depth
 					// (note that multiples of this type at the current depth
 					// were consolidated before). The type at that depth shadows
@@ -113,14 +117,27 @@ func NewMethodSet(T Type) *MethodSet {
 					continue
 				}
 				if seen == nil {
-					seen = make(map[*Named]bool)
+					seen = make(map[Type]int)
 				}
-				seen[named] = true
-
-				mset = mset.add(named.methods, e.index, e.indirect, e.multiples)
+				seen[typ] = len(seen)
+
+				methods := named.methods
+				if inst != nil {
+					// Instances have the methods of their generic type whose receivers
+					// fit the type arguments, with the type arguments substituted, and nil
+					// for the methods that don't fit.
+					methods = make([]*Func, len(named.methods))
+					for i, m := range named.methods {
+						methods[i], _ = instMethod(inst, m)
+					}
+				}
+				mset = mset.add(methods, e.index, e.indirect, e.multiples)
 
-				// continue with underlying type
+				// continue with underlying type, with the type arguments substituted
 				typ = named.underlying
+				if inst != nil {
+					typ = inst.Underlying()
+				}
 			}
 
 			switch t := typ.(type) {
@@ -143,6 +160,11 @@ func NewMethodSet(T Type) *MethodSet {
 
 			case *Interface:
 				mset = mset.add(t.allMethods, e.index, true, e.multiples)
+
+			case *TypeParam:
+				if iface := t.methods(); iface != nil {
+					mset = mset.add(iface.allMethods, e.index, true, e.multiples)
+				}
 			}
 		}
 
@@ -228,7 +250,7 @@ type methodSet map[string]*Selection // a nil entry indicates a name collision
 
 // Add adds all functions in list to the method set s.
 // If multiples is set, every function in list appears multiple times
-// and is treated as a collision.
+// and is treated as a collision. Nil entries are skipped.
 func (s methodSet) add(list []*Func, index []int, indirect bool, multiples bool) methodSet {
 	if len(list) == 0 {
 		return s
@@ -237,6 +259,9 @@ func (s methodSet) add(list []*Func, index []int, indirect bool, multiples bool)
 		s = make(methodSet)
 	}
 	for i, f := range list {
+		if f == nil {
+			continue
+		}
 		key := f.Id()
 		// if f is not in the set, add it
 		if !multiples {
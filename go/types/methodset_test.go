@@ -0,0 +1,113 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/parser"
+	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
+)
+
+// checkSrc type-checks a single file, which must be valid.
+func checkSrc(t *testing.T, src string) *types.Package {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := (&types.Config{Importer: unsafeImporter{}}).Check("p", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
+
+// instance instantiates the generic type declared in pkg under name with a single argument.
+func instance(pkg *types.Package, name string, arg types.Type) *types.Instance {
+	return types.NewInstance(pkg.Scope().Lookup(name).Type().(*types.Named), []types.Type{arg})
+}
+
+// TestInstanceMethodSet checks method sets and interface satisfaction of generic instances.
+func TestInstanceMethodSet(t *testing.T) {
+	pkg := checkSrc(t, `package p
+
+type Stringer interface {
+	String() string
+}
+
+type Pusher(type T) interface {
+	Push(x T)
+}
+
+type Stack(type T) struct {
+	items []T
+}
+
+func (s *Stack(type T)) Push(x T) { s.items = append(s.items, x) }
+
+func (s *Stack(type T)) String() string { return "stack" }
+
+var _ Stringer = &Stack(int){}
+
+var _ Pusher(int) = &Stack(int){}
+`)
+	stack := instance(pkg, "Stack", types.Typ[types.Int])
+
+	if mset := types.NewMethodSet(stack); mset.Len() != 0 {
+		t.Errorf("Stack(int) has methods:\n%s", mset)
+	}
+	mset := types.NewMethodSet(types.NewPointer(stack))
+	if mset.Len() != 2 {
+		t.Fatalf("*Stack(int) has %d methods, want 2:\n%s", mset.Len(), mset)
+	}
+	push := mset.Lookup(pkg, "Push")
+	if got, want := push.Type().String(), "func(x int)"; got != want {
+		t.Errorf("Push of *Stack(int) has type %s, want %s", got, want)
+	}
+
+	stringer := pkg.Scope().Lookup("Stringer").Type().Underlying().(*types.Interface)
+	if !types.Implements(types.NewPointer(stack), stringer) {
+		t.Errorf("*Stack(int) doesn't implement Stringer")
+	}
+	pusher := instance(pkg, "Pusher", types.Typ[types.String]).Underlying().(*types.Interface)
+	if m, wrongType := types.MissingMethod(types.NewPointer(stack), pusher, true); m == nil || !wrongType {
+		t.Errorf("*Stack(int) implements Pusher(string)")
+	}
+}
+
+// TestEmbeddedInstance checks methods promoted from embedded instances of generic types.
+func TestEmbeddedInstance(t *testing.T) {
+	pkg := checkSrc(t, `package p
+
+type List(type T) struct {
+	Value T
+	Next  *List(T)
+}
+
+func (l *List(type T)) Prepend(x T) *List(T) { return &List(T){Value: x, Next: l} }
+
+type Stack(type T) struct {
+	*List(T)
+}
+
+func (s *Stack(type T)) Push(x T) { s.List = s.Prepend(x) }
+`)
+	stack := types.NewPointer(instance(pkg, "Stack", types.Typ[types.String]))
+
+	prepend, index, _, _ := types.LookupFieldOrMethod(stack, false, pkg, "Prepend")
+	if prepend == nil || len(index) != 2 {
+		t.Fatalf("got Prepend %v at %v, want it promoted from List(string)", prepend, index)
+	}
+	if got, want := prepend.Type().String(), "func(x string) *p.List(string)"; got != want {
+		t.Errorf("Prepend has type %s, want %s", got, want)
+	}
+	value, index, _, _ := types.LookupFieldOrMethod(stack, false, pkg, "Value")
+	if value == nil || len(index) != 2 || value.Type() != types.Typ[types.String] {
+		t.Errorf("got Value %v at %v, want the string field promoted from List(string)", value, index)
+	}
+	if mset := types.NewMethodSet(stack); mset.Len() != 2 || mset.Lookup(pkg, "Prepend") == nil {
+		t.Errorf("got method set of *Stack(string):\n%s", mset)
+	}
+}
@@ -75,7 +75,7 @@ func (check *Checker) interfaceFor(obj Object) *ast.InterfaceType {
 	}
 	d := check.objMap[obj]
 	if d == nil {
-		check.dump("%s: %s should have been declared", obj.Pos(), obj.Name())
+		check.dump("%v: %s should have been declared", obj.Pos(), obj.Name())
 		unreachable()
 	}
 	if d.typ == nil {
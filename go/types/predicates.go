@@ -27,6 +27,11 @@ func isBoolean(typ Type) bool {
 }
 
 func isInteger(typ Type) bool {
+	if p, ok := typ.Underlying().(*TypeParam); ok {
+		if p.Restriction()&RestrictionInteger != 0 {
+			return true
+		}
+	}
 	t, ok := typ.Underlying().(*Basic)
 	return ok && t.info&IsInteger != 0
 }
@@ -73,7 +78,8 @@ func isUntyped(typ Type) bool {
 
 func isOrdered(typ Type) bool {
 	if p, ok := typ.Underlying().(*TypeParam); ok {
-		if p.Restriction()&RestrictionOrd != 0 {
+		// all integer types are ordered
+		if p.Restriction()&(RestrictionOrd|RestrictionInteger) != 0 {
 			return true
 		}
 	}
@@ -180,9 +186,18 @@ func identical(mapping map[*TypeParam]Type, x, y Type, cmpTags bool, p *ifacePai
 
 	case *Array:
 		// Two array types are identical if they have identical element types
-		// and the same array length.
+		// and the same array length. A generic array length is inferred from
+		// the other array.
 		if y, ok := y.(*Array); ok {
-			return x.len == y.len && identical(mapping, x.elem, y.elem, cmpTags, p)
+			if y.param != nil && mapping != nil {
+				bound, ok := mapping[y.param]
+				if !ok {
+					mapping[y.param] = x
+					return identical(mapping, x.elem, y.elem, cmpTags, p)
+				}
+				y = &Array{len: bound.(*Array).len, elem: y.elem, param: bound.(*Array).param}
+			}
+			return x.len == y.len && x.param == y.param && identical(mapping, x.elem, y.elem, cmpTags, p)
 		}
 
 	case *Slice:
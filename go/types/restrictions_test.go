@@ -0,0 +1,44 @@
+package types_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/parser"
+	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
+)
+
+// TestRestrictions checks the operations allowed on type parameters by their restrictions.
+func TestRestrictions(t *testing.T) {
+	tests := []struct {
+		src string
+		err string // part of the expected error; empty if the source is valid
+	}{
+		{"func f(x, y type T ord) bool { return x < y }", ""},
+		{"func f(x, y type T integer) bool { return x < y || x >= y }", ""},
+		{"func f(x, y type T integer) T { return min(x, y) }", ""},
+		{"func f(x, y type T integer) T { return x % y & y << 1 }", ""},
+		{"func g(x type T ord) {}; func f(x type T integer) { g(x) }", ""},
+		{"func f(x, y type T num) bool { return x < y }", "cannot compare"},
+		{"func f(x, y type T num) T { return x % y }", "not defined"},
+		{"func f(x, y type T eq) bool { return x > y }", "cannot compare"},
+	}
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, "p.go", "package p\n\n"+test.src, 0)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+			continue
+		}
+
+		_, err = (&types.Config{}).Check("p", fset, []*ast.File{file}, nil)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: %v", test.src, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: got error %v, want %q", test.src, err, test.err)
+		}
+	}
+}
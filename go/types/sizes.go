@@ -37,6 +37,11 @@ type Sizes interface {
 //	- All other types have size WordSize.
 //	- Arrays and structs are aligned per spec definition; all other
 //	  types are naturally aligned with a maximum alignment MaxAlign.
+//	- Instances of generic types are laid out like their underlying
+//	  types, with the type arguments substituted. Type parameters
+//	  have no layout, it's only known in instances: their size and
+//	  alignment are -1, and so are the sizes, alignments and offsets
+//	  depending on them or on generic array lengths.
 //
 // *StdSizes implements Sizes.
 //
@@ -59,11 +64,17 @@ func (s *StdSizes) Alignof(T Type) int64 {
 		// field f of x, but at least 1."
 		max := int64(1)
 		for _, f := range t.fields {
-			if a := s.Alignof(f.typ); a > max {
+			a := s.Alignof(f.typ)
+			if a < 0 {
+				return -1
+			}
+			if a > max {
 				max = a
 			}
 		}
 		return max
+	case *TypeParam:
+		return -1
 	case *Slice, *Interface:
 		// Multiword data structures are effectively structs
 		// in which each element has size WordSize.
@@ -93,10 +104,22 @@ func (s *StdSizes) Offsetsof(fields []*Var) []int64 {
 	offsets := make([]int64, len(fields))
 	var o int64
 	for i, f := range fields {
+		if o < 0 {
+			offsets[i] = -1
+			continue
+		}
 		a := s.Alignof(f.typ)
+		if a < 0 {
+			o, offsets[i] = -1, -1
+			continue
+		}
 		o = align(o, a)
 		offsets[i] = o
-		o += s.Sizeof(f.typ)
+		if z := s.Sizeof(f.typ); z >= 0 {
+			o += z
+		} else {
+			o = -1
+		}
 	}
 	return offsets
 }
@@ -131,12 +154,18 @@ func (s *StdSizes) Sizeof(T Type) int64 {
 			return s.WordSize * 2
 		}
 	case *Array:
+		if t.param != nil {
+			return -1
+		}
 		n := t.len
 		if n == 0 {
 			return 0
 		}
 		a := s.Alignof(t.elem)
 		z := s.Sizeof(t.elem)
+		if a < 0 || z < 0 {
+			return -1
+		}
 		return align(z, a)*(n-1) + z
 	case *Slice:
 		return s.WordSize * 3
@@ -146,9 +175,15 @@ func (s *StdSizes) Sizeof(T Type) int64 {
 			return 0
 		}
 		offsets := s.Offsetsof(t.fields)
-		return offsets[n-1] + s.Sizeof(t.fields[n-1].typ)
+		z := s.Sizeof(t.fields[n-1].typ)
+		if offsets[n-1] < 0 || z < 0 {
+			return -1
+		}
+		return offsets[n-1] + z
 	case *Interface:
 		return s.WordSize * 2
+	case *TypeParam:
+		return -1
 	}
 	return s.WordSize // catch-all
 }
@@ -0,0 +1,128 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/faiface/generics/go/ast"
+	"github.com/faiface/generics/go/constant"
+	"github.com/faiface/generics/go/parser"
+	"github.com/faiface/generics/go/token"
+	"github.com/faiface/generics/go/types"
+)
+
+// TestSizesTypeParams checks that the layout depending on type parameters is unknown.
+func TestSizesTypeParams(t *testing.T) {
+	const src = `package p
+
+func F(x type T) {
+	var s struct {
+		b byte
+		t T
+		c int
+	}
+	var a [2]T
+	var p struct {
+		b byte
+		q *T
+	}
+	_, _, _ = s, a, p
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	if _, err := (&types.Config{}).Check("p", fset, []*ast.File{file}, info); err != nil {
+		t.Fatal(err)
+	}
+	vars := make(map[string]types.Type)
+	for ident, obj := range info.Defs {
+		if obj != nil {
+			vars[ident.Name] = obj.Type()
+		}
+	}
+
+	sizes := &types.StdSizes{WordSize: 8, MaxAlign: 8}
+	tests := []struct {
+		name        string
+		size, align int64
+		offsets     []int64 // offsets of the fields of a struct
+	}{
+		{"x", -1, -1, nil},
+		{"s", -1, -1, []int64{0, -1, -1}},
+		{"a", -1, -1, nil},
+		{"p", 16, 8, []int64{0, 8}},
+	}
+	for _, test := range tests {
+		typ := vars[test.name]
+		if size := sizes.Sizeof(typ); size != test.size {
+			t.Errorf("size of %s %s is %d, want %d", test.name, typ, size, test.size)
+		}
+		if align := sizes.Alignof(typ); align != test.align {
+			t.Errorf("alignment of %s %s is %d, want %d", test.name, typ, align, test.align)
+		}
+		if test.offsets == nil {
+			continue
+		}
+		st := typ.Underlying().(*types.Struct)
+		var fields []*types.Var
+		for i := 0; i < st.NumFields(); i++ {
+			fields = append(fields, st.Field(i))
+		}
+		for i, offset := range sizes.Offsetsof(fields) {
+			if offset != test.offsets[i] {
+				t.Errorf("offset of %s.%s is %d, want %d", test.name, fields[i].Name(), offset, test.offsets[i])
+			}
+		}
+	}
+}
+
+// TestSizesConstant checks that layouts of instances are constant, while layouts depending on
+// type parameters are only known in instances.
+func TestSizesConstant(t *testing.T) {
+	const src = `package p
+
+import "unsafe"
+
+type Pair(type K, type V) struct {
+	Key   K
+	Value V
+}
+
+func Size(x type T) uintptr { return unsafe.Sizeof(x) }
+
+func Offset(p Pair(type K, type V)) uintptr { return unsafe.Offsetof(p.Value) }
+
+const pairSize = unsafe.Sizeof(Pair(int8, int64){})
+
+func Align(x type T) uintptr { return unsafe.Alignof(x) }
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}
+	if _, err := (&types.Config{Importer: unsafeImporter{}}).Check("p", fset, []*ast.File{file}, info); err != nil {
+		t.Fatal(err)
+	}
+
+	for e, tv := range info.Types {
+		call, ok := e.(*ast.CallExpr)
+		if !ok || tv.IsType() {
+			continue
+		}
+		switch fset.Position(call.Pos()).Line {
+		case 10, 12, 16:
+			if tv.Value != nil {
+				t.Errorf("layout depending on type parameters is constant %s", tv.Value)
+			}
+		case 14:
+			if size, _ := constant.Int64Val(tv.Value); size != 16 {
+				t.Errorf("size of Pair(int8, int64) is %v, want 16", tv.Value)
+			}
+		}
+	}
+}
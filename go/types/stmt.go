@@ -757,6 +757,19 @@ func (check *Checker) stmt(ctxt stmtContext, s ast.Stmt) {
 				if isString(typ) {
 					key = Typ[Int]
 					val = universeRune // use 'rune' name
+				} else if isInteger(typ) {
+					// spec: "For an integer value n, where n is of integer type
+					// or an untyped integer constant, the iteration values 0
+					// through n-1 are produced in increasing order."
+					check.convertUntyped(&x, Typ[Int])
+					if x.mode == invalid {
+						break
+					}
+					key = x.typ
+					if s.Value != nil {
+						check.errorf(s.Value.Pos(), "range over %s permits only one iteration variable", &x)
+						// ok to continue
+					}
 				}
 			case *Array:
 				key = Typ[Int]
@@ -783,6 +796,17 @@ func (check *Checker) stmt(ctxt stmtContext, s ast.Stmt) {
 					check.errorf(s.Value.Pos(), "iteration over %s permits only one iteration variable", &x)
 					// ok to continue
 				}
+			case *Signature:
+				// spec: "For a function f, the iteration proceeds by calling f
+				// with a new, synthesized yield function as its argument."
+				key, val = rangeFunc(typ)
+				if key == nil {
+					break
+				}
+				if key == Typ[Invalid] && s.Key != nil || val == Typ[Invalid] && s.Value != nil {
+					check.errorf(x.pos(), "range over %s permits fewer iteration variables", &x)
+					// ok to continue
+				}
 			}
 		}
 
@@ -870,3 +894,24 @@ func (check *Checker) stmt(ctxt stmtContext, s ast.Stmt) {
 		check.error(s.Pos(), "invalid statement")
 	}
 }
+
+// rangeFunc returns the types of the iteration values of a function to range over, like
+// func(yield func(K, V) bool), or nil if the function can't be ranged over. Missing values are
+// of invalid type.
+func rangeFunc(f *Signature) (key, val Type) {
+	if f.params.Len() != 1 || f.results.Len() != 0 {
+		return nil, nil
+	}
+	yield, _ := f.params.At(0).typ.Underlying().(*Signature)
+	if yield == nil || yield.variadic || yield.params.Len() > 2 || yield.results.Len() != 1 || !isBoolean(yield.results.At(0).typ) {
+		return nil, nil
+	}
+	key, val = Typ[Invalid], Typ[Invalid]
+	if yield.params.Len() > 0 {
+		key = yield.params.At(0).typ
+	}
+	if yield.params.Len() > 1 {
+		val = yield.params.At(1).typ
+	}
+	return key, val
+}
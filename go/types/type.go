@@ -92,16 +92,20 @@ func (b *Basic) Name() string { return b.name }
 
 // An Array represents an array type.
 type Array struct {
-	len  int64
-	elem Type
+	len   int64
+	elem  Type
+	param *TypeParam // generic array length; nil if the length is known
 }
 
 // NewArray returns a new array type for the given element type and length.
-func NewArray(elem Type, len int64) *Array { return &Array{len, elem} }
+func NewArray(elem Type, len int64) *Array { return &Array{len: len, elem: elem} }
 
-// Len returns the length of array a.
+// Len returns the length of array a, or -1 if the length is a generic parameter.
 func (a *Array) Len() int64 { return a.len }
 
+// Param returns the generic array length parameter of array a, or nil if the length is known.
+func (a *Array) Param() *TypeParam { return a.param }
+
 // Elem returns element type of array a.
 func (a *Array) Elem() Type { return a.elem }
 
@@ -375,6 +379,15 @@ func (t *Interface) Complete() *Interface {
 			}
 		}
 		sort.Sort(byUniqueMethodName(allMethods))
+
+		// the method sets of embedded interfaces may overlap
+		unique := allMethods[:0]
+		for _, m := range allMethods {
+			if len(unique) == 0 || unique[len(unique)-1].Id() != m.Id() {
+				unique = append(unique, m)
+			}
+		}
+		allMethods = unique
 	}
 	t.allMethods = allMethods
 
@@ -518,12 +531,18 @@ const (
 	RestrictionEq = 1 << iota
 	RestrictionOrd
 	RestrictionNum
+	RestrictionInteger
 )
 
 // A TypeParam represents a generic type parameter from a function signature.
+//
+// Generic array lengths, like n in [const n]T, are represented as type parameters too.
+// They are mapped to the array types their lengths are inferred from.
 type TypeParam struct {
 	obj         *TypeName
 	restriction Restriction
+	iface       Type // interface restricting the type parameter, or nil
+	length      *Var // variable holding the length in the function body; nil for type parameters
 }
 
 // NewTypeParam returns a new generic type with the specified type name.
@@ -539,6 +558,27 @@ func (t *TypeParam) Restriction() Restriction {
 	return t.restriction
 }
 
+// Interface returns the interface the type arguments for t must implement,
+// or nil if t isn't restricted by an interface.
+func (t *TypeParam) Interface() Type {
+	return t.iface
+}
+
+// methods returns the underlying interface restricting t, or nil.
+func (t *TypeParam) methods() *Interface {
+	if t.iface == nil {
+		return nil
+	}
+	iface, _ := t.iface.Underlying().(*Interface)
+	return iface
+}
+
+// Length returns the variable holding the value of a generic array length in the function body,
+// or nil if t is a type parameter.
+func (t *TypeParam) Length() *Var {
+	return t.length
+}
+
 // Implementations for Type methods.
 
 func (t *Basic) Underlying() Type     { return t }
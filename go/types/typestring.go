@@ -108,7 +108,11 @@ func writeType(buf *bytes.Buffer, typ Type, qf Qualifier, visited []Type) {
 		buf.WriteString(t.name)
 
 	case *Array:
-		fmt.Fprintf(buf, "[%d]", t.len)
+		if t.param != nil {
+			fmt.Fprintf(buf, "[%s]", t.param.Name())
+		} else {
+			fmt.Fprintf(buf, "[%d]", t.len)
+		}
 		writeType(buf, t.elem, qf, visited)
 
 	case *Slice:
@@ -258,9 +262,15 @@ func writeType(buf *bytes.Buffer, typ Type, qf Qualifier, visited []Type) {
 		if t.Restriction()&RestrictionOrd != 0 {
 			buf.WriteString(" ord")
 		}
-		if t.Restriction()&RestrictionNum != 0 {
+		if t.Restriction()&RestrictionInteger != 0 {
+			buf.WriteString(" integer")
+		} else if t.Restriction()&RestrictionNum != 0 {
 			buf.WriteString(" num")
 		}
+		if t.iface != nil {
+			buf.WriteByte(' ')
+			writeType(buf, t.iface, qf, visited)
+		}
 
 	default:
 		// For externally defined implementations of Type.
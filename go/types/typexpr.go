@@ -302,7 +302,12 @@ func (check *Checker) typExprInternal(scope *Scope, e ast.Expr, def *Named, path
 		if e.Len != nil {
 			typ := new(Array)
 			def.setUnderlying(typ)
-			typ.len = check.arrayLength(e.Len)
+			if param := check.lengthParam(scope, e.Len); param != nil {
+				typ.len = -1
+				typ.param = param
+			} else {
+				typ.len = check.arrayLength(e.Len)
+			}
 			typ.elem = check.typExpr(scope, e.Elt, nil, path, false)
 			return typ
 
@@ -385,6 +390,14 @@ func (check *Checker) typExprInternal(scope *Scope, e ast.Expr, def *Named, path
 
 		typ.obj = &TypeName{object{nil, e.Name.Pos(), check.pkg, e.Name.Name, typ, 0, token.NoPos}}
 		typ.restriction = Restriction(e.Restriction)
+		if e.Interface != nil {
+			iface := check.typ(scope, e.Interface, false)
+			if _, ok := iface.Underlying().(*Interface); ok {
+				typ.iface = iface
+			} else if iface != Typ[Invalid] {
+				check.errorf(e.Interface.Pos(), "%s is not an interface", iface)
+			}
+		}
 		check.declare(scope, e.Name, typ.obj, e.Name.Pos())
 		return typ
 
@@ -422,6 +435,39 @@ func (check *Checker) typOrNil(e ast.Expr) Type {
 	return Typ[Invalid]
 }
 
+// lengthParam returns the generic array length declared or referred to by the array length
+// expression e, or nil if e is an ordinary array length.
+func (check *Checker) lengthParam(scope *Scope, e ast.Expr) *TypeParam {
+	if scope == nil {
+		scope = check.scope
+	}
+
+	switch e := e.(type) {
+	case *ast.ConstParam:
+		typ := new(TypeParam)
+		typ.obj = NewTypeName(e.Name.Pos(), check.pkg, e.Name.Name, typ)
+		typ.length = NewParam(e.Name.Pos(), check.pkg, e.Name.Name, Typ[Int])
+		check.declare(scope, e.Name, typ.length, e.Name.Pos())
+		if check.lengths == nil {
+			check.lengths = make(map[*Var]*TypeParam)
+		}
+		check.lengths[typ.length] = typ
+		return typ
+
+	case *ast.Ident:
+		_, obj := scope.LookupParent(e.Name, check.pos)
+		v, ok := obj.(*Var)
+		if !ok || check.lengths[v] == nil {
+			return nil
+		}
+		check.recordUse(e, v)
+		check.recordTypeAndValue(e, value, v.typ, nil)
+		return check.lengths[v]
+	}
+
+	return nil
+}
+
 func (check *Checker) arrayLength(e ast.Expr) int64 {
 	var x operand
 	check.expr(&x, e)
@@ -544,6 +590,7 @@ func (check *Checker) interfaceType(scope *Scope, iface *Interface, ityp *ast.In
 		mset       objset
 		signatures []ast.Expr // list of corresponding method signatures
 		embedded   []ast.Expr // list of embedded types
+		overlaps   []overlap  // embedded methods with the names of other methods
 	)
 	for _, f := range ityp.Methods.List {
 		if len(f.Names) > 0 {
@@ -594,9 +641,9 @@ func (check *Checker) interfaceType(scope *Scope, iface *Interface, ityp *ast.In
 		pos := e.Pos()
 		typ := check.typExpr(scope, e, nil, path, false)
 		// Determine underlying embedded (possibly incomplete) type
-		// by following its forward chain.
-		named, _ := typ.(*Named)
-		under := underlying(named)
+		// by following its forward chain. An alias like any denotes
+		// an interface type directly.
+		under := underlying(typ)
 		embed, _ := under.(*Interface)
 		if embed == nil {
 			if typ != Typ[Invalid] {
@@ -604,15 +651,21 @@ func (check *Checker) interfaceType(scope *Scope, iface *Interface, ityp *ast.In
 			}
 			continue
 		}
-		iface.embeddeds = append(iface.embeddeds, named)
+		iface.embeddeds = append(iface.embeddeds, typ)
 		// collect embedded methods
 		if embed.allMethods == nil {
-			check.errorf(pos, "internal error: incomplete embedded interface %s (issue #18395)", named)
+			check.errorf(pos, "internal error: incomplete embedded interface %s (issue #18395)", typ)
 		}
 		for _, m := range embed.allMethods {
-			if check.declareInSet(&mset, pos, m) {
-				iface.allMethods = append(iface.allMethods, m)
+			// spec: "the method sets of embedded interfaces may overlap,
+			// as long as methods with the same names have identical
+			// signatures". The signatures of explicitly declared
+			// methods aren't known yet, so they're compared below.
+			if alt := mset.insert(m); alt != nil {
+				overlaps = append(overlaps, overlap{pos, alt.(*Func), m})
+				continue
 			}
+			iface.allMethods = append(iface.allMethods, m)
 		}
 	}
 
@@ -638,6 +691,13 @@ func (check *Checker) interfaceType(scope *Scope, iface *Interface, ityp *ast.In
 		*old = *sig // update signature (don't replace it!)
 	}
 
+	for _, o := range overlaps {
+		if !Identical(o.alt.typ, o.m.typ) {
+			check.errorf(o.pos, "duplicate method %s", o.m.name)
+			check.reportAltDecl(o.alt)
+		}
+	}
+
 	// TODO(gri) The list of explicit methods is only sorted for now to
 	// produce the same Interface as NewInterface. We may be able to
 	// claim source order in the future. Revisit.
@@ -655,6 +715,13 @@ func (check *Checker) interfaceType(scope *Scope, iface *Interface, ityp *ast.In
 	}
 }
 
+// An overlap is a method of an embedded interface at pos with the same name
+// as the method alt, which was collected before.
+type overlap struct {
+	pos    token.Pos
+	alt, m *Func
+}
+
 // byUniqueTypeName named type lists can be sorted by their unique type names.
 type byUniqueTypeName []Type
 
@@ -784,6 +851,9 @@ func anonymousFieldIdent(e ast.Expr) *ast.Ident {
 		}
 	case *ast.SelectorExpr:
 		return e.Sel
+	case *ast.CallExpr:
+		// an instance List(T) is named after its generic type
+		return anonymousFieldIdent(e.Fun)
 	}
 	return nil // invalid anonymous field
 }
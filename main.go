@@ -1,136 +1,196 @@
 package main
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/faiface/generics/degen"
 	"github.com/faiface/generics/go/ast"
-	"github.com/faiface/generics/go/importer"
 	"github.com/faiface/generics/go/parser"
 	"github.com/faiface/generics/go/printer"
+	"github.com/faiface/generics/go/scanner"
 	"github.com/faiface/generics/go/token"
-	"github.com/faiface/generics/go/types"
 )
 
 var (
-	output  = flag.String("out", "out.go", "output file")
-	debug   = flag.Bool("debug", false, "prints intermediate type-checking errors to the standard output and other debug info")
-	maxPass = flag.Int("maxpass", -1, "maximum number of passes")
+	output = flag.String("out", "out.go", "output file when translating a single file")
+	outdir = flag.String("outdir", "", "output directory; each translated file is written there under its original name")
+
+	maxDepth       = flag.Int("maxdepth", 100, "maximum length of a chain of instantiations, like F(int) -> G([]int) -> ...; 0 for no limit")
+	mangle         = flag.String("mangle", "readable", "naming of instances: readable, like Map_int_string, or hash, like Map_3f2a9c1e")
+	mode           = flag.String("mode", "monomorphize", "translation of generic functions: monomorphize, copying them for each instance, dictionary, sharing one implementation, or shape, copying them for each memory layout of the type arguments")
+	lineDirectives = flag.Bool("linedirectives", false, "emits //line directives, so that compiler errors and stack traces point at the generic source")
+	importFrom     = flag.String("importer", "source", "import of standard library packages: source, type-checking them from GOROOT with the toolchain's go/types, or gc, reading the export data of its compiler")
 )
 
 func init() {
 	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags...] <file>\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags...] <file or package directory>\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s migrate [-out file | -outdir directory] <file or package directory>\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 }
 
+// fail prints the error, or each error of a list, like the compiler does, and exits.
 func fail(err error) {
-	fmt.Fprintln(os.Stderr, err)
+	scanner.PrintError(os.Stderr, err)
 	os.Exit(1)
 }
 
-func main() {
-	flag.Parse()
-	if len(flag.Args()) != 1 || flag.Arg(0) == "" {
-		flag.Usage()
-		return
+// parseInput parses either a single file, or all non-test .go files of a package directory.
+func parseInput(fset *token.FileSet, path string) (files []*ast.File, isDir bool, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, err
 	}
 
-	fset := token.NewFileSet()
+	if !info.IsDir() {
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments|parser.DeclarationErrors)
+		if err != nil {
+			return nil, false, err
+		}
+		return []*ast.File{file}, false, nil
+	}
+
+	files, err = degen.ParsePackage(fset, path)
+	return files, true, err
+}
+
+// outputPath returns the path of the output file for the input file at path.
+func outputPath(path string) string {
+	if *outdir != "" {
+		return filepath.Join(*outdir, filepath.Base(path))
+	}
+	return *output
+}
 
-	file, err := parser.ParseFile(
-		fset,
-		flag.Arg(0),
-		nil,
-		parser.DeclarationErrors,
-	)
+// migrate rewrites the generic syntax of a file or a package directory to Go 1.18 type
+// parameters.
+func migrate(fset *token.FileSet, imp *degen.Importer, files []*ast.File, filenames []string) {
+	var sources [][]byte
+	for _, filename := range filenames {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			fail(err)
+		}
+		sources = append(sources, src)
+	}
+
+	migrated, err := degen.Migrate(fset, imp, files, sources)
 	if err != nil {
 		fail(err)
 	}
+	for i, src := range migrated {
+		err := os.WriteFile(outputPath(filenames[i]), src, 0644)
+		if err != nil {
+			fail(err)
+		}
+	}
+}
 
-	typesCfg := types.Config{
-		Importer: importer.Default(),
+func main() {
+	migrating := len(os.Args) > 1 && os.Args[1] == "migrate"
+	if migrating {
+		flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
 	}
-	info := types.Info{
-		Types:        make(map[ast.Expr]types.TypeAndValue),
-		GenericCalls: make(map[*ast.CallExpr]*types.GenericCall),
+	if len(flag.Args()) != 1 || flag.Arg(0) == "" {
+		flag.Usage()
+		return
 	}
-	_, err = typesCfg.Check("", fset, []*ast.File{file}, &info)
-	if err != nil {
-		fail(err)
+
+	var mangling degen.Mangling
+	switch *mangle {
+	case "readable":
+		mangling = degen.Readable
+	case "hash":
+		mangling = degen.Hashed
+	default:
+		fail(fmt.Errorf("-mangle must be readable or hash, not %q", *mangle))
 	}
 
-	// degenerate
-	for pass := 1; *maxPass < 0 || pass <= *maxPass; pass++ {
-		if *debug {
-			fmt.Printf("PASS %d\n", pass)
-		}
+	var translation degen.Mode
+	switch *mode {
+	case "monomorphize":
+		translation = degen.Monomorphize
+	case "dictionary":
+		translation = degen.Dictionary
+	case "shape":
+		translation = degen.Shape
+	default:
+		fail(fmt.Errorf("-mode must be monomorphize, dictionary, or shape, not %q", *mode))
+	}
 
-		var changed bool
-		file, changed = degen.Degen(fset, file, *debug)
+	fset := token.NewFileSet()
+	var imp *degen.Importer
+	switch *importFrom {
+	case "source":
+		imp = degen.NewImporter(fset)
+	case "gc":
+		imp = degen.NewGCImporter(fset)
+	default:
+		fail(fmt.Errorf("-importer must be source or gc, not %q", *importFrom))
+	}
 
-		var b bytes.Buffer
-		err := printer.Fprint(&b, fset, file)
+	input := flag.Arg(0)
+	if *lineDirectives {
+		// //line directives with relative paths are resolved from the directory of the output
+		abs, err := filepath.Abs(input)
 		if err != nil {
 			fail(err)
 		}
+		input = abs
+	}
+	files, isDir, err := parseInput(fset, input)
+	if err != nil {
+		fail(err)
+	}
+	if isDir && *outdir == "" {
+		fail(fmt.Errorf("-outdir must be set when translating a package directory"))
+	}
 
-		fset = token.NewFileSet()
-		file, err = parser.ParseFile(
-			fset,
-			flag.Arg(0),
-			&b,
-			parser.DeclarationErrors,
-		)
+	var filenames []string
+	for _, file := range files {
+		filenames = append(filenames, fset.Position(file.Package).Filename)
+	}
+
+	if *outdir != "" {
+		err := os.MkdirAll(*outdir, 0755)
 		if err != nil {
 			fail(err)
 		}
-
-		if !changed {
-			break
-		}
 	}
 
-	// filter out generic function declarations
-	var decls []ast.Decl
-	for _, decl := range file.Decls {
-		switch decl := decl.(type) {
-		default:
-			decls = append(decls, decl)
-
-		case *ast.FuncDecl:
-			if len(decl.TypeParams) == 0 {
-				decls = append(decls, decl)
-			}
-
-		case *ast.GenDecl:
-			if decl.Tok != token.TYPE {
-				decls = append(decls, decl)
-				continue
-			}
-
-			for _, spec := range decl.Specs {
-				spec := spec.(*ast.TypeSpec)
-
-				if len(spec.Params) == 0 {
-					decls = append(decls, &ast.GenDecl{
-						Tok:   decl.Tok,
-						Specs: []ast.Spec{spec},
-					})
-				}
-			}
-		}
+	if migrating {
+		migrate(fset, imp, files, filenames)
+		return
 	}
-	file.Decls = decls
 
-	outputFile, err := os.Create(*output)
+	result, err := degen.Translate(fset, files, degen.Options{
+		Importer:       imp,
+		LineDirectives: *lineDirectives,
+		MaxDepth:       *maxDepth,
+		Mangling:       mangling,
+		Mode:           translation,
+	})
 	if err != nil {
 		fail(err)
 	}
-	defer outputFile.Close()
-	printer.Fprint(outputFile, fset, file)
+
+	printerCfg := &printer.Config{Tabwidth: 8}
+	if *lineDirectives {
+		printerCfg.Mode |= printer.SourcePos
+	}
+
+	for i, file := range result.Files {
+		outputFile, err := os.Create(outputPath(filenames[i]))
+		if err != nil {
+			fail(err)
+		}
+		printerCfg.Fprint(outputFile, fset, file)
+		outputFile.Close()
+	}
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const lineDirectivesSrc = `package main
+
+func First(xs []type T) T {
+	return xs[0]
+}
+
+func main() {
+	println(First([]int{}))
+}
+`
+
+// TestLineDirectives translates a file given by a relative path into another directory with
+// -linedirectives, and checks that a panic in instantiated code is reported at the generic source.
+func TestLineDirectives(t *testing.T) {
+	dir := t.TempDir()
+	tool := filepath.Join(dir, "generics")
+	if out, err := exec.Command("go", "build", "-o", tool, ".").CombinedOutput(); err != nil {
+		t.Fatalf("building the tool failed: %v\n%s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.go"), []byte(lineDirectivesSrc), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	translate := exec.Command(tool, "-linedirectives", "-outdir", "out", "b.go")
+	translate.Dir = dir
+	if out, err := translate.CombinedOutput(); err != nil {
+		t.Fatalf("translating failed: %v\n%s", err, out)
+	}
+
+	run := exec.Command("go", "run", filepath.Join("out", "b.go"))
+	run.Dir = dir
+	out, _ := run.CombinedOutput()
+	if want := filepath.Join(dir, "b.go") + ":4"; !strings.Contains(string(out), want) {
+		t.Errorf("panic isn't reported at %s:\n%s", want, out)
+	}
+}